@@ -1,140 +1,494 @@
 package cmd
 
 import (
+	"io/ioutil"
 	Utils "maru/utils"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 var buildArgs []string
 
+var buildLocal bool
+
+var buildSecrets []string
+
+var buildSSH []string
+
+var buildFrozen bool
+
+var buildAll bool
+
+var buildProjects []string
+
+var buildCacheFrom []string
+
+var buildCacheTo []string
+
+var buildNoCache bool
+
+var buildPull bool
+
+var buildPlatforms []string
+
+// Build arguments with names like these probably contain credentials, which would be visible in the image history
+var credentialArgNames = []string{"TOKEN", "PASSWORD", "SECRET", "CREDENTIAL"}
+
 var buildCmd = &cobra.Command{
-	Use:   "build",
+	Use:   "build [--local [path] | --all]",
 	Short: "Build container image for the current project",
 	Long: `Runs a Docker build for the current Maru project. The current directory must contain a maru.yaml 
 file describing the project. You can initialize a project using the init command.
+
+With --local, the code is taken from the given directory (by default the current directory) instead of being 
+cloned from the git repository, including any uncommitted changes. The image is then only tagged with the version 
+followed by the commit, e.g. ^myapp:1.0.0-1a2b3c4-dirty^, so that it's never confused with a release build.
+
+Private repositories can be cloned by passing a token as a BuildKit secret, e.g. 
+^--secret id=git_token,env=GITHUB_TOKEN^, or by forwarding the SSH agent with ^--ssh default^. These can also be 
+configured permanently using the ^secrets^ and ^ssh^ lists in the maru.yaml. Credentials are only mounted while 
+cloning and never end up in the image.
+
+The host keys of ssh repositories are verified against ^~/.ssh/known_hosts^, or against the file passed as the 
+^known_hosts^ secret, e.g. ^--secret id=known_hosts,src=known_hosts^ for a file in the project. Builds of hosts 
+without a known key fail.
+
+The commit and base images are pinned in the maru.lock, which is created by the first build and updated when the
+Git tag or base images change. Use ^maru lock --update^ to pin newer ones, and --frozen to fail if the lock is out
+of date instead of updating it, e.g. in continuous integration.
+
+The build cache is imported from ^<remote>/<name>-buildcache^ for each remote, so that builds on other machines
+reuse the layers which didn't change. Set ^cache.export^ in the maru.yaml to also export the cache there after the
+build, e.g. in continuous integration, or set the images in ^cache.from^ and ^cache.to^. The --cache-from and
+--cache-to flags replace the configured images for a single build. Use --no-cache to build every step again, and
+--pull to use newer versions of the base images.
+
+Named profiles in the maru.yaml, e.g. ^dev^ and ^release^, override the Git tag, build arguments, Dockerfile target,
+cache and remotes, and add more tags. Select one with --profile, and pass the same profile to ^maru push^. Profiles
+which build another Git tag are tagged with their name instead of latest, e.g. ^<name>:<version>-dev^, and push
+that tag, so that they never replace the release.
+
+To build for other platforms than the one of this machine, e.g. for ARM machines, list them in ^platforms^ in the
+maru.yaml, or use --platform. Docker builds each platform in turn through its API, and ^maru push^ publishes them
+together as one manifest list.
+
+With --all, every project in the workspace is built, in an order where each project is built after the projects
+whose images it uses in FROM. The workspace is described by a maru-workspace.yaml in the current directory or one of
+its parents, or else consists of every directory below the current directory with a maru.yaml. Use --project to
+only build the given projects and the projects which depend on them, e.g. after changing a base image. Those
+dependants are only built again if the image of a project they depend on changed.
 `,
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		runBuild()
+		Utils.UseCurrentTime()
+		if buildAll {
+			if buildLocal || len(args) > 0 {
+				Utils.PrintFatal("--local can't be combined with --all")
+			}
+			runWorkspaceBuild()
+			return
+		}
+		if len(buildProjects) > 0 {
+			Utils.PrintFatal("--project can only be used together with --all")
+		}
+		localPath := ""
+		if len(args) > 0 {
+			if !buildLocal {
+				Utils.PrintFatal("A source path can only be given together with --local")
+			}
+			localPath = args[0]
+		} else if buildLocal {
+			localPath = "."
+		}
+		config := Utils.ReadMandatoryProjectConfig()
+		applyProfile(config, false)
+		runBuild(config, localPath, nil)
 	},
 }
 
 func init() {
 	buildCmd.Flags().StringArrayVar(&buildArgs, "build-arg", nil, "Set build-time arguments for the container, e.g. when using run or shell")
+	buildCmd.Flags().BoolVar(&buildLocal, "local", false, "Build the code in a local directory instead of cloning the git repository")
+	buildCmd.Flags().StringArrayVar(&buildSecrets, "secret", nil, "Secret to expose to the build, e.g. id=git_token,env=GITHUB_TOKEN")
+	buildCmd.Flags().StringArrayVar(&buildSSH, "ssh", nil, "SSH agent socket or keys to expose to the build, e.g. default")
+	buildCmd.Flags().BoolVar(&buildFrozen, "frozen", false, "Fail if the maru.lock is missing or out of date, instead of updating it")
+	buildCmd.Flags().BoolVar(&buildAll, "all", false, "Build every project in the workspace, in dependency order")
+	buildCmd.Flags().StringArrayVar(&buildProjects, "project", nil, "With --all, only build this project and the projects which depend on it")
+	buildCmd.Flags().StringArrayVar(&buildCacheFrom, "cache-from", nil, "Import the build cache from this image, instead of the configured ones")
+	buildCmd.Flags().StringArrayVar(&buildCacheTo, "cache-to", nil, "Export the build cache to this image, instead of the configured ones")
+	buildCmd.Flags().BoolVar(&buildNoCache, "no-cache", false, "Build every step again instead of using the cache")
+	buildCmd.Flags().BoolVar(&buildPull, "pull", false, "Pull newer versions of the base images")
+	buildCmd.Flags().StringVar(&profileName, "profile", "", "Build with the settings of this profile in the maru.yaml")
+	buildCmd.Flags().StringSliceVar(&buildPlatforms, "platform", nil, "Build for these platforms instead of the configured ones, e.g. linux/amd64,linux/arm64")
 	rootCmd.AddCommand(buildCmd)
 }
 
-func runBuild() {
+// Builds the current project with the given configuration, after any profile was applied. If localPath is not empty,
+// the code is taken from that directory instead of git. When building a workspace, workspaceImages contains the
+// repositories of the images built by its projects. These base images are used as built locally instead of being
+// pinned, and the project is also tagged for its remotes so that the projects depending on it find it. Returns false
+// if the build failed.
+func runBuild(config *Utils.MaruConfig, localPath string, workspaceImages map[string]bool) bool {
 
-	config := Utils.ReadMandatoryProjectConfig()
-	versionTag := config.GetNameVersion()
+	validateProjectOrExit(config)
+	if localPath != "" && config.TemplateArgs.Flavor == "" {
+		Utils.PrintFatal("Local builds are only supported for projects with a flavor")
+	}
 
 	if config.TemplateArgs.Flavor != "" {
-		checksum := config.GetTemplateArgsChecksum()
-		if !Utils.TestChecksum(checksum) {
-			Utils.PrintDebug("Checksum does not match: %s", checksum)
-			if Utils.AskForBool("The project configuration has changed. Do you want to regenerate the Dockerfile?", true) {
-				Init()
-				if !Utils.AskForBool("Proceed with container build?", true) {
-					os.Exit(0)
-				}
+		checkDockerfile(config)
+	}
+
+	// Local builds don't use the pinned commit, so they only use the lock if it's already up to date. Neither do
+	// profiles which build another Git tag, e.g. a branch.
+	var lock *Utils.MaruLock
+	if config.ProfileGitTag {
+		if buildFrozen {
+			Utils.PrintFatal("The profile %s builds %s instead of the Git tag in %s, so it can't be built with --frozen",
+				config.Profile, config.GetRepoTag(), Utils.LockFile)
+		}
+		Utils.PrintDebug("Not using %s, because the profile %s builds %s", Utils.LockFile, config.Profile,
+			config.GetRepoTag())
+	} else {
+		lock = resolveLock(config, buildFrozen, localPath == "", workspaceImages)
+	}
+	gitCommit := ""
+	if lock != nil && lock.GitCommit != "" {
+		gitCommit = lock.GitCommit
+		Utils.PinGitCommit(lock.RepoUrl, lock.GitTag, lock.GitCommit)
+	}
+
+	versionTag := config.GetNameVersion()
+	tags := config.GetTags()
+	localRevision := ""
+
+	if localPath != "" {
+		localRevision = getLocalRevision(localPath)
+		versionTag = config.GetNameVersion() + "-" + localRevision
+		tags = []string{versionTag}
+	} else if repoPath := Utils.GetLocalRepoPath(config.TemplateArgs.Build.RepoUrl); repoPath != "" {
+		// The builder container can't reach the host filesystem, so file:// repositories are cloned on the host
+		localPath = cloneLocalRepo(repoPath, config.GetRepoTag(), gitCommit)
+		defer os.RemoveAll(localPath)
+	}
+
+	if workspaceImages != nil {
+		for _, remote := range config.Remotes {
+			if !config.ProfileGitTag {
+				tags = append(tags, config.GetRemote(remote)+"/"+config.GetNameLatest())
 			}
+			tags = append(tags, config.GetDockerTag(remote))
 		}
 	}
 
 	if config.TemplateArgs.Build.RepoUrl == "" {
 		Utils.PrintInfo("Building %s", versionTag)
+	} else if localRevision != "" {
+		Utils.PrintInfo("Building %s from local directory %s", versionTag, localPath)
+	} else if gitCommit != "" {
+		Utils.PrintInfo("Building %s from %s @ %s (commit %s)", versionTag,
+			config.GetRepoTag(), config.TemplateArgs.Build.RepoUrl, gitCommit[:7])
 	} else {
 		Utils.PrintInfo("Building %s from %s @ %s", versionTag,
 			config.GetRepoTag(), config.TemplateArgs.Build.RepoUrl)
 	}
 
+	if config.Profile != "" {
+		Utils.PrintMessage("Using profile %s", config.Profile)
+	}
 	Utils.PrintMessage("Building image...")
 
-	// Interpolate map values to string pointers
-	args := make([]string, 1)
-
-	args[0] = "build"
-	i := 1
-
-	// Process command line build args first
+	// Process command line build args first, then add any build args from the config file which were not
+	// overridden on the command line
+	var buildArgList []string
 	set := make(map[string]bool)
 	for _, buildArg := range buildArgs {
 		s := strings.Split(buildArg, "=")
 		set[s[0]] = true
-		args = append(args, "--build-arg")
-		args = append(args, buildArg)
-		i += 2
+		buildArgList = append(buildArgList, buildArg)
+	}
+	for key := range config.BuildArgs {
+		if !set[key] {
+			buildArgList = append(buildArgList, key+"="+config.GetBuildArg(key))
+		}
 	}
 
-	// Add any build args from the config file which were not overridden on the command line
+	// Check out exactly the locked commit, unless a different tag is being built. Code which was already
+	// cloned on the host is checked out at the locked commit there.
+	if gitCommit != "" && localPath == "" && !set["GIT_TAG"] && !set["GIT_COMMIT"] {
+		buildArgList = append(buildArgList, "GIT_COMMIT="+gitCommit)
+	}
+
+	for key := range set {
+		warnIfCredential(key)
+	}
 	for key := range config.BuildArgs {
 		if !set[key] {
-			args = append(args, "--build-arg")
-			args = append(args, key+"="+config.GetBuildArg(key))
+			warnIfCredential(key)
+		}
+	}
+
+	// Base images are pinned to the locked digests. Images built earlier in the same workspace build are used as
+	// they are.
+	pins := make(map[string]string)
+	if lock != nil {
+		for image, digest := range lock.BaseImages {
+			if !workspaceImages[Utils.ImageRepository(image)] {
+				pins[image] = digest
+			}
+		}
+	}
+
+	build := Utils.ImageBuild{
+		Dir:        ".",
+		Dockerfile: Utils.PinBaseImages(readDockerfile(), pins),
+		Tags:       tags,
+		Target:     config.Target,
+		BuildArgs:  make(map[string]*string),
+		Secrets:    append(config.Secrets, buildSecrets...),
+		SSH:        append(config.SSH, buildSSH...),
+		CacheFrom:  buildCacheFrom,
+		CacheTo:    buildCacheTo,
+		NoCache:    buildNoCache,
+		Pull:       buildPull,
+		Platforms:  buildPlatforms,
+	}
+	if len(build.Platforms) == 0 {
+		build.Platforms = config.Platforms
+	}
+	for _, platform := range build.Platforms {
+		if err := Utils.ValidatePlatform(platform); err != nil {
+			Utils.PrintFatal("Invalid platform: %s", err)
+		}
+	}
+	if len(build.CacheFrom) == 0 {
+		build.CacheFrom = config.GetCacheFrom()
+	}
+	if len(build.CacheTo) == 0 {
+		build.CacheTo = config.GetCacheTo()
+	}
+	for _, buildArg := range buildArgList {
+		s := strings.SplitN(buildArg, "=", 2)
+		if len(s) == 2 {
+			build.BuildArgs[s[0]] = &s[1]
+		} else {
+			build.BuildArgs[s[0]] = nil
+		}
+	}
+	if localPath != "" {
+		absPath, err := filepath.Abs(localPath)
+		if err != nil {
+			Utils.PrintFatal("%s", err)
+		}
+		// The source directory is sent as the build context, which is otherwise unused
+		source := "local"
+		build.BuildArgs["MARU_SOURCE"] = &source
+		build.Dir = absPath
+		if localRevision != "" {
+			build.BuildArgs["MARU_LOCAL_REVISION"] = &localRevision
 		}
 	}
 
-	args = append(args, "-t")
-	args = append(args, config.Name+":latest")
-	args = append(args, "-t")
-	args = append(args, versionTag)
-	args = append(args, ".")
+	if localPath == "" {
+		addKnownHostsSecret(&build, config.TemplateArgs.Build.RepoUrl)
+	}
 
-	Utils.PrintHint("%% docker %s", strings.Join(args, " "))
+	revision := localRevision
+	if revision == "" {
+		revision = getSourceRevision(config, build.BuildArgs)
+	}
+	build.Labels = config.GetImageLabels(strings.TrimPrefix(versionTag, config.Name+":"), revision, time.Now())
 
-	err := Utils.RunCommand("docker", args...)
+	engine := Utils.GetEngine()
+	err := engine.BuildImage(build)
 	if err != nil {
-		Utils.PrintError("Command `docker build` failed with %s", err)
+		Utils.PrintError("Build failed: %s", err)
 	} else {
 		Utils.PrintSuccess("Successfully built %s", versionTag)
-		Utils.PrintInfo("Next use `maru run` to run the container")
+		if localRevision != "" {
+			Utils.PrintInfo("Use `%s run %s` to run the local build", engine.Command(), versionTag)
+		} else {
+			// Later commands such as push resolve ${date} in the version to the same time as this build
+			Utils.WriteBuildState(&Utils.BuildState{Time: Utils.InterpolationTime()})
+			if config.ProfileGitTag {
+				Utils.PrintInfo("Use `%s run %s` to run the build of the profile", engine.Command(), versionTag)
+			} else {
+				Utils.PrintInfo("Next use `maru run` to run the container")
+			}
+		}
 	}
 
-	// To get the Docker client working, I had to `go get github.com/docker/docker@master`
-	// as per https://github.com/moby/moby/issues/40185
+	return err == nil
+}
 
-	/*
-		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-		if err != nil {
-			Utils.PrintFatal("%s", err)
+// Returns the commit being built for the image labels: the one passed as GIT_COMMIT, or else the one which the Git
+// tag points to, which is the locked commit if there is a lock. Returns an empty string if it's unknown.
+func getSourceRevision(config *Utils.MaruConfig, buildArgs map[string]*string) string {
+	repoUrl := config.TemplateArgs.Build.RepoUrl
+	gitTag := buildArgs["GIT_TAG"]
+	if commit := buildArgs["GIT_COMMIT"]; commit != nil {
+		return *commit
+	}
+	if repoUrl == "" || gitTag == nil {
+		return ""
+	}
+	commit, err := Utils.ResolveGitCommit(repoUrl, *gitTag)
+	if err != nil {
+		Utils.PrintDebug("Cannot resolve the commit for the image labels: %s", err)
+		return ""
+	}
+	return commit
+}
+
+// Builds the projects in the workspace in dependency order, or only the selected projects and their dependants. The
+// dependants are only built again if the image of a project they depend on changed.
+func runWorkspaceBuild() {
+
+	root, projects := loadWorkspace()
+	selected := projects
+	if len(buildProjects) > 0 {
+		selected = findProjects(projects, buildProjects)
+		projects = Utils.Dependants(projects, selected)
+	}
+
+	workspaceImages := getWorkspaceImages(projects)
+	engine := Utils.GetEngine()
+	changed := make(map[*Utils.WorkspaceProject]bool)
+	built := 0
+	forEachProject(root, projects, func(p *Utils.WorkspaceProject) bool {
+		applyProfile(p.Config, true)
+		imageID := getImageID(engine, p.Config.GetNameVersion())
+		if !Utils.NeedsRebuild(p, selected, changed) && imageID != "" {
+			Utils.PrintMessage("Not building %s, because none of the images it uses changed", p.Config.Name)
+			return true
+		}
+		if !runBuild(p.Config, "", workspaceImages) {
+			return false
 		}
-		defer cli.Close()
+		built++
+		changed[p] = getImageID(engine, p.Config.GetNameVersion()) != imageID
+		return true
+	})
+	Utils.PrintSuccess("Successfully built %d projects", built)
+}
 
-		Utils.PrintMessage("Creating build context...")
+// Returns the ID of the given local image, or an empty string if it doesn't exist
+func getImageID(engine Utils.Engine, image string) string {
+	details, err := engine.InspectImage(image)
+	if err != nil {
+		Utils.PrintDebug("Cannot inspect %s: %s", image, err)
+		return ""
+	}
+	if details == nil {
+		return ""
+	}
+	return details.ID
+}
+
+// Returns a revision string for the code in the given directory, e.g. "1a2b3c4" or "1a2b3c4-dirty" if there are
+// uncommitted changes, or "local" if the directory is not a git checkout.
+func getLocalRevision(localPath string) string {
+	if !Utils.DirExists(localPath) {
+		Utils.PrintFatal("Local source directory does not exist: %s", localPath)
+	}
+	revision, dirty, err := Utils.GetGitRevision(localPath)
+	if err != nil {
+		Utils.PrintDebug("%s", err)
+		return "local"
+	}
+	if dirty {
+		return revision + "-dirty"
+	}
+	return revision
+}
 
-		file, err := ioutil.TempFile("", "maru_build_ctx_*.tar")
+// Clones the given tag of a repository on the local filesystem into a temporary directory, and returns its path.
+// If gitCommit is not empty, that commit is checked out instead of the tag.
+func cloneLocalRepo(repoPath string, gitTag string, gitCommit string) string {
+	tmpDir, err := ioutil.TempDir("", "maru_src_")
+	if err != nil {
+		Utils.PrintFatal("%s", err)
+	}
+	if gitCommit != "" {
+		Utils.PrintHint("%% git clone --no-checkout file://%s %s && git checkout %s", repoPath, tmpDir, gitCommit)
+		err = Utils.RunCommand("git", "clone", "--quiet", "--no-checkout", "file://"+repoPath, tmpDir)
+		if err == nil {
+			err = Utils.RunCommand("git", "-C", tmpDir, "-c", "advice.detachedHead=false", "checkout", "--quiet", gitCommit)
+		}
 		if err != nil {
-			log.Fatal(err)
+			os.RemoveAll(tmpDir)
+			Utils.PrintFatal("Could not check out commit %s: %s", gitCommit, err)
 		}
-		defer os.Remove(file.Name())
-		Utils.PrintDebug("Creating temporary build context at %s", file.Name())
+		return tmpDir
+	}
+	Utils.PrintHint("%% git clone --branch %s --depth 1 file://%s %s", gitTag, repoPath, tmpDir)
+	err = Utils.RunCommand("git", "clone", "--branch", gitTag, "--depth", "1", "file://"+repoPath, tmpDir)
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		Utils.PrintFatal("Command `git clone` failed with %s", err)
+	}
+	return tmpDir
+}
 
-		tar := new(archivex.TarFile)
-		tar.Create(file.Name())
-		tar.AddAll(".", true)
-		tar.Close()
-		dockerBuildContext, err := os.Open(file.Name())
-		defer dockerBuildContext.Close()
+// Prints a warning if the given build argument looks like it's being used to pass credentials
+func warnIfCredential(buildArg string) {
+	for _, name := range credentialArgNames {
+		if strings.Contains(strings.ToUpper(buildArg), name) {
+			Utils.PrintError("Build argument %s may contain credentials, which will be visible in the image history. "+
+				"Use `--secret` instead.", buildArg)
+			return
+		}
+	}
+}
 
-		options := types.ImageBuildOptions{
-			SuppressOutput: false,
-			Tags:           []string{config.Name + ":latest", versionTag},
-			Dockerfile:     "./Dockerfile",
-			BuildArgs:      buildArgs,
+// Host keys of ssh repositories are verified while cloning against the known_hosts secret. It's taken from
+// ~/.ssh/known_hosts unless it's configured, and the build fails early if it has no key for the host.
+func addKnownHostsSecret(build *Utils.ImageBuild, repoUrl string) {
+	host := Utils.GetSSHHost(repoUrl)
+	if host == "" {
+		return
+	}
+	knownHostsFile := ""
+	configured := false
+	for _, secret := range build.Secrets {
+		options := Utils.ParseSecretOptions(secret)
+		if options["id"] == Utils.KnownHostsSecretID {
+			configured = true
+			knownHostsFile = options["src"]
+			if knownHostsFile == "" {
+				knownHostsFile = options["source"]
+			}
 		}
-		r, err := cli.ImageBuild(context.Background(), dockerBuildContext, options)
+	}
+	if !configured {
+		home, err := os.UserHomeDir()
 		if err != nil {
 			Utils.PrintFatal("%s", err)
 		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+		build.Secrets = append(build.Secrets, "id="+Utils.KnownHostsSecretID+",src="+knownHostsFile)
+	}
+	// Secrets taken from environment variables can't be checked here, the build verifies them
+	if knownHostsFile == "" {
+		return
+	}
+	if err := Utils.CheckKnownHost(knownHostsFile, host); err != nil {
+		Utils.PrintHint("After checking its fingerprint, add the host key with `ssh-keyscan %s >> %s`, or pass "+
+			"another file with --secret id=%s,src=<path>", sshKeyscanHost(host), knownHostsFile, Utils.KnownHostsSecretID)
+		Utils.PrintFatal("Cannot verify the SSH host key of %s: %s", host, err)
+	}
+}
 
-		termFd, isTerm := term.GetFdInfo(os.Stderr)
-		defer r.Body.Close()
-		err2 := jsonmessage.DisplayJSONMessagesStream(r.Body, os.Stderr, termFd, isTerm, nil)
-		if err2 != nil {
-			Utils.PrintFatal("%s", err2)
+// Returns the ssh-keyscan arguments for a known_hosts host, e.g. -p 2222 git.example.org for [git.example.org]:2222
+func sshKeyscanHost(host string) string {
+	if strings.HasPrefix(host, "[") {
+		if s := strings.SplitN(strings.TrimPrefix(host, "["), "]:", 2); len(s) == 2 {
+			return "-p " + s[1] + " " + s[0]
 		}
-	*/
+	}
+	return host
 }
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	Utils "maru/utils"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var bumpPre string
+
+var bumpVerify bool
+
+var bumpCmd = &cobra.Command{
+	Use:   "bump [major|minor|patch|prerelease]",
+	Short: "Increment the version of the container",
+	Long: `Increments the project version, which must be a semantic version such as 1.2.3, and saves it in the maru.yaml.
+
+  maru bump patch               1.2.3 -> 1.2.4
+  maru bump minor               1.2.3 -> 1.3.0
+  maru bump major --pre rc      1.2.3 -> 2.0.0-rc.1
+  maru bump prerelease          2.0.0-rc.1 -> 2.0.0-rc.2
+  maru bump major               2.0.0-rc.2 -> 2.0.0
+
+If the Git tag is derived from the version (e.g. ^${version}^ or ^v${version}^), the tag which will be built is shown.
+Use --verify to check that the tag exists in the repository before saving the new version.`,
+	Args:      cobra.ExactValidArgs(1),
+	ValidArgs: []string{"major", "minor", "patch", "prerelease"},
+	Run: func(cmd *cobra.Command, args []string) {
+
+		config := Utils.ReadMandatoryProjectConfig()
+		if strings.Contains(config.Version, "$") {
+			Utils.PrintFatal("The version %s is derived from other values, so it can't be bumped", config.Version)
+		}
+
+		current, err := Utils.ParseSemver(config.Version)
+		if err != nil {
+			Utils.PrintFatal("Cannot bump version: %s", err)
+		}
+		next, err := current.Bump(args[0], bumpPre)
+		if err != nil {
+			Utils.PrintFatal("Cannot bump version: %s", err)
+		}
+
+		oldTag := config.GetRepoTag()
+		config.Version = next.String()
+		newTag := config.GetRepoTag()
+
+		if newTag != oldTag {
+			Utils.PrintInfo("Git tag to build: %s", newTag)
+			if bumpVerify {
+				repoUrl := config.TemplateArgs.Build.RepoUrl
+				if _, err := Utils.ResolveGitCommit(repoUrl, newTag); err != nil {
+					Utils.PrintFatal("Version was not changed, because the tag could not be verified: %s", err)
+				}
+				Utils.PrintSuccess("Found %s in %s", newTag, repoUrl)
+			}
+		} else if bumpVerify {
+			Utils.PrintInfo("The Git tag %s doesn't depend on the version, so there is nothing to verify", newTag)
+		}
+
+		Utils.WriteProjectConfig(config)
+		Utils.PrintSuccess("Updated version from %s to %s", current, next)
+	},
+}
+
+func init() {
+	bumpCmd.Flags().StringVar(&bumpPre, "pre", "", "Make the new version a pre-release with the given identifier, e.g. rc")
+	bumpCmd.Flags().BoolVar(&bumpVerify, "verify", false, "Check that the Git tag for the new version exists in the repository")
+	rootCmd.AddCommand(bumpCmd)
+}
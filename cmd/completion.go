@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	Utils "maru/utils"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh|fish|powershell]",
+	Short: "Generate the shell completion script",
+	Long: `Prints the completion script for the given shell. For example, to load completions in every bash session:
+
+  maru completion bash > /etc/bash_completion.d/maru
+
+Besides commands and flags, the bash and fish scripts complete the keys of the maru.yaml for ^maru get^,
+^maru set^ and ^maru unset^. The zsh and PowerShell scripts only complete commands and flags.`,
+	Args:      cobra.ExactValidArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	Run: func(cmd *cobra.Command, args []string) {
+		var err error
+		switch args[0] {
+		case "bash":
+			err = rootCmd.GenBashCompletion(os.Stdout)
+		case "zsh":
+			err = rootCmd.GenZshCompletion(os.Stdout)
+		case "fish":
+			err = rootCmd.GenFishCompletion(os.Stdout, true)
+		case "powershell":
+			err = rootCmd.GenPowerShellCompletion(os.Stdout)
+		}
+		if err != nil {
+			Utils.PrintFatal("Error generating completion script: %s", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+}
@@ -0,0 +1,289 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	Utils "maru/utils"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Extension of declarative flavor definitions, which live next to their template
+const flavorDefinitionExt = ".yaml"
+
+// Types of questions which can be asked by a declarative flavor
+var questionTypes = []string{"string", "select", "bool", "multiline", "list"}
+
+// Key of the question which sets the build command, which is stored in template_args.build instead of with the
+// other answers
+const buildCommandKey = "build_command"
+
+// flavorDefinition is a declarative flavor. It's defined by a YAML file containing the questions to ask during
+// initialization, and a template with the same name which is used to generate the Dockerfile. The answers are
+// stored in the maru.yaml under template_args.<flavor>, or under the given section. The built-in flavors are
+// defined in the same way, and their sections are part of the project configuration.
+type flavorDefinition struct {
+	name string
+
+	Description string `yaml:"description"`
+	// Shorthand for a build_command question which has no help, giving its default
+	BuildCommand *string          `yaml:"build_command"`
+	Section      string           `yaml:"section"`
+	Questions    []flavorQuestion `yaml:"questions"`
+}
+
+// flavorQuestion is one question asked by a declarative flavor
+type flavorQuestion struct {
+	Key      string   `yaml:"key"`
+	Type     string   `yaml:"type"`
+	Prompt   string   `yaml:"prompt"`
+	Help     string   `yaml:"help"`
+	Details  string   `yaml:"details"`
+	Default  string   `yaml:"default"`
+	Options  []string `yaml:"options"`
+	Required bool     `yaml:"required"`
+	Validate string   `yaml:"validate"`
+	// Message shown when the answer doesn't match the validation
+	Error string `yaml:"error"`
+	// The question is only asked if the earlier answers with these keys match the regular expressions
+	When map[string]string `yaml:"when"`
+
+	validateRegex *regexp.Regexp
+	whenRegexes   map[string]*regexp.Regexp
+}
+
+// Loads all the flavor definitions found in the template search path, keyed by flavor name. Flavors with a
+// template but no definition are not included.
+func loadFlavorDefinitions(searchFS *templateSearchFS) map[string]*flavorDefinition {
+	definitions := make(map[string]*flavorDefinition)
+	for _, name := range listFiles(searchFS, flavorDefinitionExt) {
+		if searchFS.find("/"+name+templateExt) == nil {
+			Utils.PrintError("Ignoring flavor definition %s%s, which has no template", name, flavorDefinitionExt)
+			continue
+		}
+		definitions[name] = readFlavorDefinition(searchFS, name)
+	}
+	return definitions
+}
+
+// Reads and checks the definition of the given flavor
+func readFlavorDefinition(searchFS *templateSearchFS, name string) *flavorDefinition {
+
+	path := "/" + name + flavorDefinitionExt
+	f, err := searchFS.Open(path)
+	if err != nil {
+		Utils.PrintFatal("%s", err)
+	}
+	defer f.Close()
+	raw, err := ioutil.ReadAll(f)
+	if err != nil {
+		Utils.PrintFatal("Error reading flavor definition %s: %s", name, err)
+	}
+
+	d := &flavorDefinition{name: name}
+	if err := yaml.UnmarshalStrict(raw, d); err != nil {
+		Utils.PrintFatal("Error reading flavor definition %s: %s", name, err)
+	}
+	if d.Section == "" {
+		d.Section = name
+	}
+	if strings.Contains(d.Section, ".") || d.Section == "flavor" || d.Section == "build" {
+		Utils.PrintFatal("Flavor definition %s: invalid section %s", name, d.Section)
+	}
+	if d.BuildCommand != nil && d.question(buildCommandKey) == nil {
+		d.Questions = append([]flavorQuestion{{Key: buildCommandKey, Default: *d.BuildCommand}}, d.Questions...)
+	}
+
+	keys := make(map[string]bool)
+	for i := range d.Questions {
+		q := &d.Questions[i]
+		if q.Key == "" {
+			Utils.PrintFatal("Flavor definition %s: question %d has no key", name, i+1)
+		}
+		if keys[q.Key] {
+			Utils.PrintFatal("Flavor definition %s: duplicate question key %s", name, q.Key)
+		}
+		if q.Type == "" {
+			q.Type = "string"
+		}
+		if indexOf(q.Type, questionTypes) < 0 {
+			Utils.PrintFatal("Flavor definition %s: question %s has invalid type %s", name, q.Key, q.Type)
+		}
+		if q.Type == "select" && len(q.Options) == 0 {
+			Utils.PrintFatal("Flavor definition %s: question %s has no options", name, q.Key)
+		}
+		if q.Prompt == "" {
+			if q.Key == buildCommandKey {
+				q.Prompt = "Build command:"
+			} else {
+				q.Prompt = q.Key + ":"
+			}
+		}
+		if q.Validate != "" {
+			q.validateRegex, err = regexp.Compile(q.Validate)
+			if err != nil {
+				Utils.PrintFatal("Flavor definition %s: question %s has invalid validation: %s", name, q.Key, err)
+			}
+		}
+		q.whenRegexes = make(map[string]*regexp.Regexp)
+		for key, pattern := range q.When {
+			if !keys[key] {
+				Utils.PrintFatal("Flavor definition %s: question %s depends on %s, which isn't asked before it",
+					name, q.Key, key)
+			}
+			q.whenRegexes[key], err = regexp.Compile(pattern)
+			if err != nil {
+				Utils.PrintFatal("Flavor definition %s: question %s has invalid condition for %s: %s", name, q.Key, key, err)
+			}
+		}
+		keys[q.Key] = true
+	}
+
+	return d
+}
+
+// Returns the question with the given key, or nil if the flavor doesn't ask it
+func (d *flavorDefinition) question(key string) *flavorQuestion {
+	for i := range d.Questions {
+		if d.Questions[i].Key == key {
+			return &d.Questions[i]
+		}
+	}
+	return nil
+}
+
+// Returns the path of the answer to the question in the project configuration
+func (d *flavorDefinition) answerPath(q *flavorQuestion) string {
+	if q.Key == buildCommandKey {
+		return "template_args.build.command"
+	}
+	return "template_args." + d.Section + "." + q.Key
+}
+
+// Returns the stored answer to the question as a string, with the items of a list on separate lines, and whether
+// there is one
+func (d *flavorDefinition) getAnswer(config *Utils.MaruConfig, q *flavorQuestion) (string, bool) {
+	v, ok := Utils.GetConfigValue(config, d.answerPath(q))
+	if !ok {
+		return "", false
+	}
+	if v.Kind() == reflect.Slice {
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = v.Index(i).String()
+		}
+		return strings.Join(items, "\n"), true
+	}
+	if q.Type == "list" {
+		return strings.Join(strings.Fields(v.String()), "\n"), true
+	}
+	return v.String(), true
+}
+
+// Stores the answer to the question. A list is stored as a YAML list if the setting is one, or else as a single
+// string with the items separated by spaces.
+func (d *flavorDefinition) setAnswer(config *Utils.MaruConfig, q *flavorQuestion, value string) {
+	path := d.answerPath(q)
+	values := []string{value}
+	if q.Type == "list" {
+		values = strings.Fields(value)
+		if !Utils.IsConfigList(path) {
+			values = []string{strings.Join(values, " ")}
+		}
+	}
+	if err := Utils.SetConfigValue(config, path, values); err != nil {
+		Utils.PrintFatal("Cannot store %s: %s", path, err)
+	}
+}
+
+// Returns true if the question applies, given the answers to the questions it depends on
+func (d *flavorDefinition) isAsked(config *Utils.MaruConfig, q *flavorQuestion) bool {
+	for key, regex := range q.whenRegexes {
+		value, _ := d.getAnswer(config, d.question(key))
+		if !regex.MatchString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the error for an invalid answer to the question, or nil if it's valid
+func (q *flavorQuestion) check(value string, definitionName string) error {
+	switch {
+	case q.Required && value == "":
+		return fmt.Errorf("a value is required")
+	case q.Type == "select" && value != "" && indexOf(value, q.Options) < 0:
+		return fmt.Errorf("must be one of: %s", strings.Join(q.Options, ", "))
+	case q.Type == "bool" && value != "" && !isBool(value):
+		return fmt.Errorf("must be true or false")
+	case q.validateRegex != nil && !q.validateRegex.MatchString(value):
+		if q.Error != "" {
+			return fmt.Errorf("%s", q.Error)
+		}
+		// The pattern isn't shown, because carets would be interpreted as highlighting
+		return fmt.Errorf("see the validation in %s%s", definitionName, flavorDefinitionExt)
+	}
+	return nil
+}
+
+// Runs the questionnaire for the flavor and stores the answers in the project configuration. The defaults are
+// used if the project didn't have this flavor before, and for any answers which are missing, or empty but required.
+// Answers to questions which don't apply are removed.
+func (d *flavorDefinition) initProject(config *Utils.MaruConfig, isNewFlavor bool) {
+
+	for i := range d.Questions {
+		q := &d.Questions[i]
+		if !d.isAsked(config, q) {
+			if err := Utils.UnsetConfigValue(config, d.answerPath(q)); err != nil {
+				Utils.PrintFatal("Cannot remove %s: %s", d.answerPath(q), err)
+			}
+			continue
+		}
+
+		value, ok := d.getAnswer(config, q)
+		if isNewFlavor || !ok || (value == "" && q.Required) {
+			value = q.Default
+		}
+		if q.Help != "" {
+			Utils.PrintInfo("\n%s", q.Help)
+		}
+		if q.Details != "" {
+			Utils.PrintMessage("%s", q.Details)
+		}
+		for {
+			value = q.ask(value)
+			err := q.check(value, d.name)
+			if err == nil {
+				break
+			}
+			if _, given := initAnswers[q.Key]; given || Utils.AssumeYes {
+				Utils.PrintFatal("Invalid value for %s: %s (%s)", q.Key, value, err)
+			}
+			Utils.PrintError("Invalid value: %s", err)
+		}
+		d.setAnswer(config, q, value)
+	}
+}
+
+// Asks the question using the prompt that matches its type, and returns the answer as a string
+func (q *flavorQuestion) ask(value string) string {
+	switch q.Type {
+	case "select":
+		// There's no need to ask if there's only one option
+		if _, given := initAnswers[q.Key]; len(q.Options) == 1 && !given {
+			Utils.PrintMessage("%s ^%s^", q.Prompt, q.Options[0])
+			return q.Options[0]
+		}
+		return askSelect(q.Key, q.Prompt, q.Options, value)
+	case "bool":
+		defaultValue, _ := strconv.ParseBool(value)
+		return strconv.FormatBool(askBool(q.Key, q.Prompt, defaultValue))
+	case "multiline", "list":
+		return askMultiline(q.Key, q.Prompt, value)
+	}
+	return askString(q.Key, q.Prompt, value)
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	Utils "maru/utils"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Checks that each built-in flavor definition can be read, and that its answers are stored in settings of the
+// project configuration
+func TestBuiltinFlavorDefinitions(t *testing.T) {
+
+	paths, err := filepath.Glob(filepath.Join("..", "templates", "*"+flavorDefinitionExt))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no flavor definitions found in templates: %v", err)
+	}
+	searchFS := &templateSearchFS{sources: []templateSource{
+		{name: "built-in", dir: "templates", fs: http.Dir(filepath.Join("..", "templates"))},
+	}}
+	sections := Utils.ConfigFields(reflect.TypeOf(Utils.MaruConfig{}.TemplateArgs))
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), flavorDefinitionExt)
+		t.Run(name, func(t *testing.T) {
+			var d *flavorDefinition
+			if !Utils.CatchFatal(func() bool {
+				d = readFlavorDefinition(searchFS, name)
+				return true
+			}) {
+				t.Fatalf("readFlavorDefinition() failed")
+			}
+			if _, ok := sections[d.Section]; !ok {
+				t.Errorf("section %s is not a field of template_args", d.Section)
+			}
+			keys := make(map[string]bool)
+			for i := range d.Questions {
+				q := &d.Questions[i]
+				if keys[q.Key] {
+					t.Errorf("question %s is asked twice", q.Key)
+				}
+				keys[q.Key] = true
+				if err := Utils.CheckConfigKey(d.answerPath(q)); err != nil {
+					t.Errorf("question %s is stored in %s: %s", q.Key, d.answerPath(q), err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	Utils "maru/utils"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var generateDiff bool
+
+var generateDryRun bool
+
+// Labels of the two sides of a conflict when merging hand edits into the regenerated Dockerfile
+const (
+	editedLabel    = "Dockerfile (edited)"
+	generatedLabel = "Dockerfile (generated)"
+)
+
+// Write the Dockerfile even when hand edits conflict with the regenerated Dockerfile
+var forceMerge bool
+
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Regenerate the Dockerfile from the current project configuration",
+	Long: `Renders the Dockerfile using the values already stored in the maru.yaml, without running the initialization 
+questionnaire again. This is useful after editing the maru.yaml by hand. Use --diff to preview the changes to the 
+existing Dockerfile, or --dry-run to print the Dockerfile that would be written, without writing anything.
+
+If the Dockerfile was edited by hand since it was last generated, the edits are merged into the new Dockerfile. When
+they conflict with the changes made by the template, nothing is written unless --force is given, in which case the
+Dockerfile contains conflict markers which must be resolved before building.
+`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		config := Utils.ReadMandatoryProjectConfig()
+		if config.TemplateArgs.Flavor == "" {
+			Utils.PrintFatal("Project %s uses a custom Dockerfile, which is not generated by Maru", config.Name)
+		}
+
+		dockerfile := renderDockerfile(config)
+
+		if generateDiff {
+			merged, _, _ := mergeDockerfile(dockerfile)
+			diff := diffDockerfile(merged)
+			if diff == "" {
+				Utils.PrintSuccess("Dockerfile is up to date")
+			} else {
+				Utils.PrintDiff(diff)
+			}
+		} else if generateDryRun {
+			// Print what would be written, which includes any edits made by hand
+			merged, _, conflicts := mergeDockerfile(dockerfile)
+			if conflicts && !forceMerge {
+				Utils.PrintFatal("The changes made to the Dockerfile by hand conflict with the regenerated Dockerfile, " +
+					"so it would not be changed. Use --diff to see the conflicts, or add --force to print it with conflict markers.")
+			}
+			fmt.Print(merged)
+		} else {
+			updateDockerfile(config, dockerfile)
+		}
+	},
+}
+
+func init() {
+	generateCmd.Flags().BoolVar(&generateDiff, "diff", false, "Show the changes to the existing Dockerfile without writing it")
+	generateCmd.Flags().BoolVar(&generateDryRun, "dry-run", false, "Print the Dockerfile that would be written, including any edits made by hand, without writing it")
+	generateCmd.Flags().BoolVar(&forceMerge, "force", false, "Write the Dockerfile with conflict markers if hand edits conflict")
+	rootCmd.AddCommand(generateCmd)
+}
+
+// Renders the Dockerfile for the given project configuration, using the template for its flavor
+func renderDockerfile(config *Utils.MaruConfig) string {
+
+	// The Dockerfile is always generated by the running version of Maru
+	c := *config
+	c.MaruVersion = Utils.MaruVersion
+
+	var sb strings.Builder
+	tmpls := parseFlavorTemplate(c.TemplateArgs.Flavor)
+	if err := tmpls.ExecuteTemplate(&sb, c.TemplateArgs.Flavor+templateExt, &c); err != nil {
+		Utils.PrintFatal("Failed to create Dockerfile: %s", err)
+	}
+	return sb.String()
+}
+
+// Reads the existing Dockerfile, or returns an empty string if there isn't one
+func readDockerfile() string {
+	if !Utils.FileExists(Utils.DockerFilePath) {
+		return ""
+	}
+	raw, err := ioutil.ReadFile(Utils.DockerFilePath)
+	if err != nil {
+		Utils.PrintFatal("Error reading Dockerfile: %s", err)
+	}
+	return string(raw)
+}
+
+// Returns the differences between the existing Dockerfile and the given content, or an empty string if they're identical
+func diffDockerfile(dockerfile string) string {
+	return Utils.UnifiedDiff(readDockerfile(), dockerfile, "a/"+Utils.DockerFilePath, "b/"+Utils.DockerFilePath, 3)
+}
+
+// Writes the given content to the Dockerfile, and records how it was generated in the state file
+func writeDockerfile(config *Utils.MaruConfig, dockerfile string) {
+	if err := ioutil.WriteFile(Utils.DockerFilePath, []byte(dockerfile), 0644); err != nil {
+		Utils.PrintFatal("Failed to create Dockerfile: %s", err)
+	}
+	writeGeneratedState(config, dockerfile)
+	Utils.PrintSuccess("Created Dockerfile")
+}
+
+// Merges the changes made to the Dockerfile by hand since it was last generated into the newly generated content.
+// Returns the content to write, whether there were edits to merge, and whether they conflict.
+func mergeDockerfile(dockerfile string) (string, bool, bool) {
+	base, ok := Utils.ReadMergeBase()
+	existing := readDockerfile()
+	if !ok || !Utils.FileExists(Utils.DockerFilePath) || existing == base {
+		return dockerfile, false, false
+	}
+	merged, conflicts := Utils.Merge3(base, existing, dockerfile, editedLabel, generatedLabel)
+	return merged, true, conflicts
+}
+
+// Replaces the Dockerfile with the newly generated content, merging any changes made by hand since it was last
+// generated. If they conflict, the Dockerfile is left untouched unless --force was given. Returns true if the
+// Dockerfile was written with conflict markers.
+func updateDockerfile(config *Utils.MaruConfig, dockerfile string) bool {
+
+	merged, edited, conflicts := mergeDockerfile(dockerfile)
+	if !edited {
+		writeDockerfile(config, dockerfile)
+		return false
+	}
+
+	if conflicts && !forceMerge {
+		Utils.PrintError("The changes made to the Dockerfile by hand conflict with the regenerated Dockerfile:")
+		Utils.PrintDiff(diffDockerfile(merged))
+		Utils.PrintFatal("The Dockerfile was not changed. Edit it to avoid the conflicts, or use --force to write it with conflict markers.")
+	}
+
+	if err := ioutil.WriteFile(Utils.DockerFilePath, []byte(merged), 0644); err != nil {
+		Utils.PrintFatal("Failed to create Dockerfile: %s", err)
+	}
+	// The state records the generated content, so the merged edits are still detected as hand edits
+	writeGeneratedState(config, dockerfile)
+
+	if conflicts {
+		Utils.PrintError("The Dockerfile contains conflict markers, which must be resolved before building")
+	} else {
+		Utils.PrintSuccess("Regenerated Dockerfile, keeping the changes made by hand")
+	}
+	return conflicts
+}
+
+// Records the inputs and output of the Dockerfile generation in the state file
+func writeGeneratedState(config *Utils.MaruConfig, dockerfile string) {
+	templateHash, templateSource := getTemplateHash(config.TemplateArgs.Flavor)
+	Utils.WriteGeneratedState(&Utils.GeneratedState{
+		Template:       config.TemplateArgs.Flavor,
+		TemplateSource: templateSource,
+		TemplateHash:   templateHash,
+		MaruVersion:    Utils.MaruVersion,
+		InputChecksum:  config.GetInputChecksum(templateHash),
+		OutputHash:     Utils.HashString(dockerfile),
+	})
+	Utils.WriteMergeBase(dockerfile)
+}
+
+// dockerfileStatus describes what changed since the Dockerfile was last generated
+type dockerfileStatus struct {
+	missing          bool
+	configChanged    bool
+	templateUpgraded bool
+	handEdited       bool
+}
+
+// Compares the current project configuration, templates and Dockerfile against the state of the last generation
+func getDockerfileStatus(config *Utils.MaruConfig) dockerfileStatus {
+
+	status := dockerfileStatus{}
+	if !Utils.FileExists(Utils.DockerFilePath) {
+		status.missing = true
+		return status
+	}
+
+	raw, err := ioutil.ReadFile(Utils.DockerFilePath)
+	if err != nil {
+		Utils.PrintFatal("Error reading Dockerfile: %s", err)
+	}
+	templateHash, _ := getTemplateHash(config.TemplateArgs.Flavor)
+
+	state := Utils.ReadGeneratedState()
+	if state == nil {
+		// Older versions of Maru only recorded the configuration checksum on the first line of the Dockerfile,
+		// so any other difference is attributed to the template
+		status.configChanged = Utils.GetChecksumFromDockerfile() != config.GetTemplateArgsChecksum()
+		status.templateUpgraded = !status.configChanged && renderDockerfile(config) != string(raw)
+		return status
+	}
+
+	// The input checksum covers the templates too, so the configuration is checked against the recorded template
+	// hash, which keeps an upgraded template from also being reported as a changed configuration
+	status.configChanged = state.Template != config.TemplateArgs.Flavor ||
+		state.InputChecksum != config.GetInputChecksum(state.TemplateHash)
+	status.templateUpgraded = state.TemplateHash != templateHash
+	status.handEdited = state.OutputHash != Utils.HashString(string(raw))
+	return status
+}
+
+// Returns a short description of the status, e.g. "configuration changed, edited by hand"
+func (s dockerfileStatus) String() string {
+	var reasons []string
+	if s.missing {
+		reasons = append(reasons, "missing")
+	}
+	if s.configChanged {
+		reasons = append(reasons, "configuration changed")
+	}
+	if s.templateUpgraded {
+		reasons = append(reasons, "template upgraded")
+	}
+	if s.handEdited {
+		reasons = append(reasons, "edited by hand")
+	}
+	if len(reasons) == 0 {
+		return "up to date"
+	}
+	return strings.Join(reasons, ", ")
+}
+
+// Checks whether the Dockerfile needs to be regenerated before a build, and offers to do it
+func checkDockerfile(config *Utils.MaruConfig) {
+
+	status := getDockerfileStatus(config)
+	Utils.PrintDebug("Dockerfile status: %s", status)
+
+	if status.missing {
+		Utils.PrintInfo("The Dockerfile is missing and will be generated")
+		writeDockerfile(config, renderDockerfile(config))
+		return
+	}
+
+	if status.configChanged || status.templateUpgraded {
+		dockerfile := renderDockerfile(config)
+		merged, edited, conflicts := mergeDockerfile(dockerfile)
+		diff := diffDockerfile(merged)
+		if diff == "" {
+			// Nothing changed in the output, so there is no need to ask
+			writeGeneratedState(config, dockerfile)
+			return
+		}
+		Utils.PrintInfo("The Dockerfile is out of date (%s). Regenerating it would make these changes:", status)
+		Utils.PrintDiff(diff)
+		if status.handEdited && !edited {
+			Utils.PrintError("Regenerating the Dockerfile will discard the changes made by hand.")
+		} else if conflicts {
+			Utils.PrintError("The changes made to the Dockerfile by hand conflict with the regenerated Dockerfile.")
+			Utils.PrintInfo("The existing Dockerfile will be used. Run `maru generate --force` to write it with conflict markers.")
+			return
+		}
+		if Utils.AskForBool("Do you want to regenerate the Dockerfile?", !status.handEdited || edited) {
+			updateDockerfile(config, dockerfile)
+		}
+		return
+	}
+
+	if status.handEdited && strings.Contains(readDockerfile(), "<<<<<<< "+editedLabel) {
+		Utils.PrintFatal("The Dockerfile contains conflict markers, which must be resolved before building")
+	}
+	if status.handEdited {
+		Utils.PrintInfo("The Dockerfile has been edited by hand and will be used as is.")
+	}
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	Utils "maru/utils"
+	"reflect"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var getCmd = &cobra.Command{
+	Use:   "get [key]",
+	Short: "Print the value of a variable in the Maru configuration",
+	Long: `Prints the value of the setting with the given dotted path in the maru.yaml, e.g. ^maru get name^ or
+^maru get build_args.GIT_TAG^. Lists are printed one item per line, and sections are printed as YAML.
+Exits with an error if the setting has no value.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeConfigKeys,
+	Run: func(cmd *cobra.Command, args []string) {
+		key := resolveConfigKey(args[0])
+		config := Utils.ReadMandatoryProjectConfig()
+		v, ok := Utils.GetConfigValue(config, key)
+		if !ok {
+			Utils.PrintFatal("%s is not set", args[0])
+		}
+		switch v.Kind() {
+		case reflect.Slice:
+			for i := 0; i < v.Len(); i++ {
+				fmt.Println(v.Index(i).Interface())
+			}
+		case reflect.Map, reflect.Struct, reflect.Ptr:
+			raw, err := yaml.Marshal(v.Interface())
+			if err != nil {
+				Utils.PrintFatal("%s", err)
+			}
+			fmt.Print(string(raw))
+		default:
+			fmt.Println(v.Interface())
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(getCmd)
+}
@@ -1,23 +1,60 @@
 package cmd
 
 import (
-	"context"
-	"github.com/AlecAivazis/survey/v2"
-	"github.com/posener/gitfs"
-	"github.com/posener/gitfs/fsutil"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
 	Utils "maru/utils"
-	"net/url"
 	"os"
 	"path"
-	"regexp"
 	"sort"
+	"strconv"
+	"strings"
 )
 
-// When running with `LOCAL_DEBUG=.`, the local repository will be used instead of the remote github.
-var localDebug = os.Getenv("LOCAL_DEBUG")
-
-type initFunctionType func (*Utils.MaruConfig, bool)
+// Path to a YAML file containing answers to the initialization questions, set by the --answers flag
+var answersFile string
+
+// Answers to the initialization questions, keyed by the same names used in the maru.yaml
+var initAnswers = make(map[string]string)
+
+// Flags which can be used to answer the initialization questions on the command line, keyed by answer name
+var answerFlags = map[string]*string{}
+
+// Answers given as key=value pairs, for questions which have no dedicated flag, such as those of declarative flavors
+var answerPairs []string
+
+// Answer names and descriptions for all the questions which can be answered non-interactively
+var answerUsage = []struct {
+	key   string
+	usage string
+}{
+	{"flavor", "Flavor of container to build"},
+	{"repo_url", "Git URL of the code repository to build"},
+	{"git_tag", "Tag or branch to build"},
+	{"name", "Container name"},
+	{"version", "Container version"},
+	{"build_command", "Command to build the code"},
+	{"exe_path", "Relative path to built executable (executable)"},
+	{"environment_file", "Relative path to environment.yml, requirements.txt or pyproject.toml (python_conda)"},
+	{"python_version", "Python version, e.g. 3.8 (python_conda)"},
+	{"channels", "Extra Conda channels, separated by spaces (python_conda)"},
+	{"dependencies", "Dependencies to install with Conda (python_conda)"},
+	{"pip_packages", "Packages to install with pip, separated by spaces (python_conda)"},
+	{"script_path", "Relative path to main script (python_conda, r_renv)"},
+	{"jdk_version", "JDK version (java_maven)"},
+	{"main_class", "Main class (java_maven, javafx_maven)"},
+	{"plugin_dir", "Relative path to Fiji plugins (fiji_macro)"},
+	{"macro_dir", "Relative path to Fiji macros (fiji_macro)"},
+	{"macro_name", "Name of the Fiji macro file to run (fiji_macro)"},
+	{"r_version", "R version (r_renv)"},
+	{"lockfile_path", "Relative path to renv.lock, or empty to use a package list (r_renv)"},
+	{"packages", "R packages to install when there is no lockfile, e.g. dplyr@1.0.2 bioc::limma (r_renv)"},
+	{"runtime_release", "MATLAB Runtime release, e.g. R2020b (matlab_compiled)"},
+	{"runtime_update", "MATLAB Runtime update number (matlab_compiled)"},
+	{"compiled_dir", "Relative path to the mcc output directory (matlab_compiled)"},
+	{"main_function", "Name of the compiled main function (matlab_compiled)"},
+}
 
 var initCmd = &cobra.Command{
 	Use:   "init",
@@ -26,29 +63,79 @@ var initCmd = &cobra.Command{
 in the current directory, it can either be used to bootstrap a custom project or overwritten. If a maru.yaml file
 exists in the current directory, the initialization questionnaire will run again using the default values from the 
 maru.yaml file. 
+
+Any question can be answered in advance with a flag (e.g. ^--flavor python_conda^) or with an answers file 
+(^--answers answers.yaml^) containing the same keys, e.g. ^repo_url: https://github.com/example/repo.git^. 
+Combined with ^--yes^, which takes the default value for any question left unanswered, this allows a project
+to be initialized without any user interaction.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
+		loadInitAnswers(cmd)
 		config := Init()
 		printFinalInstructions(config)
 	},
 }
 
 func init() {
+	initCmd.Flags().BoolVar(&forceMerge, "force", false, "Write the Dockerfile with conflict markers if hand edits conflict")
+	initCmd.Flags().StringVar(&answersFile, "answers", "", "YAML file containing answers to the initialization questions")
+	initCmd.Flags().StringArrayVar(&answerPairs, "answer", nil, "Answer to any initialization question, e.g. plugin_name=my-plugin")
+	for _, a := range answerUsage {
+		answerFlags[a.key] = initCmd.Flags().String(strings.ReplaceAll(a.key, "_", "-"), "", a.usage)
+	}
 	rootCmd.AddCommand(initCmd)
 }
 
+// Collect the answers provided by the answers file and the command line flags. Flags take precedence.
+func loadInitAnswers(cmd *cobra.Command) {
+
+	if answersFile != "" {
+		raw, err := ioutil.ReadFile(answersFile)
+		if err != nil {
+			Utils.PrintFatal("Error reading answers file: %s", err)
+		}
+		err = yaml.Unmarshal(raw, &initAnswers)
+		if err != nil {
+			Utils.PrintFatal("Error reading answers file: %s", err)
+		}
+	}
+
+	for _, pair := range answerPairs {
+		s := strings.SplitN(pair, "=", 2)
+		if len(s) != 2 {
+			Utils.PrintFatal("Answers must be given as key=value: %s", pair)
+		}
+		initAnswers[s[0]] = s[1]
+	}
+
+	for key, value := range answerFlags {
+		if cmd.Flags().Changed(strings.ReplaceAll(key, "_", "-")) {
+			initAnswers[key] = *value
+		}
+	}
+
+	// Catch any typos, taking into account the questions asked by declarative flavors
+	knownKeys := make(map[string]bool)
+	for key := range answerFlags {
+		knownKeys[key] = true
+	}
+	for _, definition := range loadFlavorDefinitions(newTemplateSearchFS()) {
+		for _, q := range definition.Questions {
+			knownKeys[q.Key] = true
+		}
+	}
+	for key := range initAnswers {
+		if !knownKeys[key] {
+			Utils.PrintFatal("Unknown answer: %s", key)
+		}
+	}
+}
+
 func Init() *Utils.MaruConfig {
 
 	Utils.PrintInfo("Configure Maru Project")
 
-	flavorMap := map[string]initFunctionType {
-		"executable":      initProjectExecutable,
-		"python_conda":    initProjectPython,
-		"java_maven":      initProjectJavaMaven,
-		"javafx_maven":    initProjectJavaFxMaven,
-		"fiji_macro":      initProjectFiji,
-		"matlab_compiled": initProjectMatlab,
-	}
+	flavorMap := loadFlavorDefinitions(newTemplateSearchFS())
 
 	var isNewProject = false
 
@@ -62,7 +149,7 @@ func Init() *Utils.MaruConfig {
 		isNewProject = true
 		config = Utils.NewMaruConfig("", "1.0.0")
 		config.TemplateArgs.Build.RepoUrl = "https://github.com/example/repo.git"
-		config.SetBuildArg("GIT_TAG", "$version")
+		config.SetBuildArg("GIT_TAG", "${version}")
 		config.TemplateArgs.Build.Command = ""
 
 	} else {
@@ -82,71 +169,61 @@ func Init() *Utils.MaruConfig {
 	}
 	sort.Strings(flavors)
 
-	flavor := config.TemplateArgs.Flavor
+	previousFlavor := config.TemplateArgs.Flavor
+	flavor := previousFlavor
 	if flavor == "" {
 		flavor = flavors[0]
 	}
-	prompt := &survey.Select{
-		Message: "Flavor of container to build:",
-		Options: flavors,
-		Default: flavor,
-	}
-	Utils.Ask(prompt, &flavor)
+	flavor = askSelect("flavor", "Flavor of container to build:", flavors, flavor)
 	config.TemplateArgs.Flavor = flavor
 
 	// Validate flavor before going further
-	initFunction := flavorMap[flavor]
-	if initFunction==nil {
+	definition := flavorMap[flavor]
+	if definition == nil {
 		Utils.PrintFatal("Flavor is currently not supported: %s", flavor)
 		os.Exit(1)
 	}
 
 	Utils.PrintInfo("\nWhich code repository should be built when ^maru build^ is called?")
-	config.TemplateArgs.Build.RepoUrl = Utils.AskForString("Git URL:", config.TemplateArgs.Build.RepoUrl)
+	Utils.PrintMessage(`This can be an ^https^, ^ssh^ or ^file^ URL. You can also build from a local directory at any time 
+using ^maru build --local^.
+`)
+	config.TemplateArgs.Build.RepoUrl = askString("repo_url", "Git URL:", config.TemplateArgs.Build.RepoUrl)
 
 	Utils.PrintInfo("\nWhich tag or branch should be built when ^maru build^ is called?")
 	Utils.PrintMessage(
 		`You can use ^master^ here to build the master branch, but that's not recommended for creating reproducible containers.
 The best practice is to tag your code with a version number, and use that as the container tag. 
-You can use ^$version^ here to simplify that workflow.
+You can use ^${version}^ here to simplify that workflow.
 `)
-	config.SetBuildArg("GIT_TAG", Utils.AskForString("Git tag:", config.BuildArgs["GIT_TAG"]))
+	config.SetBuildArg("GIT_TAG", askString("git_tag", "Git tag:", config.BuildArgs["GIT_TAG"]))
 
-	u, err := url.Parse(config.TemplateArgs.Build.RepoUrl)
-	if err != nil {
-		Utils.PrintFatal("Problem parsing Git URL: %s",err)
+	if err := Utils.ValidateRepoUrl(config.TemplateArgs.Build.RepoUrl); err != nil {
+		Utils.PrintFatal("Invalid Git URL: %s", err)
 	}
 
-	if u.Scheme != "https" {
-		Utils.PrintFatal("URL must begin with https")
-	}
-
-	if u.Host == "" {
-		Utils.PrintFatal("URL must contain valid hostname")
-	}
-
-	// Default container name is the name of the current working directory
 	if config.Name == "" {
-		cwd, err := os.Getwd()
-		if err != nil {
-			Utils.PrintFatal("%s", err)
-		}
-		cwdName := path.Base(cwd)
-		config.Name = cwdName
+		config.Name = getDefaultContainerName()
 	}
 
 	Utils.PrintInfo("\nWhat is the name for this container?")
-	Utils.PrintMessage(`The container name should only contain lowercase letters, numbers, dashes, and underscores.
+	Utils.PrintMessage(`The container name should only contain lowercase letters, numbers, dashes, dots and underscores.
 `)
-	config.Name = Utils.AskForString("Container name:", config.Name)
+	config.Name = askString("name", "Container name:", config.Name)
+	if err := Utils.ValidateName(config.Name); err != nil {
+		Utils.PrintFatal("Invalid container name: %s", err)
+	}
 
 	Utils.PrintInfo("\nWhat is the current version for this container?")
 	Utils.PrintMessage(`This will change over time, and can easily be updated with ^maru set version^.
-If you used ^$version^ as you Git tag above, then this will also be the tag that is cloned from your git repository.`)
-	config.Version = Utils.AskForString("Container version:", config.Version)
+If you used ^${version}^ as you Git tag above, then this will also be the tag that is cloned from your git repository.`)
+	config.Version = askString("version", "Container version:", config.Version)
+	if err := Utils.ValidateVersion(config.Version); err != nil {
+		Utils.PrintFatal("Invalid container version: %s", err)
+	}
 
-	// Invoke the init function for the chosen project flavor
-	initFunction(config, isNewProject)
+	// Ask the questions of the chosen project flavor
+	definition.initProject(config, isNewProject || flavor != previousFlavor)
 
 	Utils.WriteProjectConfig(config)
 	Utils.PrintSuccess("Created %s", Utils.ConfFile)
@@ -156,9 +233,19 @@ If you used ^$version^ as you Git tag above, then this will also be the tag that
 }
 
 func checkIfUserWantsToUseDockerfile() {
+	if _, ok := initAnswers["flavor"]; ok {
+		// A flavor was chosen in advance, so the existing Dockerfile will be replaced
+		return
+	}
 	if Utils.AskForBool("Create new Maru project using existing Dockerfile?", true) {
-		containerName := Utils.AskForString("Container name:", "")
-		containerVersion := Utils.AskForString("Container version:", "1.0.0")
+		containerName := askString("name", "Container name:", getDefaultContainerName())
+		if err := Utils.ValidateName(containerName); err != nil {
+			Utils.PrintFatal("Invalid container name: %s", err)
+		}
+		containerVersion := askString("version", "Container version:", "1.0.0")
+		if err := Utils.ValidateVersion(containerVersion); err != nil {
+			Utils.PrintFatal("Invalid container version: %s", err)
+		}
 		config := Utils.NewMaruConfig(containerName, containerVersion)
 		Utils.WriteProjectConfig(config)
 		printFinalInstructions(config)
@@ -166,148 +253,68 @@ func checkIfUserWantsToUseDockerfile() {
 	}
 }
 
-func initProjectExecutable(config *Utils.MaruConfig, isNewProject bool) {
-
-	pc := &config.TemplateArgs.Executable
-
-	if isNewProject {
-		// Default values
-		config.TemplateArgs.Build.Command = "make"
-		pc.RelativeExePath = "bin/program"
-	}
-
-	config.TemplateArgs.Build.Command = Utils.AskForString("Build command:", config.TemplateArgs.Build.Command)
-	pc.RelativeExePath = Utils.AskForString("Relative path to built executable:", pc.RelativeExePath)
-}
-
-func initProjectFiji(config *Utils.MaruConfig, isNewProject bool) {
-
-	pc := &config.TemplateArgs.FijiMacro
-
-	if isNewProject {
-		// Default values
-		pc.MacroDir = "fiji_plugins"
-		pc.MacroDir = "fiji_macros"
-		pc.MacroName = "macro.ijm"
-	}
-
-	pc.PluginDir = Utils.AskForString("Relative path to Fiji plugins:", pc.PluginDir)
-	pc.MacroDir = Utils.AskForString("Relative path to Fiji macros:", pc.MacroDir)
-	pc.MacroName = Utils.AskForString("Name of the Fiji macro file to run:", pc.MacroName)
-}
-
-func initProjectPython(config *Utils.MaruConfig, isNewProject bool) {
-
-	pc := &config.TemplateArgs.PythonConda
-
-	if isNewProject {
-		// Default values
-		pc.PythonVersion = "3.6"
-		pc.Dependencies = ""
-		pc.RelativeScriptPath = "main.py"
-	}
-
-	prompt := &survey.Select{
-		Message: "Python version:",
-		Options: []string{"2.7", "3.6", "3.7"},
-		Default: pc.PythonVersion,
-	}
-	Utils.Ask(prompt, &pc.PythonVersion)
-
-	dependenciesText := pc.Dependencies
-	mlPrompt := &survey.Multiline{
-		Message: "Dependencies to install with Conda (e.g. h5py=2.8.0)",
-		Default: dependenciesText,
-	}
-	Utils.Ask(mlPrompt, &dependenciesText)
-	pc.Dependencies = regexp.MustCompile(`\s+`).ReplaceAllString(dependenciesText, " ")
-
-	pc.RelativeScriptPath = Utils.AskForString("Relative path to main script:", pc.RelativeScriptPath)
-}
-
-func initProjectJavaMaven(config *Utils.MaruConfig, isNewProject bool) {
-
-	pc := &config.TemplateArgs.JavaMaven
-
-	if isNewProject {
-		// Default values
-		config.TemplateArgs.Build.Command = "mvn package"
-		pc.MainClass = "org.myapp.MyClass"
-		pc.JDKVersion = "8"
-	}
-
-	Utils.PrintInfo("\nWhich version of the JDK should be used to build and run your code?")
-	Utils.PrintMessage(`This will use Azul's Zulu JDK distribution of OpenJDK.
-`)
-	prompt := &survey.Select{
-		Message: "JDK version:",
-		Options: []string{"6", "7", "8", "11", "13", "14"},
-		Default: pc.JDKVersion,
-	}
-	Utils.Ask(prompt, &pc.JDKVersion)
-
-	Utils.PrintInfo("\nWhich command should be run to build your code?")
-	Utils.PrintMessage(`This is typically a mvn build command, but you can chain other build steps using ^&&^.
-`)
-	config.TemplateArgs.Build.Command = Utils.AskForString("Build command:", config.TemplateArgs.Build.Command)
-	pc.MainClass = Utils.AskForString("Main class:", pc.MainClass)
-}
-
-func initProjectJavaFxMaven(config *Utils.MaruConfig, isNewProject bool) {
-
-	pc := &config.TemplateArgs.JavaMaven
-
-	if isNewProject {
-		// Default values
-		config.TemplateArgs.Build.Command = "mvn package"
-		pc.MainClass = "org.myapp.MyClass"
-		pc.JDKVersion = "8"
+// Returns the default container name, which is the name of the current working directory
+func getDefaultContainerName() string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		Utils.PrintFatal("%s", err)
 	}
-
-	Utils.PrintInfo("\nWhich command should be run to build your code?")
-	Utils.PrintMessage(`This is typically a mvn build command, but you can chain other build steps using ^&&^.
-`)
-	config.TemplateArgs.Build.Command = Utils.AskForString("Build command:", config.TemplateArgs.Build.Command)
-	pc.MainClass = Utils.AskForString("Main FX class:", pc.MainClass)
-}
-
-func initProjectMatlab(config *Utils.MaruConfig, isNewProject bool) {
-	Utils.PrintFatal("MATLAB is currently unsupported")
+	return path.Base(cwd)
 }
 
 func generateDockerfile(config *Utils.MaruConfig) {
 
-	if Utils.FileExists(Utils.DockerFilePath) {
+	// A Dockerfile generated by Maru is updated, merging any hand edits, but any other Dockerfile is replaced
+	if _, generated := Utils.ReadMergeBase(); Utils.FileExists(Utils.DockerFilePath) && !generated {
 		if !Utils.AskForBool("Found existing Dockerfile. Replace?", true) {
 			Utils.PrintFatal("Project initialization aborted")
 		}
 	}
 
-	templateName := config.TemplateArgs.Flavor+".got"
+	updateDockerfile(config, renderDockerfile(config))
+}
 
-	fs, err := gitfs.New(context.Background(), "github.com/JaneliaSciComp/maru/templates", gitfs.OptLocal(localDebug))
-	if err != nil {
-		Utils.PrintFatal("Failed creating gitfs: %s", err)
+// Returns the answer given in advance for the given key, or asks the user
+func askString(key string, message string, defaultValue string) string {
+	if value, ok := initAnswers[key]; ok {
+		Utils.PrintMessage("%s ^%s^", message, value)
+		return value
 	}
+	return Utils.AskForString(message, defaultValue)
+}
 
-	tmpls, err := fsutil.TmplParse(fs, nil, "/"+templateName)
-	if err != nil {
-		Utils.PrintFatal("Failed parsing templates: %s", err)
+// Returns the answer given in advance for the given key, or asks the user to confirm
+func askBool(key string, message string, defaultValue bool) bool {
+	if value, ok := initAnswers[key]; ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			Utils.PrintFatal("Invalid value for %s: %s (must be true or false)", key, value)
+		}
+		Utils.PrintMessage("%s ^%t^", message, b)
+		return b
 	}
+	return Utils.AskForBool(message, defaultValue)
+}
 
-	if f, err := os.OpenFile(Utils.DockerFilePath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644); err == nil {
-		defer f.Close()
-
-		err2 := tmpls.ExecuteTemplate(f, templateName, config)
-		if err2 != nil {
-			Utils.PrintFatal("Failed to create Dockerfile: %s", err2)
+// Returns the answer given in advance for the given key, or asks the user to choose one of the options
+func askSelect(key string, message string, options []string, defaultValue string) string {
+	if value, ok := initAnswers[key]; ok {
+		if indexOf(value, options) < 0 {
+			Utils.PrintFatal("Invalid value for %s: %s (valid options: %s)", key, value, strings.Join(options, ", "))
 		}
+		Utils.PrintMessage("%s ^%s^", message, value)
+		return value
+	}
+	return Utils.AskForSelect(message, options, defaultValue)
+}
 
-		Utils.PrintSuccess("Created Dockerfile")
-
-	} else {
-		Utils.PrintFatal("Failed to create Dockerfile: %s", err)
+// Returns the answer given in advance for the given key, or asks the user for multiple lines of input
+func askMultiline(key string, message string, defaultValue string) string {
+	if value, ok := initAnswers[key]; ok {
+		Utils.PrintMessage("%s ^%s^", message, value)
+		return value
 	}
+	return Utils.AskForMultiline(message, defaultValue)
 }
 
 func printFinalInstructions(config *Utils.MaruConfig) {
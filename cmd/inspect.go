@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	Utils "maru/utils"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+)
+
+var inspectJSON bool
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect [version]",
+	Short: "Show what is inside a built image",
+	Long: `Shows the build information in /buildinfo, the labels, entrypoint, environment, size, number of layers and
+creation time of the image built for the current version of the project, or for the given version.
+
+The packages installed by the flavor are listed too: the Conda packages for python_conda, the Maven artifacts in the
+application jar for java_maven and javafx_maven, and the Fiji plugins for fiji_macro. These are read by running short
+lived containers of the image, which are removed afterwards.
+
+Use --json to print everything as a JSON object, e.g. for other tools to read.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config := Utils.ReadMandatoryProjectConfig()
+		image := config.GetNameVersion()
+		if len(args) > 0 {
+			if err := Utils.ValidateVersion(args[0]); err != nil {
+				Utils.PrintFatal("Invalid version: %s", err)
+			}
+			image = config.Name + ":" + args[0]
+		}
+		inspection := inspectImage(config, image)
+		if inspectJSON {
+			out, err := json.MarshalIndent(inspection, "", "  ")
+			if err != nil {
+				Utils.PrintFatal("%s", err)
+			}
+			fmt.Println(string(out))
+		} else {
+			printInspection(inspection)
+		}
+	},
+}
+
+func init() {
+	inspectCmd.Flags().BoolVar(&inspectJSON, "json", false, "Print the details as JSON")
+	rootCmd.AddCommand(inspectCmd)
+}
+
+// imageInspection is what maru inspect shows about an image
+type imageInspection struct {
+	Image      string            `json:"image"`
+	ID         string            `json:"id"`
+	Created    string            `json:"created"`
+	Size       int64             `json:"size"`
+	Platform   string            `json:"platform"`
+	Layers     int               `json:"layers"`
+	Entrypoint []string          `json:"entrypoint"`
+	Cmd        []string          `json:"cmd,omitempty"`
+	Env        []string          `json:"env"`
+	Labels     map[string]string `json:"labels"`
+	BuildInfo  string            `json:"buildinfo"`
+	Flavor     string            `json:"flavor,omitempty"`
+	Packages   []string          `json:"packages,omitempty"`
+}
+
+// flavorPackageList lists the packages which a flavor installs in the image
+type flavorPackageList struct {
+	title string
+	list  func(engine Utils.Engine, image string) ([]string, error)
+}
+
+var flavorPackageLists = map[string]flavorPackageList{
+	"python_conda": {"Conda packages", listCondaPackages},
+	"java_maven":   {"Maven artifacts", listMavenArtifacts},
+	"javafx_maven": {"Maven artifacts", listMavenArtifacts},
+	"fiji_macro":   {"Fiji plugins", listFijiPlugins},
+}
+
+// Reads the details of the image and the files inside it, and quits if the image doesn't exist
+func inspectImage(config *Utils.MaruConfig, image string) *imageInspection {
+
+	engine := Utils.GetEngine()
+	details, err := engine.InspectImage(image)
+	if err != nil {
+		Utils.PrintFatal("Cannot inspect %s: %s", image, err)
+	}
+	if details == nil {
+		Utils.PrintFatal("Image %s was not found, use `maru build` to build it", image)
+	}
+
+	inspection := &imageInspection{
+		Image:      image,
+		ID:         details.ID,
+		Created:    details.Created,
+		Size:       details.Size,
+		Platform:   details.Platform(),
+		Layers:     len(details.Layers),
+		Entrypoint: details.Entrypoint,
+		Cmd:        details.Cmd,
+		Env:        details.Env,
+		Labels:     details.Labels,
+	}
+
+	if out, err := engine.ContainerOutput(image, []string{"cat", "/buildinfo"}); err != nil {
+		printInspectError("Cannot read /buildinfo: %s", err)
+	} else {
+		inspection.BuildInfo = string(out)
+	}
+
+	// Images built by earlier versions of Maru don't have the flavor label
+	inspection.Flavor = details.Labels[Utils.LabelMaruFlavor]
+	if inspection.Flavor == "" {
+		inspection.Flavor = config.TemplateArgs.Flavor
+	}
+	if packages, ok := flavorPackageLists[inspection.Flavor]; ok {
+		if inspection.Packages, err = packages.list(engine, image); err != nil {
+			printInspectError("Cannot list %s: %s", packages.title, err)
+		}
+	}
+	return inspection
+}
+
+// Errors are only shown in debug mode with --json, so that the output stays valid JSON
+func printInspectError(format string, a ...interface{}) {
+	if inspectJSON {
+		Utils.PrintDebug(format, a...)
+	} else {
+		Utils.PrintError(format, a...)
+	}
+}
+
+func printInspection(inspection *imageInspection) {
+	Utils.PrintInfo("%s", inspection.Image)
+	Utils.PrintMessage("id: %s", inspection.ID)
+	Utils.PrintMessage("created: %s", inspection.Created)
+	Utils.PrintMessage("size: %s", units.HumanSize(float64(inspection.Size)))
+	Utils.PrintMessage("platform: %s", inspection.Platform)
+	Utils.PrintMessage("layers: %d", inspection.Layers)
+	Utils.PrintMessage("entrypoint: %s", strings.Join(inspection.Entrypoint, " "))
+	if len(inspection.Cmd) > 0 {
+		Utils.PrintMessage("command: %s", strings.Join(inspection.Cmd, " "))
+	}
+	if len(inspection.Env) > 0 {
+		Utils.PrintMessage("environment:")
+		for _, env := range inspection.Env {
+			Utils.PrintMessage("- %s", env)
+		}
+	}
+	printImageLabels(inspection.Labels)
+	if inspection.BuildInfo != "" {
+		Utils.PrintMessage("buildinfo:")
+		for _, line := range Utils.SplitLines(strings.TrimRight(inspection.BuildInfo, "\n")) {
+			Utils.PrintMessage("  %s", line)
+		}
+	}
+	if packages, ok := flavorPackageLists[inspection.Flavor]; ok && len(inspection.Packages) > 0 {
+		Utils.PrintMessage("%s:", packages.title)
+		for _, p := range inspection.Packages {
+			Utils.PrintMessage("- %s", p)
+		}
+	}
+}
+
+// Returns the packages in the Conda environment of the python_conda flavor, as name, version, build and channel
+func listCondaPackages(engine Utils.Engine, image string) ([]string, error) {
+	out, err := engine.ContainerOutput(image, []string{"/opt/conda/bin/conda", "list", "-p", "/opt/conda/envs/myenv"})
+	if err != nil {
+		return nil, err
+	}
+	var packages []string
+	for _, line := range Utils.SplitLines(string(out)) {
+		if fields := strings.Fields(line); len(fields) > 0 && !strings.HasPrefix(line, "#") {
+			packages = append(packages, strings.Join(fields, " "))
+		}
+	}
+	return packages, nil
+}
+
+// Returns the Maven artifacts in the application jar of the java_maven flavors, as groupId:artifactId:version. The
+// jar contains the artifact it was built from, and those of any dependencies which were shaded into it.
+func listMavenArtifacts(engine Utils.Engine, image string) ([]string, error) {
+	out, err := engine.ContainerOutput(image, []string{"cat", "/app/app.jar"})
+	if err != nil {
+		return nil, err
+	}
+	jar, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read /app/app.jar: %s", err)
+	}
+	var artifacts []string
+	for _, f := range jar.File {
+		if matched, _ := path.Match("META-INF/maven/*/*/pom.properties", f.Name); !matched {
+			continue
+		}
+		properties, err := readProperties(f)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s in /app/app.jar: %s", f.Name, err)
+		}
+		artifacts = append(artifacts, properties["groupId"]+":"+properties["artifactId"]+":"+properties["version"])
+	}
+	sort.Strings(artifacts)
+	return artifacts, nil
+}
+
+// Reads a Java properties file which only has key=value lines, like the pom.properties written by Maven
+func readProperties(f *zip.File) (map[string]string, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	properties := make(map[string]string)
+	for _, line := range Utils.SplitLines(string(content)) {
+		if s := strings.SplitN(line, "=", 2); len(s) == 2 && !strings.HasPrefix(line, "#") {
+			properties[strings.TrimSpace(s[0])] = strings.TrimSpace(s[1])
+		}
+	}
+	return properties, nil
+}
+
+// Returns the contents of the Fiji plugins directory, which the plugins of the fiji_macro flavor are copied into
+func listFijiPlugins(engine Utils.Engine, image string) ([]string, error) {
+	out, err := engine.ContainerOutput(image, []string{"ls", "-1", "/opt/fiji/Fiji.app/plugins"})
+	if err != nil {
+		return nil, err
+	}
+	var plugins []string
+	for _, line := range Utils.SplitLines(string(out)) {
+		if line = strings.TrimSpace(line); line != "" {
+			plugins = append(plugins, line)
+		}
+	}
+	return plugins, nil
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	Utils "maru/utils"
+
+	"github.com/spf13/cobra"
+)
+
+var lockUpdate bool
+
+var lockCmd = &cobra.Command{
+	Use:   "lock [--update]",
+	Short: "Pin the commit and base images used by the build",
+	Long: `Resolves the Git tag to a commit, and the base images in the Dockerfile to digests, and records them in a
+maru.lock next to the maru.yaml. Builds then check out exactly that commit and use exactly those base images, even if
+the tag is moved or a newer base image is pushed. Commit the maru.lock together with the maru.yaml.
+
+The lock is created by the first build, and updated automatically when the repository, Git tag or base images are
+changed in the project. Use --update to pin the latest commit of a branch or the latest base images, and
+^maru build --frozen^ to fail instead of updating the lock.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		config := Utils.ReadMandatoryProjectConfig()
+		if config.TemplateArgs.Flavor != "" {
+			checkDockerfile(config)
+		}
+		lock := Utils.ReadLock()
+		if reason := getLockStaleReason(config, lock, nil); reason != "" || lockUpdate {
+			lock = createLock(config, lock, nil)
+			Utils.WriteLock(lock)
+			Utils.PrintSuccess("Updated %s", Utils.LockFile)
+		} else {
+			Utils.PrintInfo("%s is up to date. Use --update to pin the latest commit and base images.", Utils.LockFile)
+		}
+		printLock(lock)
+	},
+}
+
+func init() {
+	lockCmd.Flags().BoolVar(&lockUpdate, "update", false, "Resolve the Git tag and base images again, even if the lock is up to date")
+	rootCmd.AddCommand(lockCmd)
+}
+
+// Describes why the lock doesn't match the project, or returns an empty string if it's up to date. Base images
+// whose repositories are excluded are ignored, because they are built in the same workspace build.
+func getLockStaleReason(config *Utils.MaruConfig, lock *Utils.MaruLock, exclude map[string]bool) string {
+	repoUrl, gitTag := getLockedRepo(config)
+	if lock != nil && len(exclude) > 0 {
+		pinned := *lock
+		pinned.BaseImages = make(map[string]string)
+		for image, digest := range lock.BaseImages {
+			if !exclude[Utils.ImageRepository(image)] {
+				pinned.BaseImages[image] = digest
+			}
+		}
+		lock = &pinned
+	}
+	return lock.StaleReason(repoUrl, gitTag, getLockedBaseImages(exclude))
+}
+
+// Returns the base images of the Dockerfile which are pinned, i.e. those whose repositories are not excluded
+func getLockedBaseImages(exclude map[string]bool) []string {
+	var images []string
+	for _, image := range Utils.GetBaseImages(readDockerfile()) {
+		if !exclude[Utils.ImageRepository(image)] {
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// Returns the repository and Git tag which the lock applies to, which are empty for projects without a repository
+func getLockedRepo(config *Utils.MaruConfig) (string, string) {
+	repoUrl := config.TemplateArgs.Build.RepoUrl
+	if repoUrl == "" {
+		return "", ""
+	}
+	return repoUrl, config.GetRepoTag()
+}
+
+// Resolves the commit and base image digests for the project as it's currently configured. Excluded base images
+// are not resolved, but keep their pins from the previous lock.
+func createLock(config *Utils.MaruConfig, previous *Utils.MaruLock, exclude map[string]bool) *Utils.MaruLock {
+
+	repoUrl, gitTag := getLockedRepo(config)
+	lock := &Utils.MaruLock{RepoUrl: repoUrl, GitTag: gitTag}
+
+	if repoUrl != "" {
+		Utils.PrintMessage("Resolving %s @ %s...", gitTag, repoUrl)
+		commit, err := Utils.ResolveGitCommit(repoUrl, gitTag)
+		if err != nil {
+			Utils.PrintFatal("Cannot lock the source code: %s", err)
+		}
+		lock.GitCommit = commit
+	}
+
+	lock.BaseImages = make(map[string]string)
+	for _, image := range Utils.GetBaseImages(readDockerfile()) {
+		if exclude[Utils.ImageRepository(image)] {
+			if previous != nil && previous.BaseImages[image] != "" {
+				lock.BaseImages[image] = previous.BaseImages[image]
+			}
+			continue
+		}
+		Utils.PrintMessage("Resolving %s...", image)
+		digest, err := Utils.ResolveImageDigest(image)
+		if err != nil {
+			Utils.PrintFatal("Cannot lock the base images: %s", err)
+		}
+		lock.BaseImages[image] = digest
+	}
+
+	return lock
+}
+
+// Returns the lock to build with. A missing or stale lock is created again, unless frozen is set, in which case
+// the build stops instead. With update false, a stale lock is never written and nil is returned instead. Base
+// images whose repositories are excluded are left out of the comparison.
+func resolveLock(config *Utils.MaruConfig, frozen bool, update bool, exclude map[string]bool) *Utils.MaruLock {
+
+	lock := Utils.ReadLock()
+	reason := getLockStaleReason(config, lock, exclude)
+	if reason == "" {
+		return lock
+	}
+	if frozen {
+		Utils.PrintFatal("%s is out of date, because %s. Run `maru lock` to update it.", Utils.LockFile, reason)
+	}
+	if !update {
+		Utils.PrintDebug("Not using %s, because %s", Utils.LockFile, reason)
+		return nil
+	}
+
+	Utils.PrintInfo("Updating %s, because %s", Utils.LockFile, reason)
+	lock = createLock(config, lock, exclude)
+	Utils.WriteLock(lock)
+	return lock
+}
+
+// Prints the pinned commit and base images
+func printLock(lock *Utils.MaruLock) {
+	if lock.GitCommit != "" {
+		Utils.PrintMessage("commit: %s (%s)", lock.GitCommit, lock.GitTag)
+	}
+	if len(lock.BaseImages) > 0 {
+		Utils.PrintMessage("base images:")
+		for _, image := range lock.SortedBaseImages() {
+			Utils.PrintMessage("- %s@%s", image, lock.BaseImages[image])
+		}
+	}
+}
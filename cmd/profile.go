@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	Utils "maru/utils"
+)
+
+// profileName is the profile selected with --profile, which overrides some of the settings in the maru.yaml
+var profileName string
+
+// Applies the selected profile to the project configuration. In a workspace, projects without the profile are
+// used as they are, instead of stopping.
+func applyProfile(config *Utils.MaruConfig, workspace bool) {
+	if profileName == "" {
+		return
+	}
+	if workspace && config.Profiles[profileName] == nil {
+		Utils.PrintMessage("%s has no profile %s, using its default settings", config.Name, profileName)
+		return
+	}
+	if err := config.ApplyProfile(profileName); err != nil {
+		Utils.PrintFatal("%s", err)
+	}
+}
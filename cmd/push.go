@@ -2,47 +2,139 @@ package cmd
 
 import (
 	Utils "maru/utils"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
+var pushAll bool
+
+var pushProjects []string
+
 var pushCmd = &cobra.Command{
 	Use:   "push",
 	Short: "Push the container to all its configured remotes",
-	Long:  `Deploys the container to all of its configured remotes. The container must be already built using the build command. Use remote command to list remotes or add a new one.`,
-	Args:  cobra.ExactArgs(0),
+	Long: `Deploys the container to all of its configured remotes. The container must be already built using the build command. Use remote command to list remotes or add a new one.
+
+With --profile, the remotes and additional tags of that profile in the maru.yaml are used, as for ^maru build^.
+Profiles which build another Git tag push ^<name>:<version>-<profile>^ instead of the version, and an image which
+was built as another version than its tag is never pushed.
+
+Images built for several platforms are pushed as one manifest list, which refers to the image of each platform.
+With Docker, the image of each platform is pushed first, with a tag of its own, e.g. ^<name>:<version>-linux-arm64^.
+
+With --all, every project in the workspace is pushed, in the order they are built by ^maru build --all^, so that
+base images are pushed before the images which use them. Use --project to only push the given projects and the
+projects which depend on them, like ^maru build --all --project^.`,
+	Args: cobra.ExactArgs(0),
 	Run: func(cmd *cobra.Command, args []string) {
 
-		config := Utils.ReadMandatoryProjectConfig()
-		if !config.HasRemotes() {
-			Utils.PrintMessage("There are no remotes configured for the current project.")
-			Utils.PrintInfo("Use `maru remote add` to add a new remote.")
-		} else {
-			imageName := config.GetNameVersion()
-			Utils.PrintInfo("Pushing %s to %d repositories", imageName, len(config.Remotes))
-
-			for _, n := range config.Remotes {
-				registryTag := config.GetDockerTag(n)
-
-				Utils.PrintHint("%% docker tag %s %s", imageName, registryTag)
-				err := Utils.RunCommand("docker", "tag", imageName, registryTag)
-				if err != nil {
-					Utils.PrintError("Command `docker tag` failed with %s", err)
-				} else {
-					Utils.PrintHint("%% docker push %s", registryTag)
-					err := Utils.RunCommand("docker", "push", registryTag)
-					if err != nil {
-						Utils.PrintError("Command `docker push` failed with %s", err)
-					} else {
-						Utils.PrintSuccess("Successfully pushed to %s", registryTag)
-					}
-				}
+		if pushAll {
+			root, projects := loadWorkspace()
+			if len(pushProjects) > 0 {
+				projects = Utils.Dependants(projects, findProjects(projects, pushProjects))
 			}
-
+			forEachProject(root, projects, func(p *Utils.WorkspaceProject) bool {
+				applyProfile(p.Config, true)
+				return runPush(p.Config)
+			})
+			Utils.PrintSuccess("Successfully pushed %d projects", len(projects))
+			return
 		}
+		if len(pushProjects) > 0 {
+			Utils.PrintFatal("--project can only be used together with --all")
+		}
+
+		config := Utils.ReadMandatoryProjectConfig()
+		applyProfile(config, false)
+		runPush(config)
 	},
 }
 
 func init() {
+	pushCmd.Flags().BoolVar(&pushAll, "all", false, "Push every project in the workspace, in dependency order")
+	pushCmd.Flags().StringArrayVar(&pushProjects, "project", nil, "With --all, only push this project and the projects which depend on it")
+	pushCmd.Flags().StringVar(&profileName, "profile", "", "Push the tags and remotes of this profile in the maru.yaml")
 	rootCmd.AddCommand(pushCmd)
 }
+
+// Pushes the current project to its remotes, with the given configuration after any profile was applied. Returns false
+// if any push failed.
+func runPush(config *Utils.MaruConfig) bool {
+
+	validateProjectOrExit(config)
+	if !config.HasRemotes() {
+		Utils.PrintMessage("There are no remotes configured for the current project.")
+		Utils.PrintInfo("Use `maru remote add` to add a new remote.")
+		return true
+	}
+
+	imageName := config.GetNameVersion()
+	Utils.PrintInfo("Pushing %s to %d repositories", imageName, len(config.Remotes))
+
+	engine := Utils.GetEngine()
+	platforms, err := engine.ImagePlatforms(imageName)
+	if err != nil {
+		Utils.PrintError("Cannot inspect %s: %s", imageName, err)
+		return false
+	}
+	if version := getBuiltVersion(engine, config, imageName); version != "" {
+		Utils.PrintHint("Build it again with `maru build`, or push the build of a profile with `maru push --profile`")
+		Utils.PrintError("Cannot push %s, because it was built as version %s", imageName, version)
+		return false
+	}
+
+	// The additional tags of the profile are pushed as well, and were built together with the version
+	images := append([]string{imageName}, config.GetExtraTags()...)
+	ok := true
+	for _, n := range config.Remotes {
+		for _, image := range images {
+			if !pushImage(engine, image, config.GetRemote(n)+"/"+image, platforms) {
+				ok = false
+			}
+		}
+	}
+	return ok
+}
+
+// Returns the version which the local image was built as, if it's not the one it's tagged with, e.g. because an
+// earlier Maru tagged the build of a profile with another Git tag as the release. Returns an empty string otherwise.
+func getBuiltVersion(engine Utils.Engine, config *Utils.MaruConfig, image string) string {
+	details, err := engine.InspectImage(image)
+	if err != nil || details == nil {
+		return ""
+	}
+	want := config.GetImageLabels(strings.TrimPrefix(image, config.Name+":"), "", time.Time{})[Utils.LabelVersion]
+	if version := details.Labels[Utils.LabelVersion]; version != want {
+		return version
+	}
+	return ""
+}
+
+// Pushes the image to the given registry tag, as a manifest list if it was built for several platforms. Returns
+// false if the push failed.
+func pushImage(engine Utils.Engine, image string, registryTag string, platforms []string) bool {
+
+	if len(platforms) > 1 {
+		Utils.PrintMessage("Pushing %s for %s...", registryTag, strings.Join(platforms, ", "))
+		if err := engine.PushManifestList(image, registryTag, platforms); err != nil {
+			Utils.PrintError("Cannot push %s: %s", registryTag, err)
+			return false
+		}
+		Utils.PrintSuccess("Successfully pushed to %s", registryTag)
+		return true
+	}
+
+	if err := engine.TagImage(image, registryTag); err != nil {
+		Utils.PrintError("Cannot tag %s as %s: %s", image, registryTag, err)
+		return false
+	}
+	Utils.PrintMessage("Pushing %s...", registryTag)
+	if err := engine.PushImage(registryTag); err != nil {
+		Utils.PrintError("Cannot push %s: %s", registryTag, err)
+		return false
+	}
+	Utils.PrintSuccess("Successfully pushed to %s", registryTag)
+	return true
+}
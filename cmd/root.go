@@ -2,6 +2,7 @@ package cmd
 
 import (
 	Utils "maru/utils"
+	"os"
 
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
@@ -38,6 +39,8 @@ func init() {
 	// Global configuration
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.maru.yaml)")
 	rootCmd.PersistentFlags().BoolVarP(&Utils.Debug, "debug", "d", false, "print debug output")
+	rootCmd.PersistentFlags().BoolVarP(&Utils.AssumeYes, "yes", "y", false, "accept the default answer for every question instead of prompting")
+	rootCmd.PersistentFlags().StringVar(&Utils.EngineName, "engine", "", "container engine to use: docker, podman, nerdctl or buildah (default is $MARU_ENGINE, the config file, or the first one installed)")
 
 	// Docker parameters
 	rootCmd.PersistentFlags().StringArrayVarP(&EnvParam, "env", "e", nil, "Set environment variables for the running container, e.g. when using run or shell")
@@ -67,4 +70,15 @@ func initConfig() {
 	if err := viper.ReadInConfig(); err == nil {
 		Utils.PrintMessage("Using config file: %s", viper.ConfigFileUsed())
 	}
+
+	// The container engine is taken from the flag, then the environment, then the config file
+	if Utils.EngineName == "" {
+		Utils.EngineName = os.Getenv("MARU_ENGINE")
+	}
+	if Utils.EngineName == "" {
+		Utils.EngineName = viper.GetString("engine")
+	}
+	if Utils.EngineName != "" {
+		Utils.GetEngine()
+	}
 }
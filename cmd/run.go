@@ -2,7 +2,6 @@ package cmd
 
 import (
 	Utils "maru/utils"
-	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -30,81 +29,15 @@ func runContainer(args []string) {
 	versionTag := config.GetNameVersion()
 	Utils.PrintInfo("Running %s", versionTag)
 
-	cmdArgs := make([]string, 3+2*len(EnvParam)+len(args))
-
-	cmdArgs[0] = "run"
-	cmdArgs[1] = "-i"
-
-	i := 2
-	if EnvParam != nil {
-		for _, v := range EnvParam {
-			cmdArgs[i] = "-e"
-			cmdArgs[i+1] = v
-			i += 2
-		}
-	}
-
-	cmdArgs[i] = versionTag
-
-	if args != nil {
-		for _, v := range args {
-			i++
-			cmdArgs[i] = v
-		}
-	}
-
-	Utils.PrintHint("%% docker %s", strings.Join(cmdArgs, " "))
-
-	err := Utils.RunCommand("docker", cmdArgs...)
+	exitCode, err := Utils.GetEngine().RunContainer(Utils.ContainerRun{
+		Image: versionTag,
+		Cmd:   args,
+		Env:   EnvParam,
+		User:  UserParam,
+	})
 	if err != nil {
-		Utils.PrintError("Command `docker run` exited with %s", err)
+		Utils.PrintError("Cannot run %s: %s", versionTag, err)
+	} else if exitCode != 0 {
+		Utils.PrintError("Container exited with code %d", exitCode)
 	}
-
-	// 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	// 	if err != nil {
-	// 		Utils.PrintFatal("%s", err)
-	// 	}
-	// 	defer cli.Close()
-
-	// 	ctx := context.Background()
-
-	// 	// Create the container using the current project context and user arguments
-	// 	resp, err := cli.ContainerCreate(ctx, &container.Config{
-	// 		Image:      versionTag,
-	// 		Cmd:        args,
-	// 		Tty:        true,
-	// 		Entrypoint: entrypoint,
-	// 		Env:        EnvParam,
-	// 		User:       UserParam,
-	// 	}, nil, nil, nil, "")
-	// 	if err != nil {
-	// 		Utils.PrintFatal("%s", err)
-	// 	}
-
-	// 	// Run the container
-	// 	if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
-	// 		Utils.PrintFatal("%s", err)
-	// 	}
-
-	// 	// Monitor until the container is finished
-	// 	statusCh, errCh := cli.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
-	// 	select {
-	// 	case err := <-errCh:
-	// 		if err != nil {
-	// 			Utils.PrintFatal("%s", err)
-	// 		}
-	// 	case <-statusCh:
-	// 	}
-
-	// 	// Copy the container logs so that the user can view them
-	// 	out, err := cli.ContainerLogs(ctx, resp.ID, types.ContainerLogsOptions{
-	// 		ShowStdout: true,
-	// 	})
-	// 	if err != nil {
-	// 		Utils.PrintFatal("%s", err)
-	// 	}
-
-	// 	if _, err := io.Copy(os.Stdout, out); err != nil {
-	// 		Utils.PrintFatal("%s", err)
-	// 	}
 }
@@ -1,47 +1,155 @@
 package cmd
 
 import (
-	"github.com/spf13/cobra"
+	"io/ioutil"
 	Utils "maru/utils"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
 )
 
+// Short names for settings which are changed often
+var configKeyAliases = map[string]string{
+	"git_tag": "build_args.GIT_TAG",
+}
+
 var setCmd = &cobra.Command{
-	Use:   "set [variable] [value]",
+	Use:   "set [key] [value...]",
 	Short: "Set the values of variables in the Maru configuration",
-	Long: `Convenience command for quickly updating the project version and other variables without 
-manually editing the maru.yaml.`,
-}
+	Long: `Convenience command for quickly updating the project version and other variables without
+manually editing the maru.yaml. Any setting can be changed using its dotted path in the maru.yaml, e.g.
 
-var setVersionCmd = &cobra.Command{
-	Use:   "version [value]",
-	Short: "Set the version of the container",
-	Long: `Convenience command for quickly updating the current project's version.`,
-	Args: cobra.ExactArgs(1),
+  maru set version 1.2.0
+  maru set git_tag v1.2.0
+  maru set build_args.FIJI_VERSION 20230101
+  maru set template_args.python_conda.python_version 3.9
+  maru set remotes janeliascicomp registry.example.org/lab
+
+Lists take any number of values, and other settings take exactly one. The new value is checked in the same way
+as ^maru validate^ before the maru.yaml is written.`,
+	Args:              cobra.MinimumNArgs(2),
+	ValidArgsFunction: completeConfigKeys,
 	Run: func(cmd *cobra.Command, args []string) {
-		varValue := args[0]
-		var config = Utils.ReadMandatoryProjectConfig()
-		config.Version = varValue
-		Utils.WriteProjectConfig(config)
-		Utils.PrintSuccess("Updated version to %s", varValue)
+		key := resolveConfigKey(args[0])
+		checkConfigKeyIsWritable(key)
+		config := Utils.ReadMandatoryProjectConfig()
+		before := validateProject(config, Utils.ReadConfigDocument())
+		if err := Utils.SetConfigValue(config, key, args[1:]); err != nil {
+			Utils.PrintFatal("Cannot set %s: %s", args[0], err)
+		}
+		writeValidatedConfig(config, before)
+		Utils.PrintSuccess("Updated %s to %s", args[0], strings.Join(args[1:], " "))
 	},
 }
 
-var setGitTagCmd = &cobra.Command{
-	Use:   "git_tag [value]",
-	Short: "Set the GIT tag to build",
-	Long: `Convenience command for quickly updating the GIT tag to build.`,
-	Args: cobra.ExactArgs(1),
+var unsetCmd = &cobra.Command{
+	Use:   "unset [key]",
+	Short: "Remove a variable from the Maru configuration",
+	Long: `Removes the setting with the given dotted path from the maru.yaml, e.g. ^maru unset build_args.FOO^.
+Keys of build_args are deleted, and other settings are reset to their empty value.`,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeConfigKeys,
 	Run: func(cmd *cobra.Command, args []string) {
-		varValue := args[0]
-		var config = Utils.ReadMandatoryProjectConfig()
-		config.SetBuildArg("GIT_TAG", varValue)
-		Utils.WriteProjectConfig(config)
-		Utils.PrintSuccess("Updated git_tag to %s", varValue)
+		key := resolveConfigKey(args[0])
+		checkConfigKeyIsWritable(key)
+		config := Utils.ReadMandatoryProjectConfig()
+		before := validateProject(config, Utils.ReadConfigDocument())
+		if err := Utils.UnsetConfigValue(config, key); err != nil {
+			Utils.PrintFatal("Cannot unset %s: %s", args[0], err)
+		}
+		writeValidatedConfig(config, before)
+		Utils.PrintSuccess("Removed %s", args[0])
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(setCmd)
-	setCmd.AddCommand(setVersionCmd)
-	setCmd.AddCommand(setGitTagCmd)
+	rootCmd.AddCommand(unsetCmd)
+}
+
+// Returns the dotted path for the given key, which may be an alias, and quits if it's not a valid setting
+func resolveConfigKey(key string) string {
+	if alias, ok := configKeyAliases[key]; ok {
+		key = alias
+	}
+	if err := Utils.CheckConfigKey(key); err != nil {
+		Utils.PrintFatal("Invalid key: %s", err)
+	}
+	return key
+}
+
+// Quits if the setting can't be changed by hand
+func checkConfigKeyIsWritable(key string) {
+	if key == "maru_version" {
+		Utils.PrintFatal("maru_version is updated by `maru upgrade`")
+	}
+}
+
+// Writes the updated project configuration, unless the change made it invalid. Problems which were already there
+// before the change don't prevent writing it.
+func writeValidatedConfig(config *Utils.MaruConfig, before []Utils.ConfigError) {
+
+	existing := make(map[string]bool)
+	for _, e := range before {
+		existing[e.Message] = true
+	}
+
+	var introduced []string
+	for _, e := range validateProject(config, Utils.ReadConfigDocument()) {
+		if !existing[e.Message] {
+			introduced = append(introduced, e.Message)
+		}
+	}
+	if len(introduced) > 0 {
+		for _, message := range introduced {
+			Utils.PrintError("%s", message)
+		}
+		Utils.PrintFatal("%s was not changed", Utils.ConfFile)
+	}
+
+	Utils.WriteProjectConfig(config)
+}
+
+// Completes the dotted paths of the settings in the project configuration
+func completeConfigKeys(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	keys := Utils.ConfigKeys()
+	for alias := range configKeyAliases {
+		keys = append(keys, alias)
+	}
+
+	// Keys of maps are taken from the existing configuration. It's read quietly, because anything printed
+	// would become part of the completions.
+	if raw, err := ioutil.ReadFile(Utils.ConfFile); err == nil {
+		var config Utils.MaruConfig
+		if yaml.Unmarshal(raw, &config) == nil {
+			for key := range config.BuildArgs {
+				keys = append(keys, "build_args."+key)
+			}
+			for flavor, args := range config.TemplateArgs.Custom {
+				for key := range args {
+					keys = append(keys, "template_args."+flavor+"."+key)
+				}
+			}
+		}
+	}
+
+	var matches []string
+	directive := cobra.ShellCompDirectiveNoFileComp
+	for _, key := range keys {
+		if strings.HasPrefix(key, toComplete) {
+			matches = append(matches, key)
+			if strings.HasSuffix(key, ".") {
+				directive |= cobra.ShellCompDirectiveNoSpace
+			}
+		}
+	}
+	sort.Strings(matches)
+	return matches, directive
 }
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	Utils "maru/utils"
-	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -27,97 +26,17 @@ func runInteractive(entrypoint []string, args []string) {
 	versionTag := config.GetNameVersion()
 	Utils.PrintInfo("Creating interactive shell for %s", versionTag)
 
-	cmdArgs := make([]string, 5+2*len(EnvParam))
-
-	cmdArgs[0] = "run"
-	cmdArgs[1] = "-it"
-
-	i := 2
-	if EnvParam != nil {
-		for _, v := range EnvParam {
-			cmdArgs[i] = "-e"
-			cmdArgs[i+1] = v
-			i += 2
-		}
-	}
-
-	cmdArgs[i] = "--entrypoint"
-	cmdArgs[i+1] = "/bin/bash"
-	cmdArgs[i+2] = versionTag
-
-	Utils.PrintHint("%% docker %s", strings.Join(cmdArgs, " "))
-
-	err := Utils.RunCommand("docker", cmdArgs...)
+	exitCode, err := Utils.GetEngine().RunContainer(Utils.ContainerRun{
+		Image:      versionTag,
+		Entrypoint: entrypoint,
+		Cmd:        args,
+		Env:        EnvParam,
+		User:       UserParam,
+		Tty:        true,
+	})
 	if err != nil {
-		Utils.PrintError("Command `docker run` exited with %s", err)
+		Utils.PrintError("Cannot run %s: %s", versionTag, err)
+	} else if exitCode != 0 {
+		Utils.PrintError("Shell exited with code %d", exitCode)
 	}
-
-	/*
-		// A lot of this code was adapted from:
-		// https://stackoverflow.com/questions/58732588/accept-user-input-os-stdin-to-container-using-golang-docker-sdk-interactive-co
-
-		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-		if err != nil {
-			Utils.PrintFatal("%s", err)
-		}
-		defer cli.Close()
-
-		ctx := context.Background()
-		resp, err := cli.ContainerCreate(ctx, &container.Config{
-			Image:        versionTag,
-			Cmd:          args,
-			Tty:          true,
-			OpenStdin:    true,
-			AttachStdin:  true,
-			AttachStdout: true,
-			StdinOnce:    true,
-			Entrypoint:   entrypoint,
-			Env:          EnvParam,
-			User:         UserParam,
-		}, nil, nil, nil, "")
-		if err != nil {
-			Utils.PrintFatal("%s", err)
-		}
-
-		// It's important to attach before starting, otherwise we'll miss the first prompt
-		waiter, err := cli.ContainerAttach(ctx, resp.ID, types.ContainerAttachOptions{
-			Stdout:       true,
-			Stdin:        true,
-			Stream:       true,
-		})
-		if err != nil {
-			Utils.PrintFatal("%s", err)
-		}
-
-		// Set up IO pipes to run in the background
-		go io.Copy(os.Stdout, waiter.Reader)
-		go io.Copy(os.Stderr, waiter.Reader)
-		go io.Copy(waiter.Conn, os.Stdin)
-
-		// Ensure the terminal is raw
-		fd := int(os.Stdin.Fd())
-		var oldState *terminal.State
-		if terminal.IsTerminal(fd) {
-			oldState, err = terminal.MakeRaw(fd)
-			if err != nil {
-				Utils.PrintError("%s", err)
-			}
-			defer terminal.Restore(fd, oldState)
-		}
-
-		// Start the container process
-		if err := cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
-			Utils.PrintFatal("%s", err)
-		}
-
-		// Wait until the container is done
-		statusCh, errCh := cli.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
-		select {
-		case err := <-errCh:
-			if err != nil {
-				Utils.PrintFatal("%s", err)
-			}
-		case <-statusCh:
-		}
-	*/
 }
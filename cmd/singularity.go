@@ -17,7 +17,7 @@ var singularityBuildCmd = &cobra.Command{
 	Use:   "build [output image file]",
 	Short: "Builds a Singularity container from the existing Docker container",
 	Long: "Builds a Singularity container (in Singularity Image Format) from the built Docker container.\n" +
-		"This assumes that `maru build` was already run successfully and the Docker container exists on disk.",
+		"This assumes that `maru build` was already run successfully and the container exists in the container engine.",
 	Args: cobra.RangeArgs(0, 1),
 	Run: func(cmd *cobra.Command, args []string) {
 
@@ -29,14 +29,17 @@ var singularityBuildCmd = &cobra.Command{
 		imageName := config.GetNameVersion()
 
 		// Default to temp directory
-		outFile := "/tmp/" + config.Name + "_" + config.Version + ".sif"
+		outFile := "/tmp/" + config.Name + "_" + config.GetVersion() + ".sif"
 		if len(args) > 0 {
 			outFile = args[0]
 		}
 
+		transport, source, cleanup := getSingularitySource(imageName)
+		defer cleanup()
+
 		Utils.PrintInfo("Converting %s to Singularity Image Format (SIF)", imageName)
-		Utils.PrintHint("%% singularity build -F %s docker-daemon://%s", outFile, imageName)
-		err := Utils.RunCommand("singularity", "build", "-F", outFile, "docker-daemon://"+imageName)
+		Utils.PrintHint("%% singularity build -F %s %s://%s", outFile, transport, source)
+		err := Utils.RunCommand("singularity", "build", "-F", outFile, transport+"://"+source)
 		if err != nil {
 			Utils.PrintFatal("Singularity build failed: %s", err)
 		}
@@ -65,10 +68,13 @@ var singularityRunCmd = &cobra.Command{
 		Utils.PrintInfo("WARNING: This command implicitly converts the container to SIF format each time, which is a time-consuming operation. " +
 			"For repeatable use, use `maru singularity build` to create a SIF file on disk.")
 
-		// The usual slashes after docker-daemon are not accepted here
+		transport, source, cleanup := getSingularitySource(imageName)
+		defer cleanup()
+
+		// The usual slashes after the transport are not accepted here
 		// https://github.com/hpcng/singularity/issues/4734
-		Utils.PrintHint("%% singularity run docker-daemon:%s", imageName)
-		err := Utils.RunCommand("singularity", "run", "docker-daemon:"+imageName)
+		Utils.PrintHint("%% singularity run %s:%s", transport, source)
+		err := Utils.RunCommand("singularity", "run", transport+":"+source)
 		if err != nil {
 			Utils.PrintDebug("Singularity run failed: %s", err)
 		}
@@ -81,6 +87,16 @@ func init() {
 	singularityCmd.AddCommand(singularityRunCmd)
 }
 
+// Returns the transport and reference with which Singularity reads the image from the container engine, e.g.
+// docker-daemon or containers-storage for Podman, and a function which removes any archive exported for it
+func getSingularitySource(imageName string) (string, string, func()) {
+	transport, source, cleanup, err := Utils.GetEngine().SingularitySource(imageName)
+	if err != nil {
+		Utils.PrintFatal("Cannot export %s for Singularity: %s", imageName, err)
+	}
+	return transport, source, cleanup
+}
+
 // From https://siongui.github.io/2018/03/16/go-check-if-command-exists/
 func isCommandAvailable(name string) bool {
 	cmd := exec.Command("/bin/sh", "-c", "command -v "+name)
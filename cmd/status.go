@@ -3,29 +3,151 @@ package cmd
 import (
 	"github.com/spf13/cobra"
 	Utils "maru/utils"
+	"sort"
+	"strings"
 )
 
+var statusAll bool
+
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "Show the status of the current project",
-	Long: `Prints information about the project in the current working directory.`,
+	Long: `Prints information about the project in the current working directory.
+
+With --all, prints information about every project in the workspace, in the order they are built by
+^maru build --all^, together with the projects each one depends on.`,
 	Run: func(cmd *cobra.Command, args []string) {
 
-		var config = Utils.ReadMandatoryProjectConfig()
-		Utils.PrintInfo("%s %s", config.Name, config.Version)
-		Utils.PrintMessage("flavor: %s", config.TemplateArgs.Flavor)
-		Utils.PrintMessage("local tags:")
-		Utils.PrintMessage("- %s", config.GetNameLatest())
-		Utils.PrintMessage("- %s", config.GetNameVersion())
-		if config.HasRemotes() {
-			Utils.PrintMessage("remote tags:")
-			for _, n := range config.Remotes {
-				Utils.PrintMessage("- %s", config.GetDockerTag(n))
+		if statusAll {
+			root, projects := loadWorkspace()
+			for _, p := range projects {
+				inProjectDir(root, p, func() {
+					applyProfile(p.Config, true)
+					printStatus(p.Config)
+				})
+				checkProjectVersion(p)
+				printDependencies(p)
 			}
+			return
 		}
+
+		config := Utils.ReadMandatoryProjectConfig()
+		applyProfile(config, false)
+		printStatus(config)
 	},
 }
 
 func init() {
+	statusCmd.Flags().BoolVar(&statusAll, "all", false, "Show the status of every project in the workspace")
+	statusCmd.Flags().StringVar(&profileName, "profile", "", "Show the settings of this profile in the maru.yaml")
 	rootCmd.AddCommand(statusCmd)
 }
+
+// Prints information about the project in the working directory
+func printStatus(config *Utils.MaruConfig) {
+	Utils.PrintInfo("%s %s", config.Name, config.GetVersion())
+	if config.Profile != "" {
+		Utils.PrintMessage("profile: %s", config.Profile)
+	}
+	Utils.PrintMessage("flavor: %s", config.TemplateArgs.Flavor)
+	if config.TemplateArgs.Flavor != "" {
+		Utils.PrintMessage("dockerfile: %s", getDockerfileStatus(config))
+	}
+	if config.ProfileGitTag {
+		Utils.PrintMessage("lock: not used, because the profile builds %s", config.GetRepoTag())
+	} else if reason := getLockStaleReason(config, Utils.ReadLock(), nil); reason != "" {
+		Utils.PrintMessage("lock: out of date (%s)", reason)
+	} else {
+		Utils.PrintMessage("lock: up to date")
+	}
+	engine := Utils.GetEngine()
+	Utils.PrintMessage("engine: %s", engine.Name())
+	Utils.PrintMessage("local tags:")
+	built, err := engine.ListImages(config.Name)
+	for _, tag := range config.GetTags() {
+		if err != nil {
+			Utils.PrintMessage("- %s", tag)
+		} else if indexOf(tag, built) < 0 {
+			Utils.PrintMessage("- %s (not built)", tag)
+		} else {
+			Utils.PrintMessage("- %s (built)", tag)
+		}
+	}
+	if err != nil {
+		Utils.PrintDebug("Cannot list the images of %s: %s", config.Name, err)
+	}
+	if platforms, err := engine.ImagePlatforms(config.GetNameVersion()); err != nil {
+		Utils.PrintDebug("Cannot inspect %s: %s", config.GetNameVersion(), err)
+	} else if len(platforms) > 0 {
+		Utils.PrintMessage("platforms: %s", strings.Join(platforms, ", "))
+	}
+	if len(config.Platforms) > 0 {
+		Utils.PrintMessage("configured platforms: %s", strings.Join(config.Platforms, ", "))
+	}
+	if details, err := engine.InspectImage(config.GetNameVersion()); err != nil {
+		Utils.PrintDebug("Cannot inspect %s: %s", config.GetNameVersion(), err)
+	} else if details != nil {
+		printImageLabels(details.Labels)
+	}
+	if cacheFrom, cacheTo := config.GetCacheFrom(), config.GetCacheTo(); len(cacheFrom) > 0 || len(cacheTo) > 0 {
+		Utils.PrintMessage("build cache:")
+		for _, ref := range cacheFrom {
+			Utils.PrintMessage("- from %s", ref)
+		}
+		for _, ref := range cacheTo {
+			Utils.PrintMessage("- to %s", ref)
+		}
+	}
+	if config.HasRemotes() {
+		Utils.PrintMessage("remote tags:")
+		for _, n := range config.Remotes {
+			Utils.PrintMessage("- %s", config.GetDockerTag(n))
+			for _, tag := range config.GetExtraTags() {
+				Utils.PrintMessage("- %s/%s", config.GetRemote(n), tag)
+			}
+		}
+	}
+}
+
+// Prints the provenance labels which Maru added to the image, followed by any others, e.g. those of the base image
+func printImageLabels(labels map[string]string) {
+	if len(labels) == 0 {
+		return
+	}
+	known := []string{Utils.LabelSource, Utils.LabelRevision, Utils.LabelVersion, Utils.LabelCreated,
+		Utils.LabelTitle, Utils.LabelMaruVersion, Utils.LabelMaruFlavor}
+	var others []string
+	for key := range labels {
+		if indexOf(key, known) < 0 {
+			others = append(others, key)
+		}
+	}
+	sort.Strings(others)
+	Utils.PrintMessage("labels:")
+	for _, key := range append(known, others...) {
+		if value, ok := labels[key]; ok {
+			Utils.PrintMessage("- %s: %s", key, value)
+		}
+	}
+}
+
+// Prints the directory of a workspace project, and the images it uses from other projects in the workspace
+func printDependencies(p *Utils.WorkspaceProject) {
+	Utils.PrintMessage("directory: %s", p.Dir)
+	if len(p.Dependencies) == 0 {
+		return
+	}
+	Utils.PrintMessage("depends on:")
+	for _, image := range p.FromImages {
+		for _, d := range p.Dependencies {
+			if indexOf(Utils.ImageRepository(image), d.Images()) < 0 {
+				continue
+			}
+			if indexOf(image, d.Tags()) < 0 {
+				Utils.PrintMessage("- %s from %s (not a tag built by %s)", image, d.Dir, d.Config.Name)
+			} else {
+				Utils.PrintMessage("- %s from %s", image, d.Dir)
+			}
+		}
+	}
+}
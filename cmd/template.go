@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"context"
+	"io/ioutil"
+	Utils "maru/utils"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/posener/gitfs"
+	"github.com/posener/gitfs/fsutil"
+	"github.com/spf13/cobra"
+)
+
+// When running with `LOCAL_DEBUG=.`, the local repository will be used instead of the remote github.
+var localDebug = os.Getenv("LOCAL_DEBUG")
+
+// Directory containing template overrides, relative to the project directory or the user's home directory
+var templateOverrideDir = filepath.Join(".maru", "templates")
+
+// Extension of all template files
+const templateExt = ".got"
+
+// Name of the template which defines the builder stage used by all flavors
+const builderTemplateName = "_builder" + templateExt
+
+var templateExportUser bool
+
+// templateSource is one location in the template search path
+type templateSource struct {
+	name string
+	dir  string
+	fs   http.FileSystem
+}
+
+// templateSearchFS is a filesystem which opens each file from the first source in the search path which contains it
+type templateSearchFS struct {
+	sources []templateSource
+}
+
+func (t *templateSearchFS) Open(name string) (http.File, error) {
+	source := t.find(name)
+	if source == nil {
+		return nil, os.ErrNotExist
+	}
+	return source.fs.Open(name)
+}
+
+// Returns the first source in the search path which contains the given file, or nil if none of them do
+func (t *templateSearchFS) find(name string) *templateSource {
+	for i := range t.sources {
+		if f, err := t.sources[i].fs.Open(name); err == nil {
+			f.Close()
+			return &t.sources[i]
+		}
+	}
+	return nil
+}
+
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Manage the templates used to generate Dockerfiles",
+	Long: `Lists, shows and exports the templates used to generate the Dockerfile for each flavor. Templates are searched
+for in the project's ^.maru/templates^ directory, then in ^~/.maru/templates^, and finally in the templates built
+into Maru. To customize a template, export the built-in version, edit it, and then run ^maru init^ again.
+Templates whose names begin with an underscore are shared by all the flavors, e.g. ^_builder^ defines the stage
+which checks out and builds the code.
+
+New flavors can be added by placing a flavor definition (e.g. ^napari_plugin.yaml^) next to its template 
+(^napari_plugin.got^) in one of the template directories. The definition lists the questions asked by ^maru init^, 
+and the answers are available in the template as ^{{ .GetFlavorArgs.<key> }}^.
+
+Templates can also use the same variables as the maru.yaml, e.g. ^{{ .Interpolate "${name}:${version}" }}^.`,
+}
+
+var templateListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the available templates and where they are found",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		searchFS := newTemplateSearchFS()
+		for _, name := range listFiles(searchFS, templateExt) {
+			source := searchFS.find("/" + name + templateExt)
+			Utils.PrintMessage("%-20s %s", name, source.name)
+		}
+	},
+}
+
+var templateShowCmd = &cobra.Command{
+	Use:   "show [flavor]",
+	Short: "Print the template for the given flavor",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		searchFS := newTemplateSearchFS()
+		content, source := readTemplate(searchFS, args[0])
+		Utils.PrintHint("# %s template", source.name)
+		os.Stdout.Write(content)
+	},
+}
+
+var templateExportCmd = &cobra.Command{
+	Use:   "export [flavor]",
+	Short: "Copy a built-in template so that it can be customized",
+	Long: `Copies the built-in template for the given flavor into the project's ^.maru/templates^ directory, or into
+^~/.maru/templates^ when using --user. The copy will be used instead of the built-in template from then on.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		flavor := args[0]
+		builtin := newTemplateSearchFS()
+		builtin.sources = builtin.sources[len(builtin.sources)-1:]
+		content, _ := readTemplate(builtin, flavor)
+
+		dir := templateOverrideDir
+		if templateExportUser {
+			dir = getUserTemplateDir()
+		}
+		filename := filepath.Join(dir, flavor+templateExt)
+
+		if Utils.FileExists(filename) {
+			if !Utils.AskForBool("Found existing template "+filename+". Replace?", false) {
+				Utils.PrintFatal("Export aborted")
+			}
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			Utils.PrintFatal("%s", err)
+		}
+		if err := ioutil.WriteFile(filename, content, 0644); err != nil {
+			Utils.PrintFatal("Error writing template: %s", err)
+		}
+		Utils.PrintSuccess("Exported %s template to %s", flavor, filename)
+		Utils.PrintInfo("Edit the template and then run `maru init` to regenerate the Dockerfile.")
+	},
+}
+
+func init() {
+	templateExportCmd.Flags().BoolVar(&templateExportUser, "user", false, "Export to the user's template directory instead of the project")
+	rootCmd.AddCommand(templateCmd)
+	templateCmd.AddCommand(templateListCmd)
+	templateCmd.AddCommand(templateShowCmd)
+	templateCmd.AddCommand(templateExportCmd)
+}
+
+// Returns the directory containing the current user's template overrides
+func getUserTemplateDir() string {
+	home, err := homedir.Dir()
+	if err != nil {
+		Utils.PrintFatal("%s", err)
+	}
+	return filepath.Join(home, templateOverrideDir)
+}
+
+// Creates a filesystem which searches the project templates, the user templates and the built-in templates, in order
+func newTemplateSearchFS() *templateSearchFS {
+
+	builtin, err := gitfs.New(context.Background(), "github.com/JaneliaSciComp/maru/templates", gitfs.OptLocal(localDebug))
+	if err != nil {
+		Utils.PrintFatal("Failed creating gitfs: %s", err)
+	}
+
+	searchFS := &templateSearchFS{}
+	for _, source := range []templateSource{
+		{name: "project", dir: templateOverrideDir},
+		{name: "user", dir: getUserTemplateDir()},
+	} {
+		if Utils.DirExists(source.dir) {
+			source.fs = http.Dir(source.dir)
+			searchFS.sources = append(searchFS.sources, source)
+		}
+	}
+	searchFS.sources = append(searchFS.sources, templateSource{name: "built-in", fs: builtin})
+	return searchFS
+}
+
+// Returns the names of all the files with the given extension found in the search path, without their extension
+func listFiles(searchFS *templateSearchFS, ext string) []string {
+	set := make(map[string]bool)
+	for _, source := range searchFS.sources {
+		dir, err := source.fs.Open("/")
+		if err != nil {
+			continue
+		}
+		files, err := dir.Readdir(-1)
+		dir.Close()
+		if err != nil {
+			Utils.PrintFatal("Error listing %s templates: %s", source.name, err)
+		}
+		for _, file := range files {
+			if !file.IsDir() && strings.HasSuffix(file.Name(), ext) {
+				set[strings.TrimSuffix(file.Name(), ext)] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the content of the template with the given name, and the source it was found in
+func readTemplate(searchFS *templateSearchFS, name string) ([]byte, *templateSource) {
+	path := "/" + name + templateExt
+	source := searchFS.find(path)
+	if source == nil {
+		Utils.PrintFatal("Template not found: %s", name)
+	}
+	f, err := source.fs.Open(path)
+	if err != nil {
+		Utils.PrintFatal("%s", err)
+	}
+	defer f.Close()
+	content, err := ioutil.ReadAll(f)
+	if err != nil {
+		Utils.PrintFatal("Error reading template: %s", err)
+	}
+	return content, source
+}
+
+// Returns a hash of the templates used by the given flavor, which changes whenever they are upgraded or customized,
+// and the name of the source where the flavor's template was found
+func getTemplateHash(flavor string) (string, string) {
+	searchFS := newTemplateSearchFS()
+	content, source := readTemplate(searchFS, flavor)
+	builder, _ := readTemplate(searchFS, strings.TrimSuffix(builderTemplateName, templateExt))
+	return Utils.HashString(string(content) + string(builder)), source.name
+}
+
+// Parses the template for the given flavor, along with the shared templates it depends on
+func parseFlavorTemplate(flavor string) *template.Template {
+
+	searchFS := newTemplateSearchFS()
+	templateName := flavor + templateExt
+
+	source := searchFS.find("/" + templateName)
+	if source == nil {
+		Utils.PrintFatal("Template not found for flavor: %s", flavor)
+	}
+	if source.name != "built-in" {
+		Utils.PrintInfo("Using %s template %s", source.name, filepath.Join(source.dir, templateName))
+	}
+
+	// The builder stage is shared by all the templates
+	tmpls, err := fsutil.TmplParse(searchFS, nil, "/"+templateName, "/"+builderTemplateName)
+	if err != nil {
+		Utils.PrintFatal("Failed parsing templates: %s", err)
+	}
+	return tmpls
+}
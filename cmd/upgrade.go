@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"io/ioutil"
+	Utils "maru/utils"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+var upgradeDryRun bool
+
+// migration upgrades projects written by versions of Maru older than its version. Each migration can move keys
+// in the maru.yaml, edit the configuration, and update the project files (e.g. regenerate the Dockerfile).
+type migration struct {
+	version     string
+	description string
+
+	// Keys to move, as dotted paths from the old location to the new one, e.g. "build_args.TAG": "build_args.GIT_TAG"
+	moves map[string]string
+
+	// Updates the configuration after the keys are moved
+	config func(c *Utils.MaruConfig)
+
+	// Returns a preview of the changes made to the project files, or an empty string if there are none
+	preview func(c *Utils.MaruConfig) string
+
+	// Updates the project files
+	apply func(c *Utils.MaruConfig)
+}
+
+// All migrations, in order. The last one must be for Utils.SchemaVersion.
+var migrations = []migration{
+	{
+		version: "0.4.0",
+		description: "Dockerfiles share a common builder stage, and record how they were generated in " +
+			Utils.StateFile + " instead of a checksum comment",
+		preview: func(c *Utils.MaruConfig) string {
+			if c.TemplateArgs.Flavor == "" {
+				return ""
+			}
+			merged, _, _ := mergeDockerfile(renderDockerfile(c))
+			return diffDockerfile(merged)
+		},
+		apply: func(c *Utils.MaruConfig) {
+			if c.TemplateArgs.Flavor != "" {
+				updateDockerfile(c, renderDockerfile(c))
+			}
+		},
+	},
+}
+
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Upgrade a project created by an older version of Maru",
+	Long: `Runs the migrations needed to upgrade the project configuration and the Dockerfile to the current version of
+Maru, one version at a time. The changes made by each migration are shown before they are applied, and the version
+recorded in the maru.yaml is only updated once the migration succeeds. Use --dry-run to preview the changes without
+applying them.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		upgradeProject()
+	},
+}
+
+func init() {
+	upgradeCmd.Flags().BoolVar(&upgradeDryRun, "dry-run", false, "Show the changes without applying them")
+	rootCmd.AddCommand(upgradeCmd)
+}
+
+func upgradeProject() {
+
+	raw := readRawProjectConfig()
+	fileVersion, _ := raw["maru_version"].(string)
+
+	newer, err := Utils.CompareVersions(fileVersion, Utils.MaruVersion)
+	if err != nil {
+		Utils.PrintFatal("%s has an invalid maru_version: %s", Utils.ConfFile, err)
+	}
+	if newer > 0 {
+		Utils.PrintFatal("%s was written by Maru %s, which is newer than this version (%s). Please upgrade Maru.",
+			Utils.ConfFile, fileVersion, Utils.MaruVersion)
+	}
+
+	var pending []migration
+	for _, m := range migrations {
+		if isOlderVersion(fileVersion, m.version) {
+			pending = append(pending, m)
+		}
+	}
+
+	if len(pending) == 0 {
+		if isOlderVersion(fileVersion, Utils.MaruVersion) && !upgradeDryRun {
+			c := configFromRaw(raw)
+			c.MaruVersion = Utils.MaruVersion
+			Utils.WriteProjectConfig(c)
+		}
+		Utils.PrintSuccess("Project is up to date")
+		return
+	}
+
+	for _, m := range pending {
+
+		Utils.PrintInfo("\nUpgrading to Maru %s: %s", m.version, m.description)
+
+		current := configFromRaw(raw)
+		next := copyRaw(raw)
+		for from, to := range m.moves {
+			moveKey(next, from, to)
+		}
+		c := configFromRaw(next)
+		if m.config != nil {
+			m.config(c)
+		}
+
+		changed := false
+		if diff := diffConfig(current, c); diff != "" {
+			Utils.PrintDiff(diff)
+			changed = true
+		}
+		if m.preview != nil {
+			if diff := m.preview(c); diff != "" {
+				Utils.PrintDiff(diff)
+				changed = true
+			}
+		}
+		if !changed {
+			Utils.PrintMessage("No changes are needed for this project.")
+		}
+
+		if upgradeDryRun {
+			// Later migrations are previewed as if this one had been applied
+			raw = configToRaw(c)
+			fileVersion = m.version
+			continue
+		}
+		if changed && !Utils.AskForBool("Apply these changes?", true) {
+			Utils.PrintFatal("Upgrade aborted. The project remains at Maru %s.", Utils.GetConfigVersion(c))
+		}
+
+		// The version is set first, because the state of a regenerated Dockerfile records the whole configuration
+		c.MaruVersion = m.version
+		if m.apply != nil {
+			m.apply(c)
+		}
+		Utils.WriteProjectConfig(c)
+		Utils.PrintSuccess("Upgraded project to Maru %s", m.version)
+
+		fileVersion = m.version
+		raw = configToRaw(c)
+	}
+
+	if upgradeDryRun {
+		Utils.PrintInfo("\nThis was a dry run, nothing was changed.")
+		return
+	}
+
+	if isOlderVersion(fileVersion, Utils.MaruVersion) {
+		c := configFromRaw(raw)
+		c.MaruVersion = Utils.MaruVersion
+		Utils.WriteProjectConfig(c)
+	}
+}
+
+// Returns true if version a is older than version b. Both must be valid, as the version of the project is checked
+// before upgrading it.
+func isOlderVersion(a, b string) bool {
+	cmp, _ := Utils.CompareVersions(a, b)
+	return cmp < 0
+}
+
+// Returns the differences between two versions of the project configuration, as they would be written
+func diffConfig(old, new *Utils.MaruConfig) string {
+	a, err := yaml.Marshal(old)
+	if err != nil {
+		Utils.PrintFatal("%s", err)
+	}
+	b, err := yaml.Marshal(new)
+	if err != nil {
+		Utils.PrintFatal("%s", err)
+	}
+	return Utils.UnifiedDiff(string(a), string(b), "a/"+Utils.ConfFile, "b/"+Utils.ConfFile, 3)
+}
+
+// Reads the project configuration as generic YAML, so that keys from older versions can be migrated
+func readRawProjectConfig() map[interface{}]interface{} {
+	if !Utils.FileExists(Utils.ConfFile) {
+		Utils.PrintFatal("Current directory does not contain a Maru project configuration")
+	}
+	b, err := ioutil.ReadFile(Utils.ConfFile)
+	if err != nil {
+		Utils.PrintFatal("Error reading config file: %s", err)
+	}
+	return yamlToRaw(b)
+}
+
+// Parses YAML into generic maps
+func yamlToRaw(b []byte) map[interface{}]interface{} {
+	raw := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		Utils.PrintFatal("Error reading config file: %s", err)
+	}
+	return raw
+}
+
+// Converts the project configuration into generic maps
+func configToRaw(c *Utils.MaruConfig) map[interface{}]interface{} {
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		Utils.PrintFatal("%s", err)
+	}
+	return yamlToRaw(b)
+}
+
+// Converts generic maps into the project configuration
+func configFromRaw(raw map[interface{}]interface{}) *Utils.MaruConfig {
+	b, err := yaml.Marshal(raw)
+	if err != nil {
+		Utils.PrintFatal("%s", err)
+	}
+	c := &Utils.MaruConfig{}
+	if err := yaml.Unmarshal(b, c); err != nil {
+		Utils.PrintFatal("Error reading config file: %s", err)
+	}
+	return c
+}
+
+// Returns a deep copy of the generic maps
+func copyRaw(raw map[interface{}]interface{}) map[interface{}]interface{} {
+	b, err := yaml.Marshal(raw)
+	if err != nil {
+		Utils.PrintFatal("%s", err)
+	}
+	return yamlToRaw(b)
+}
+
+// Moves the value at the dotted path from to the dotted path to, creating any missing sections.
+// Does nothing if there is no value at the old path.
+func moveKey(raw map[interface{}]interface{}, from, to string) {
+
+	fromParts := strings.Split(from, ".")
+	parent := raw
+	for _, key := range fromParts[:len(fromParts)-1] {
+		child, ok := parent[key].(map[interface{}]interface{})
+		if !ok {
+			return
+		}
+		parent = child
+	}
+	last := fromParts[len(fromParts)-1]
+	value, ok := parent[last]
+	if !ok {
+		return
+	}
+	delete(parent, last)
+
+	toParts := strings.Split(to, ".")
+	parent = raw
+	for _, key := range toParts[:len(toParts)-1] {
+		child, ok := parent[key].(map[interface{}]interface{})
+		if !ok {
+			child = make(map[interface{}]interface{})
+			parent[key] = child
+		}
+		parent = child
+	}
+	parent[toParts[len(toParts)-1]] = value
+}
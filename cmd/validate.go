@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	Utils "maru/utils"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the project configuration for errors",
+	Long: `Checks the maru.yaml for unknown keys, values of the wrong type, and invalid settings such as a container name
+which can't be used by Docker or a missing setting required by the flavor. Each problem is reported with its line and
+column. Exits with a non-zero status if any problems are found, so that it can be used in a pre-commit hook.
+
+The same checks are run automatically before ^maru build^ and ^maru push^.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !Utils.FileExists(Utils.ConfFile) {
+			Utils.PrintFatal("Current directory does not contain a Maru project configuration")
+		}
+		doc := Utils.ReadConfigDocument()
+		errs := doc.CheckKeys()
+		if len(errs) == 0 {
+			// The configuration can only be decoded once its structure is valid
+			errs = validateProject(Utils.ReadProjectConfig(), doc)
+		}
+		if len(errs) > 0 {
+			printConfigErrors(errs)
+			os.Exit(1)
+		}
+		Utils.PrintSuccess("%s is valid", Utils.ConfFile)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
+
+// Checks the project configuration and quits if it's invalid
+func validateProjectOrExit(config *Utils.MaruConfig) {
+	if errs := validateProject(config, Utils.ReadConfigDocument()); len(errs) > 0 {
+		printConfigErrors(errs)
+		Utils.PrintFatal("Invalid project configuration")
+	}
+}
+
+// Prints the errors, ordered by their position in the file
+func printConfigErrors(errs []Utils.ConfigError) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Line != errs[j].Line {
+			return errs[i].Line < errs[j].Line
+		}
+		return errs[i].Column < errs[j].Column
+	})
+	for _, e := range errs {
+		Utils.PrintError("%s", e)
+	}
+}
+
+// Checks that the settings in the project configuration are valid, and returns any problems found. Nothing is looked
+// up in the repository, so ${git_commit} is only checked for errors.
+func validateProject(config *Utils.MaruConfig, doc *Utils.ConfigDocument) []Utils.ConfigError {
+
+	var errs []Utils.ConfigError
+	addError := func(path string, format string, a ...interface{}) {
+		errs = append(errs, doc.NewConfigError(path, format, a...))
+	}
+
+	if err := Utils.ValidateName(config.Name); err != nil {
+		addError("name", "Invalid name: %s", err)
+	}
+	if version, err := config.InterpolateOffline("${version}"); err != nil {
+		addError("version", "Invalid version: %s", err)
+	} else if err := Utils.ValidateVersion(version); err != nil {
+		addError("version", "Invalid version: %s", err)
+	}
+	for i, remote := range config.Remotes {
+		if remote, err := config.InterpolateOffline(remote); err != nil {
+			addError("remotes."+strconv.Itoa(i), "Invalid remote: %s", err)
+		} else if err := Utils.ValidateRemote(remote); err != nil {
+			addError("remotes."+strconv.Itoa(i), "Invalid remote: %s", err)
+		}
+	}
+	for i, platform := range config.Platforms {
+		if err := Utils.ValidatePlatform(platform); err != nil {
+			addError("platforms."+strconv.Itoa(i), "Invalid platform: %s", err)
+		}
+	}
+	for key, refs := range map[string][]string{"cache.from": config.Cache.From, "cache.to": config.Cache.To} {
+		for i, ref := range refs {
+			if ref, err := config.InterpolateOffline(ref); err != nil {
+				addError(key+"."+strconv.Itoa(i), "Invalid cache image: %s", err)
+			} else if err := Utils.ValidateImageRef(ref); err != nil {
+				addError(key+"."+strconv.Itoa(i), "Invalid cache image: %s", err)
+			}
+		}
+	}
+	for key, value := range config.BuildArgs {
+		if _, err := config.InterpolateOffline(value); err != nil {
+			addError("build_args."+key, "Invalid build argument %s: %s", key, err)
+		}
+	}
+	for key, value := range config.Labels {
+		if _, err := config.InterpolateOffline(value); err != nil {
+			addError("labels."+key, "Invalid label %s: %s", key, err)
+		}
+	}
+	for name, profile := range config.Profiles {
+		errs = append(errs, validateProfile(config, doc, name, profile)...)
+	}
+
+	flavor := config.TemplateArgs.Flavor
+	if flavor == "" {
+		if !Utils.FileExists(Utils.DockerFilePath) {
+			addError("template_args.flavor", "No flavor is set, so a custom Dockerfile is needed, but there is none")
+		}
+		return errs
+	}
+
+	searchFS := newTemplateSearchFS()
+	if strings.HasPrefix(flavor, "_") || searchFS.find("/"+flavor+templateExt) == nil {
+		addError("template_args.flavor", "Unknown flavor %s", flavor)
+		return errs
+	}
+
+	if err := Utils.ValidateRepoUrl(config.TemplateArgs.Build.RepoUrl); err != nil {
+		addError("template_args.build.repo_url", "Invalid Git URL: %s", err)
+	}
+
+	// Sections which are not built in must belong to a declarative flavor
+	definitions := loadFlavorDefinitions(searchFS)
+	for name := range config.TemplateArgs.Custom {
+		if definitions[name] == nil {
+			addError("template_args."+name, "Unknown key template_args.%s", name)
+		}
+	}
+	if definition := definitions[flavor]; definition != nil {
+		errs = append(errs, definition.validate(config, doc)...)
+	}
+
+	return errs
+}
+
+// Checks the settings which a profile overrides, in the same way as those at the top level
+func validateProfile(config *Utils.MaruConfig, doc *Utils.ConfigDocument, name string,
+	profile *Utils.MaruProfile) []Utils.ConfigError {
+
+	var errs []Utils.ConfigError
+	prefix := "profiles." + name + "."
+	addError := func(path string, format string, a ...interface{}) {
+		errs = append(errs, doc.NewConfigError(prefix+path, format, a...))
+	}
+	if profile == nil {
+		return errs
+	}
+
+	for i, remote := range profile.Remotes {
+		if remote, err := config.InterpolateOffline(remote); err != nil {
+			addError("remotes."+strconv.Itoa(i), "Invalid remote: %s", err)
+		} else if err := Utils.ValidateRemote(remote); err != nil {
+			addError("remotes."+strconv.Itoa(i), "Invalid remote: %s", err)
+		}
+	}
+	for i, tag := range profile.Tags {
+		if tag, err := config.InterpolateOffline(tag); err != nil {
+			addError("tags."+strconv.Itoa(i), "Invalid tag: %s", err)
+		} else if err := Utils.ValidateVersion(tag); err != nil {
+			addError("tags."+strconv.Itoa(i), "Invalid tag: %s", err)
+		}
+	}
+	if profile.Cache != nil {
+		for key, refs := range map[string][]string{"cache.from": profile.Cache.From, "cache.to": profile.Cache.To} {
+			for i, ref := range refs {
+				if ref, err := config.InterpolateOffline(ref); err != nil {
+					addError(key+"."+strconv.Itoa(i), "Invalid cache image: %s", err)
+				} else if err := Utils.ValidateImageRef(ref); err != nil {
+					addError(key+"."+strconv.Itoa(i), "Invalid cache image: %s", err)
+				}
+			}
+		}
+	}
+	for key, value := range profile.BuildArgs {
+		if _, err := config.InterpolateOffline(value); err != nil {
+			addError("build_args."+key, "Invalid build argument %s: %s", key, err)
+		}
+	}
+	return errs
+}
+
+// Checks the answers stored for the flavor against its questions. Questions which don't apply are skipped.
+func (d *flavorDefinition) validate(config *Utils.MaruConfig, doc *Utils.ConfigDocument) []Utils.ConfigError {
+	var errs []Utils.ConfigError
+	for i := range d.Questions {
+		q := &d.Questions[i]
+		if !d.isAsked(config, q) {
+			continue
+		}
+		path := d.answerPath(q)
+		value, _ := d.getAnswer(config, q)
+		if q.Required && value == "" {
+			errs = append(errs, doc.NewConfigError(path, "Missing %s, which is required by the %s flavor", path, d.name))
+		} else if err := q.check(value, d.name); err != nil {
+			errs = append(errs, doc.NewConfigError(path, "Invalid value for %s: %s", path, err))
+		}
+	}
+	return errs
+}
+
+func isBool(value string) bool {
+	_, err := strconv.ParseBool(value)
+	return err == nil
+}
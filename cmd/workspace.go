@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	Utils "maru/utils"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Reads the projects in the workspace containing the working directory, sorted so that every project comes after
+// the projects whose images it builds on. Returns the root directory of the workspace and the sorted projects.
+func loadWorkspace() (string, []*Utils.WorkspaceProject) {
+
+	root, hasFile := Utils.FindWorkspaceRoot()
+	dirs := Utils.GetWorkspaceDirs(root, hasFile)
+	if len(dirs) == 0 {
+		Utils.PrintFatal("No Maru projects were found in %s. List them in a %s to build them together.",
+			root, Utils.WorkspaceFile)
+	}
+	if hasFile {
+		Utils.PrintDebug("Using workspace %s", filepath.Join(root, Utils.WorkspaceFile))
+	}
+
+	var projects []*Utils.WorkspaceProject
+	for _, dir := range dirs {
+		p := &Utils.WorkspaceProject{Dir: dir}
+		ok := false
+		inProjectDir(root, p, func() {
+			ok = Utils.CatchFatal(func() bool {
+				p.Config = Utils.ReadWorkspaceProjectConfig()
+				p.FromImages = Utils.GetFromImages(readDockerfile())
+				return true
+			})
+		})
+		if !ok {
+			Utils.PrintFatal("Cannot read the project in %s", dir)
+		}
+		projects = append(projects, p)
+	}
+
+	Utils.ResolveDependencies(projects)
+	sorted, err := Utils.SortProjects(projects)
+	if err != nil {
+		Utils.PrintFatal("Cannot order the workspace: %s", err)
+	}
+	return root, sorted
+}
+
+// Runs fn in the directory of the given project, and changes back to the working directory afterwards
+func inProjectDir(root string, p *Utils.WorkspaceProject, fn func()) {
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		Utils.PrintFatal("%s", err)
+	}
+	if err = os.Chdir(filepath.Join(root, p.Dir)); err != nil {
+		Utils.PrintFatal("%s", err)
+	}
+	defer os.Chdir(cwd)
+
+	fn()
+}
+
+// Warns if the project was written by another version of Maru, naming the project's configuration file
+func checkProjectVersion(p *Utils.WorkspaceProject) {
+	if problem := Utils.GetConfigVersionProblem(p.Config); problem != "" {
+		Utils.PrintError("%s %s", filepath.Join(p.Dir, Utils.ConfFile), problem)
+	}
+}
+
+// Runs fn for each of the projects in turn, from within the project's directory. Stops at the first project for
+// which fn fails or exits with a fatal error, since the projects after it may depend on it.
+func forEachProject(root string, projects []*Utils.WorkspaceProject, fn func(p *Utils.WorkspaceProject) bool) {
+
+	for i, p := range projects {
+		Utils.PrintInfo("[%d/%d] %s (%s)", i+1, len(projects), p.Config.Name, p.Dir)
+		checkProjectVersion(p)
+		ok := false
+		inProjectDir(root, p, func() {
+			ok = Utils.CatchFatal(func() bool {
+				return fn(p)
+			})
+		})
+		if !ok {
+			var skipped []string
+			for _, s := range projects[i+1:] {
+				skipped = append(skipped, s.Dir)
+			}
+			if len(skipped) > 0 {
+				Utils.PrintFatal("Stopped because %s failed. Skipped: %s", p.Dir, strings.Join(skipped, ", "))
+			}
+			Utils.PrintFatal("%s failed", p.Dir)
+		}
+	}
+}
+
+// Returns the projects with the given names or directories
+func findProjects(projects []*Utils.WorkspaceProject, names []string) []*Utils.WorkspaceProject {
+
+	var found []*Utils.WorkspaceProject
+	for _, name := range names {
+		var match *Utils.WorkspaceProject
+		for _, p := range projects {
+			if p.Config.Name == name || p.Dir == filepath.Clean(name) {
+				match = p
+				break
+			}
+		}
+		if match == nil {
+			Utils.PrintFatal("There is no project called %s in the workspace", name)
+		}
+		found = append(found, match)
+	}
+	return found
+}
+
+// Returns the repositories of the images which are built by the given projects
+func getWorkspaceImages(projects []*Utils.WorkspaceProject) map[string]bool {
+	images := make(map[string]bool)
+	for _, p := range projects {
+		for _, image := range p.Images() {
+			images[image] = true
+		}
+	}
+	return images
+}
@@ -4,6 +4,6 @@ package main
 import "github.com/posener/gitfs/bin"
 
 func init() {
-	bin.Register("github.com/JaneliaSciComp/maru/templates", 1, "H4sIAAAAAAAA/+xX3U7cRhReJ7RSrSiN2t731EThAmwraaoiJKJSCIiEPy3QKkrRZnZ81p5lPOPOjDe7QXvR9Od9et2+Td8jVDPeZZeFEloVJRfcWOPx+T/f+Twzd/zTTc/7qKV3jVQkRe/4dc274X2wyjhq7/iXmje1wpT2jn+r1WrB8c9TnvdJTorn2igm0oPnByUTZt4J3vL8Wu3z41+nPO/jMZGmlNyqe7e8G7Xam8/mj197H36aE8NJs0FlXjCOSZRKszsNR0cQraHZw7zgxOCSSvVyhvRQlzn0+/40rEh6iKrFOEKKAhUxmECzB5tElU7bLr5DpZkUVuN2i7VZIydUSevizc0XV+DEn4ZdQ1IrVDKeQKmZSKs1KqBSGMIEKn+1vr0JbSKQM6Ips7nHA6mF+9GD6D4QPVTzl+prsLa+19hbWlvMiTaorB8XqCwNEDH0ZjIEKhP0v9+uP11Zr0Ns8iImReHX97cgZQYolwIhDJuKCJrB3YFZCMMEC5PBfZfUeD2ib63pqI6F3Fcc+n2I4AcfAODePYhLrWIuKeFxk4kqAyZaMtLZsLZOfVnmuQ2zqtCyQmIQWkwQDiwnKZ5bD9uvBfsIZYGinRyG875/dASsNRHhKmuzTdfXHV6mTKwwBWG/7y9v7zyDMGwpmS8OWzCsSHwmz/Os9PsQy8K4UGIrEFnVwn3X/tFRCCgS58uuLwjMPSuL/zmsMRvnReWQPQrqnxyd9Ahi33+8tVd/trO9vrUHzyEYGUVhVK+QTJhIZ8EcBKGzbldvC3CL5Aj9fgAH/u026ZBGTjoo3MRN/Xk9ce9m4laZqGK18gbaRM1Bk2hMQAq33xkUlFWvhczBtsBl0f0RQgUzUaFkG6mJiDKsRahZT2aDMJg92R/YmA2iNlHBjDUSdXMOj5wpYXFxkkbeGUHeEJWiiV9QYk4kXwApCmvnIr4gr0oevyp5eUIQCTYZEQtnKvqEdMimw+GTlaenwbPKutCSCkzGNKBSUi1AZkyhF+I4ZSYrmxGVeWwYEVLEiUNn2FT4cuAsZlqXqOOHX7liIc0kBBvLjaWNjUUUjf3daH9vNZwP4NEjiNHQGEWHKSlyFGZUj0ptTB4mtFzLMUpRTCptLG2tTXg6pUKlaI10qs3Q2hnT8S8mpUEvYPzlEuwyqsf0FxVaic4GKY0TzERGM5Y2IKTFKX9nx2TU1E3CxDInWtthCe5+E8xc5IRmuUxgtjshMEmGpznwwL9T9EwmRYNKkZCKz/665rP36wRhy8NEWeZMxjkTzPXqy4WH0Xz0oMKj2wFa6YcC8h6KDlStXTwT+Y7bX3Ydr9ajTp3Nc1x6BQsUCQrK0KEy7I0BsIqBIxEQhoaoJuFcj5HjYWJPMEX1l3fSljV07IJ1s11tEmpYhxiMkoHyNKybGQ0CKWpNVA+MBI0G9jZ3bDMtz6lSCIuol8xksMtEWnKimOnNQRMpKTWOeYWXjHNoIigkSSgF703wVbeQamh90ULFkc+lo7bfGx2itB2/CynIUcHVUU6gZakongrd0LhQ0g5ulFR70aVMVZUbJlkB7BKkV0EQzj8EjiOrjpwY1sFdqlhhdojJro717CEOu0hLQ5r27yPNmxt/XJPe+0V6mjIUhrUY5UyU3Vjzha/f6TRd9ge+ZqHBaPT4BGFXi+YD/46NrNUdu5Pc/P0aztd3kv/vTjLRTXc7aXX/xY3k+iD+tiH2arW/AwAA//9mlrTXqxQAAA==")
+	bin.Register("github.com/JaneliaSciComp/maru/templates", 1, "H4sIAAAAAAAA/+xbe3MbR3IXbV8eiMvOJfk/fUuGj4i7K8o+nwwVlKP5sGiRIgukfHZMER7sDoARd2dWM7MQYAqVuyRVqcr/9x3yHfJV8hnyEayrnp19AeBDPNt/uUoFEbsz3T093b9+zODuv727sPDXPXWshSR9uvDm93cW3ln4xS6LqFp48+93Ft7bZlItvPnPO3fuOG/+8N7Cwt/FJPlGacl4//k3z1PG9QMz8P2Fxp07//jmP95bWPiwMqQrRITTF95feOfOne+bf3jz+4UPP6AjGqSadCPq9YX+fuG/FmFbBOdU9lhEoU85lUTTELpjOCAyhYsL8PCPL6lUTHCYTBqNiwvQNE4ioik43ZRFIZUOeObdImxJii96jJMIWEz6tLHbPjwAFTDKNeuxIGI8Hfkqav6m0dg6PPoaXLcnRdyypMDXceKTJAH8mD/CDGW8J8BvNNrPngINBgKcxV/5Xcb9LlEDBx49Ap9yLceJYFx7agCnDQCA5eVs9AqS93GBJ3Y1m7KvvJ1SQ20aEc2GdGdEj4gewGQCztJvnZWrSAeDWIRwdzQ1oLHz9KT99dHh3tMT+Aac+kvneeODHnvBOjEJpDAb886nP9nGvCCcRoyogAUiTnwUpIkfrkgofxGeuw/MlrPelKJ22Qt2YAQ+itI+49tMgjuZXLmls+qeR2UyAV8k2oji4wAPpyaGi2pcXLhAeWh44d9XCGYIZxRvLVaFxjypzJaVQk0mNzDYKVsoiNaNYh0c11B31sG5TsCnJKYwmTjwvPFhxZTGJI6+XzgIqQokSzQTvAmoUDCE1+EV0wMgfAxWucA0cEpD1XiZUoXjVbPhwjkdN+2QTshkAyCRIk50E5zcRyBBD9EiI2/JNZ0GQEh7JI10E4xc9k1O1MhxM5pm6DySdgtqFDmJaZWk0Y/ogR7QCjUwzqUFyJTXCZvXHnsRNwAkfZkyScMmaJnSRkN2JOVD46bv/c8P7qZ7XGkSRUbSNiQkOCd9qoBxLYCAoglBhIaIdSWR4wxbpYFwX7pDKpszptJuo7jtUgQgqiB8EwhuLMIzRcF1h4SzKCKgBOgB0cZyUBdAUi0iQXAq40b0RIoXNNArCrx2IoVRD1PA+lxIGhrMjs9DhIwkcyuk49tVlXDazgy3wtulsMIyHXn5IlYdnO2sg6SJUC1noHWimr4fRCINPelaYTwh+87aCpzOx41MT/siOEdpLeJfLQiybTYlVVpIuhrZqS1nPqjMZeCs53vZcmYU4axbE27tbu4f76ytGMlppOgNRbOaWg1W0Sw+p7p9ZHUGk8naLVjz8Jpw8pa2WLe/fEPnmMTMkxsY7k2g+Etod/b3PjtuzTK4dWaR78hVZpCD3LEZ+uPmF/C88X7HKsDg1l89vLhAsGO8CkEYURfhWKQyKMAyECFdB8r0gEpw+kw7oAUEkeDUvDcex7SQ43UQEpxIBCRyoCckEDBfIGSSBjgC+mxIOWLjtzEml0YicF0z7NvGZvtzONhsP+scHz5rb+20+kyjoR1r0kdENYNTxXgfrMQQCK4J41TOzWTsqOaGd9/bQMxTZmUu0kVen++ddE42P2/FRGkqG4uwMyKBhkDEMdNmlQManINI9TrOThjnNATGAYX30Nk92OsBQ5CjcaLH60Yjliwwlakp9ApuW4cHB3snuKgtJC1SXejYgyPJhkRXNMqogoBw6FIgQUCVovn6CWhxTjkkxDwkypDpM93JnisaSKobi7BKeAjCBH4SRWMzJFVUYnhcMxvWHeNevSIyNIQ5HB8/BtKnXHvw1G47U2AALszB3WSPHpwMKAyE0hh4FYheYxGUGtQXQCSFIZWsx1DQPkFAMjTOuXjFOzhdWXnXAaVNuXkD2RucLilGEhp6jd8dtp9s77ULLzcO6rqxSLlu6XFCW5YSC1ulNq4YkOvisjFVITMXrA8sPJOOEiG12eTj48dmozefbrcc1Icr4FhLFujHQukndGz2nvF+a0wVuAJjq3yCjPC9wgqw5cuU+9lalF8RwrHslpdxK9H+e6wPrtuPRJdEEEgaYpFFIm9Ao4RKWPlVb3UNMOFQGtwe1AiXKnr9GuiIabj30OJdrpjW0mpA9Oy0QnH3H/khHfo8jSJDBWeP3MxeXUN8zcmJorm+EjK8jGgxfPIQeivlUlkPvgH3O3CWSidy4PlDtCNuh+E/oxJ0OXDdriQ8GMBS7o2uG9JED2ADZvD4M8QJr00T8UxGMJmABw8tVRNp6wwYZxrcl+DlmyBpLDQFEoYgJOszfgMOJcnlZbgwe9mjOhgg4VJSS66yalTx1GBN+sqOfAhTlHGoGwAJhyygXkg1CQY0fExJ2OoRXFqQw5D7ssYmX3+PGbASybgAKsB4a74Z2LagWoL8OrwasGCA8Kco1zk4GTBGg9V0pL2suRCTsVEbvi+z6MYidGmO8gaH8b2dWVLnKxoSInU1UHlvFQeM/LOYYpIGDzwDLjJGr/EM4ldEbCyC2dOCs+1xGF24SxeVMDZBjlaEMsTtH25t7nfaO1/uHe8dPjWs/FRJ38iUNTHyNKUW/jNX4OAszSFT+kTmb/tILAuWTZg/ATONgtND6DGweaJZ3paIY8TkyaRa4P7yBRmS3qgTkyHlWYn5zmmtxPyCDMnuV0CSJGIBwehjN9PUmwc4DwP7gEisbDRaitaM91VWkCL9jHpD0QCnN6vPKqXpYs6KKRA8GgMZEhZheysPVf+aRmmWnioMdPDF9hN4kFefL8LzzjBLRRsACOlNUDSiga7WjjjFjjJFYhZPVRO+cR44z6tVo/PAma0XLS9UQNjB5ILwsEr+M+sZ5sVUFTrkeaHWAEBIb8LvjHfZ4aAGIo1CTBFkytFXDBsYi1Qau/wXQ04TFqkmvDaoczLAOkzhcllgsgIC8ZAXHmoIr0M31UjGZCDBgDAOwiQD2TClaaJsNnK2vHzmlQU9450gIkpV13iA83e/AvOivkYh+148JkniHYy37LwpDf5tMtYDwTuB4CEx+etf/N9P1h5D4GE8TWMm/JhxZoT4qPmx98C7jySXKB+ejBMKzZYpsI6MrDt8yKTgMeXavCx7VfRlOcUxxJy3b09lTLZwtldhhbkDBjAzkZbPvXEcGYwx/AAr9iBbrsshHuN3tzd3FpzWKs55a7CbhXzUj7SUKgtPj3QVjcplTS/JIpnRUlatIkMk6o7h9GZrsbBrakPDxad8qHzDwMB0whKwRTa4LhdugDHWNZ0Nu+wqUZQ+1+kMsFqJLtfPEUsq5fufJZxVTp1iXTJL3io3ooSbdEN2SRTl6fDy8lQbZ0YOqgP7kATaVDheaCcvwh7WTpxisohtHy0wEsDJwRFm+QjXMuUccwETF44Z76cRkQxLrS4NSKpohSu8YlFkoJCS0MVwkIuYhUObo2fUW7g1Djx6C6lRu50hkQr7+T9E92GeBSZj26xy5vQD7SsMmTTqrQOJRK4bfB3ShPKQ8gALr5AGEbE1G9MKCsKeFhYNbmU4ZmkVK7ltk8SxiWNVCB34tlfohdkz70akzFDIdypDtOunrWRhBa7HpZ+4V/PLWrwzCdYvaC3BykABbJsJQz/jQGArh/ccRee08StvOxg8q2F6pvFeGWx65SZ0Z3nIY/Eqzz7Q9qxE1QldaiE5nJuFUOhSpSGRuG8BNSmJyLsvhMNZhRYGsLN1OJuG0jNsYZzVTfus6OqbLMhwK1oSRXmSY0WKDRTs9RhJMXuu6g/CFA9TywrGg31Khtj6Yrbpg0lXxGxTwzDLdqHmjOhLlIReA2BIIhYSTZuwcrb0+tRbHcfRa9zj13qk15Zer5699teKFZ0ab11aaQBQKYVsQiVGZgstU8A5BgCrqLq1dZjWHCqurrfGIpyUG2kTXtOSCQaEcxplzZysa2hOiOfwQ265pVkrtpSqdlbnUc8HnY+8T+Zk0XXFnYZ3V0+90/Du2sW99fuTqn72uBk4tY4GwKsB5U2zQRV5jQvkW6FH+lL92zXlqijKBdz66tJ2Rlrmein0tkq9vofFb0jcnpB9uub8UAJVzexSobartqhFAe0mqmayZiIOfp2MW/e9B969m0hYCJGwpJO37i8VYjMMGRZOJCoOn2ZkwbiTSaJZr4eqeNS6f+/+Pe9T76M1J2eXwV4nIXpwJXphLWIH120MX3jJeNbKPizLTFvY/nGmsL26rJ0F3D+7yPwED4B/gx8P8GNjw3x+ZD4/vkEBWq8cLZO8bYJ8SwTJ0dBkKcb3MbZcW00aMMVkbPO7NFpRWdGNlEOGt1G6qbYcDxPKv9h+4v1cFOdF8S0r4loLBivid/77B6+IdxkPi8in4QWR69AlaCEi663kpmRbLYmITUQyGeHoJbgSVjwLWx6RmvVIoPfCu47r3C2eWxp3He8Fkc4KJCL2RnEEjwwp02Iu8ql4WNaRmsg+1f632J3OR36Lrol0rqrnp5qD36VR6vZGsyeV2FgyLu19sf2kqrSrEn/fCgDVL9cXArc+aEQzADdIavzgirWgzRmb+vES2OeNv4+JjkgX/TphEQ1Ny+Yv/+kna9mEtMsIb3ZTPNdzVcTi6ULqYPNkf/MzaKdcs5hCTHQwyPM8SSNKVCUzzFZRtnpxs0ii3T7VkCaYkpQay5/nUc0dZ10B+92VFLGE8hCP9tyAoldgixSP+lIZQcq/Y4klh/8i1h3pT8x/NP9DYiyXG+ahVvYhy/6LU/N/P0o33JgqUkqWlenGUONAls8NW1ft5x2BA7N3VjPP2vtoKK4oJvpxIL1SxuVlK7L7cnaIG87hV4wqVBTjqYJCH9bgkr6k9ETss4ByRcEckYUYUrnpI++KzHuwaKyRjTi4Cpyl1R6iVvHejRnPj1PcmIyKvzEOQwivYUBJCO7GmlNM8oNUShSmII6nANI2yJCrPyQSLyb4JNE+ZoDK/+drgGHGJzM9b+Uukv+R3zS7UQPBpuzSmnF2byE/dcUGCB6vZFaM1mvvNWT5EXZX8GHupMa214urPXpAxxAKvoLHyIxrKntU0izTUWOlaQxaiEh5l/RwDrbana3Nrcc7nfbh4cnVvRxz4pN1c1CigYhp5dIAnhJxoYGOsMoiNiYZd5/t+Hi3hlIUGEVtTZvBlQiZzbWdpf1tvEnS3mx/3TnaPHncWspp+naH/H7ER+STj5vlGwT72adqrHyh5rygI00lr85auphi27zbXJp6NLn5Gr7aPDrab+8cb++1K/J/tbGBVuzaHEXdnF7dDlpLF/UHTXfpImvINV30lQl6bcf0UDtLqywEN127ifRFE3KpTv8GU2/knhg3d1NuDqN+1N7PP0zHTlOGvPe/tTLEhi/02NJ/jWvGQbCOjlY2Beuhbk59Ym2zY+NeLUOtzc0jYz1bbWN91r2u6rBT86qjLlQlYbdBobxqUlzxuSxpj1OlswBepXxZEC9qgExBZ3EQnK2DqTjPspWceWCItzMKKjvvbt+/t/EpAcHxpkyGrypN0OtpWKT5uSazpOAKRdqsgadxl8q6Op17zi2KoxtVQTM6uEylOQWZcpXvgxTCHLWbydV2mtEdsWW2ba5hBaWMcsGNz/KeGdO2Y8Z6ZbPMCoXLCU0PEJkzjb9B0GKaW6HpfNa1N4dRBJHqJNVlRKkr3LvKdDHk4QHoTKBEtfZEysOraslBNYxZQ86zTCuU6BVqKm7ZXaUBbNvZpmpmpt1x2ZzMNy67mVX+1AMG9hKGwnIKK6X8VgYWptCzuFZoF5928qdV9R5UhxtCdV3ixFl1flhKYpoqb/6/BmblDy5soVlcMLF3D9HAjLfG5HwegN2qiYCk7Hw6otf3kpCJrui0Tg7jcSJFX5I5F8Y/qDSVsBJ6948/l+o3KtXJd2mUFej5T1FsZXdFgTtVrC/CLhvZXBc79lmPOL8f3md6kHa9QMS+ZoQL7ofmjo/blfSVZeYzpVKq/I9/XUkt97c6m/v7Lco7z469Zye77gObYeqgeoIOp1MnkOV4mJplLv5Qr0/59KT9zaefT3GqTQkE75Vzsocu0qnM+blrcX3X4m/s7zoQor5/97CGUW0b3+wvZor+tb35b05DcPK89KrS/C3hJXfIOox87N3zProqHk01cNuVIJ9nOm/XsEVsOKte2T+zlVVeHmZXti3PIkLkv3S4HjdRK+audH2lxeOpxVV+8RIKqsqV2PM0EPx2h4kFw6njwTK01mpfoOYuuBUm17nKYi5mf8XOv+UJYbG84kjQqjR/cen5ydFlhya4NHtqEibRWP52w7vn3YcuE0GzGbE4JlOHObXdq5/k/DBHK+1ZG164c+dPAwCLr8Lk8zoAAA==")
 
 }
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/builder/dockerignore"
+	"github.com/docker/docker/pkg/fileutils"
+)
+
+// DockerIgnoreFile lists the files which are left out of the build context
+const DockerIgnoreFile = ".dockerignore"
+
+// ContextDockerfilePath is where the Dockerfile is added to the build context. It doesn't replace any Dockerfile in
+// the directory, which may be the source code of the project for local builds.
+const ContextDockerfilePath = ".maru.Dockerfile"
+
+// WriteBuildContext writes a tar archive of the given directory to w, leaving out the files excluded by its
+// .dockerignore, in the same way as `docker build`. The given Dockerfile is added as ContextDockerfilePath.
+func WriteBuildContext(w io.Writer, dir string, dockerfile string) error {
+
+	matcher, err := readDockerIgnore(dir)
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(w)
+
+	// The Dockerfile is always sent, even if it's excluded, because the daemon needs it
+	err = tw.WriteHeader(&tar.Header{
+		Name:     ContextDockerfilePath,
+		Mode:     0644,
+		Size:     int64(len(dockerfile)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(tw, dockerfile); err != nil {
+		return err
+	}
+
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." || rel == ContextDockerfilePath {
+			return err
+		}
+
+		if rel != DockerIgnoreFile {
+			excluded, err := matcher.Matches(rel)
+			if err != nil {
+				return err
+			}
+			if excluded {
+				// Files in an excluded directory may be included again by a pattern starting with !
+				if info.IsDir() && !matcher.Exclusions() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		return addToContext(tw, path, filepath.ToSlash(rel), info)
+	})
+	if err != nil {
+		return fmt.Errorf("error creating build context: %s", err)
+	}
+
+	return tw.Close()
+}
+
+// Returns a matcher for the patterns in the .dockerignore of the given directory, which is empty if there is none
+func readDockerIgnore(dir string) (*fileutils.PatternMatcher, error) {
+
+	var patterns []string
+	f, err := os.Open(filepath.Join(dir, DockerIgnoreFile))
+	if err == nil {
+		patterns, err = dockerignore.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %s", DockerIgnoreFile, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	matcher, err := fileutils.NewPatternMatcher(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern in %s: %s", DockerIgnoreFile, err)
+	}
+	return matcher, nil
+}
+
+// Adds a file, directory or symbolic link to the build context. Ownership is reset, as `docker build` does.
+func addToContext(tw *tar.Writer, path string, name string, info os.FileInfo) error {
+
+	link := ""
+	if info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(path); err != nil {
+			return err
+		}
+	}
+
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() && !strings.HasSuffix(name, "/") {
+		header.Name += "/"
+	}
+	header.Uid, header.Gid = 0, 0
+	header.Uname, header.Gname = "", ""
+
+	if err = tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Files of the source directory used by the build context tests
+var contextTestFiles = []string{
+	".git/config",
+	"Dockerfile",
+	"build/out.bin",
+	"docs/README.md",
+	"docs/keep.md",
+	"src/main.go",
+	"src/main_test.go",
+}
+
+// Returns the names of the regular files in a tar archive, and the content of the Dockerfile added by Maru
+func readContext(t *testing.T, archive []byte) ([]string, string) {
+	var names []string
+	dockerfile := ""
+	tr := tar.NewReader(bytes.NewReader(archive))
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			break
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		names = append(names, header.Name)
+		if header.Name == ContextDockerfilePath {
+			content, _ := ioutil.ReadAll(tr)
+			dockerfile = string(content)
+		}
+		if header.Uid != 0 || header.Gid != 0 {
+			t.Errorf("%s is owned by %d:%d, want root", header.Name, header.Uid, header.Gid)
+		}
+	}
+	sort.Strings(names)
+	return names, dockerfile
+}
+
+func TestWriteBuildContext(t *testing.T) {
+	tests := []struct {
+		name         string
+		dockerignore string
+		want         []string
+	}{
+		{
+			name: "no .dockerignore",
+			want: []string{".git/config", ".maru.Dockerfile", "Dockerfile", "build/out.bin", "docs/README.md",
+				"docs/keep.md", "src/main.go", "src/main_test.go"},
+		},
+		{
+			name:         "excluded directories",
+			dockerignore: ".git\nbuild/\n",
+			want: []string{".dockerignore", ".maru.Dockerfile", "Dockerfile", "docs/README.md", "docs/keep.md",
+				"src/main.go", "src/main_test.go"},
+		},
+		{
+			name:         "wildcards",
+			dockerignore: "**/*_test.go\n*.md\n",
+			want: []string{".dockerignore", ".git/config", ".maru.Dockerfile", "Dockerfile", "build/out.bin",
+				"docs/README.md", "docs/keep.md", "src/main.go"},
+		},
+		{
+			name:         "exception in an excluded directory",
+			dockerignore: "docs\n!docs/keep.md\n",
+			want: []string{".dockerignore", ".git/config", ".maru.Dockerfile", "Dockerfile", "build/out.bin",
+				"docs/keep.md", "src/main.go", "src/main_test.go"},
+		},
+		{
+			name:         "comments and everything but the sources",
+			dockerignore: "# only the sources are needed\n*\n!src\n",
+			want:         []string{".dockerignore", ".maru.Dockerfile", "src/main.go", "src/main_test.go"},
+		},
+		{
+			name:         "the Dockerfile of Maru is always sent",
+			dockerignore: ".maru.Dockerfile\nDockerfile\n",
+			want: []string{".dockerignore", ".git/config", ".maru.Dockerfile", "build/out.bin", "docs/README.md",
+				"docs/keep.md", "src/main.go", "src/main_test.go"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "maru-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			for _, name := range contextTestFiles {
+				path := filepath.Join(dir, filepath.FromSlash(name))
+				os.MkdirAll(filepath.Dir(path), 0755)
+				if err = ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.dockerignore != "" {
+				ioutil.WriteFile(filepath.Join(dir, DockerIgnoreFile), []byte(tt.dockerignore), 0644)
+			}
+
+			var archive bytes.Buffer
+			if err = WriteBuildContext(&archive, dir, "FROM scratch\n"); err != nil {
+				t.Fatalf("WriteBuildContext() error = %v", err)
+			}
+			names, dockerfile := readContext(t, archive.Bytes())
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("WriteBuildContext() files = %q, want %q", names, tt.want)
+			}
+			if dockerfile != "FROM scratch\n" {
+				t.Errorf("%s = %q, want the given Dockerfile", ContextDockerfilePath, dockerfile)
+			}
+		})
+	}
+}
+
+func TestWriteBuildContextReplacesDockerfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maru-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, ContextDockerfilePath), []byte("FROM old\n"), 0644)
+
+	var archive bytes.Buffer
+	if err = WriteBuildContext(&archive, dir, "FROM scratch\n"); err != nil {
+		t.Fatalf("WriteBuildContext() error = %v", err)
+	}
+	names, dockerfile := readContext(t, archive.Bytes())
+	if strings.Join(names, " ") != ContextDockerfilePath || dockerfile != "FROM scratch\n" {
+		t.Errorf("WriteBuildContext() = %q with %q, want only the given Dockerfile", names, dockerfile)
+	}
+}
+
+func TestWriteBuildContextInvalidPattern(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maru-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, DockerIgnoreFile), []byte("[\n"), 0644)
+
+	var archive bytes.Buffer
+	err = WriteBuildContext(&archive, dir, "FROM scratch\n")
+	if err == nil || !strings.Contains(err.Error(), "invalid pattern in .dockerignore") {
+		t.Errorf("WriteBuildContext() error = %v, want an invalid pattern", err)
+	}
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	controlapi "github.com/moby/buildkit/api/services/control"
+)
+
+// BuildKit reports the progress of a build through the Engine API as protobuf encoded StatusResponse messages,
+// in the aux field of messages with the ID moby.buildkit.trace.
+
+// BuildKitTraceID is the ID of the messages carrying BuildKit progress
+const BuildKitTraceID = "moby.buildkit.trace"
+
+// buildProgress prints the progress of a BuildKit build in the same format as `docker build --progress=plain`
+type buildProgress struct {
+	out      io.Writer
+	vertexes map[string]*buildVertex
+	count    int
+}
+
+// buildVertex is one step of the build
+type buildVertex struct {
+	index     int
+	name      string
+	started   time.Time
+	printed   bool
+	completed bool
+}
+
+func newBuildProgress(out io.Writer) *buildProgress {
+	return &buildProgress{out: out, vertexes: make(map[string]*buildVertex)}
+}
+
+// Prints the progress described by an encoded StatusResponse
+func (p *buildProgress) handleTrace(msg []byte) error {
+	var status controlapi.StatusResponse
+	if err := proto.Unmarshal(msg, &status); err != nil {
+		return fmt.Errorf("cannot decode the build progress: %s", err)
+	}
+	for _, vertex := range status.Vertexes {
+		p.handleVertex(vertex)
+	}
+	for _, log := range status.Logs {
+		p.handleLog(log)
+	}
+	return nil
+}
+
+func (p *buildProgress) handleVertex(vertex *controlapi.Vertex) {
+
+	v := p.vertex(vertex.Digest.String())
+	if vertex.Name != "" {
+		v.name = vertex.Name
+	}
+	if vertex.Started != nil {
+		v.started = *vertex.Started
+	}
+	if (vertex.Started != nil || vertex.Cached) && !v.printed {
+		p.printHeader(v)
+	}
+	if vertex.Completed != nil && !v.completed {
+		v.completed = true
+		switch {
+		case vertex.Error != "":
+			fmt.Fprintf(p.out, "#%d ERROR: %s\n", v.index, vertex.Error)
+		case vertex.Cached:
+			fmt.Fprintf(p.out, "#%d CACHED\n", v.index)
+		default:
+			fmt.Fprintf(p.out, "#%d DONE %.1fs\n", v.index, vertex.Completed.Sub(v.started).Seconds())
+		}
+		fmt.Fprintln(p.out)
+	}
+}
+
+func (p *buildProgress) handleLog(log *controlapi.VertexLog) {
+	v := p.vertex(log.Vertex.String())
+	if !v.printed {
+		p.printHeader(v)
+	}
+	for _, line := range strings.Split(strings.TrimRight(string(log.Msg), "\n"), "\n") {
+		fmt.Fprintf(p.out, "#%d %s\n", v.index, line)
+	}
+}
+
+// Returns the step with the given digest, numbering it if it wasn't seen before
+func (p *buildProgress) vertex(digest string) *buildVertex {
+	v, ok := p.vertexes[digest]
+	if !ok {
+		p.count++
+		v = &buildVertex{index: p.count}
+		p.vertexes[digest] = v
+	}
+	return v
+}
+
+func (p *buildProgress) printHeader(v *buildVertex) {
+	v.printed = true
+	fmt.Fprintf(p.out, "#%d %s\n", v.index, v.name)
+}
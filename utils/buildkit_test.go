@@ -0,0 +1,110 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	controlapi "github.com/moby/buildkit/api/services/control"
+	"github.com/opencontainers/go-digest"
+)
+
+// Returns the state of one step of the build
+func vertex(dgst, name string, started, completed *time.Time) *controlapi.Vertex {
+	return &controlapi.Vertex{Digest: digest.Digest(dgst), Name: name, Started: started, Completed: completed}
+}
+
+// Returns the output of one step of the build
+func vertexLog(dgst, output string) *controlapi.VertexLog {
+	return &controlapi.VertexLog{Vertex: digest.Digest(dgst), Msg: []byte(output)}
+}
+
+func TestBuildProgress(t *testing.T) {
+	started := time.Unix(100, 0)
+	completed := time.Unix(102, 500000000)
+	cached := vertex("a", "[2/2] RUN make", nil, &completed)
+	cached.Cached = true
+	failed := vertex("a", "RUN make", &started, &completed)
+	failed.Error = "exit code: 2"
+
+	tests := []struct {
+		name     string
+		statuses []*controlapi.StatusResponse
+		want     string
+	}{
+		{
+			name: "started and completed",
+			statuses: []*controlapi.StatusResponse{
+				{Vertexes: []*controlapi.Vertex{vertex("a", "[1/2] FROM ubuntu", &started, nil)}},
+				{Vertexes: []*controlapi.Vertex{vertex("a", "[1/2] FROM ubuntu", &started, &completed)}},
+			},
+			want: "#1 [1/2] FROM ubuntu\n#1 DONE 2.5s\n\n",
+		},
+		{
+			name:     "cached",
+			statuses: []*controlapi.StatusResponse{{Vertexes: []*controlapi.Vertex{cached}}},
+			want:     "#1 [2/2] RUN make\n#1 CACHED\n\n",
+		},
+		{
+			name:     "error",
+			statuses: []*controlapi.StatusResponse{{Vertexes: []*controlapi.Vertex{failed}}},
+			want:     "#1 RUN make\n#1 ERROR: exit code: 2\n\n",
+		},
+		{
+			name: "logs",
+			statuses: []*controlapi.StatusResponse{{
+				Vertexes: []*controlapi.Vertex{vertex("a", "RUN make", &started, nil)},
+				Logs:     []*controlapi.VertexLog{vertexLog("a", "line one\nline two\n")},
+			}},
+			want: "#1 RUN make\n#1 line one\n#1 line two\n",
+		},
+		{
+			name: "steps are numbered in the order they are seen",
+			statuses: []*controlapi.StatusResponse{
+				{Vertexes: []*controlapi.Vertex{vertex("a", "first", &started, nil), vertex("b", "second", &started, nil)}},
+				{Vertexes: []*controlapi.Vertex{vertex("b", "second", &started, &completed)}},
+			},
+			want: "#1 first\n#2 second\n#2 DONE 2.5s\n\n",
+		},
+		{
+			name: "completed only once",
+			statuses: []*controlapi.StatusResponse{
+				{Vertexes: []*controlapi.Vertex{vertex("a", "RUN make", &started, &completed)}},
+				{Vertexes: []*controlapi.Vertex{vertex("a", "RUN make", &started, &completed)}},
+			},
+			want: "#1 RUN make\n#1 DONE 2.5s\n\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			progress := newBuildProgress(&out)
+			for _, status := range tt.statuses {
+				trace, err := status.Marshal()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := progress.handleTrace(trace); err != nil {
+					t.Fatalf("handleTrace() error = %v", err)
+				}
+			}
+			if out.String() != tt.want {
+				t.Errorf("output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildProgressInvalid(t *testing.T) {
+	trace, err := (&controlapi.StatusResponse{Vertexes: []*controlapi.Vertex{vertex("a", "RUN make", nil, nil)}}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, msg := range map[string][]byte{"truncated": trace[:len(trace)-3], "invalid wire type": {1<<3 | 7}} {
+		t.Run(name, func(t *testing.T) {
+			if err := newBuildProgress(&bytes.Buffer{}).handleTrace(msg); err == nil {
+				t.Errorf("handleTrace() succeeded, want an error")
+			}
+		})
+	}
+}
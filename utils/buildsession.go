@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/auth"
+	"github.com/moby/buildkit/session/secrets/secretsprovider"
+	"github.com/moby/buildkit/session/sshforward/sshprovider"
+	"google.golang.org/grpc"
+)
+
+// Registry which BuildKit asks for the credentials of Docker Hub
+const dockerHubRegistryHost = "registry-1.docker.io"
+
+// Opens a BuildKit session for a build through the Engine API, which gives the builder the secrets, SSH agents and
+// registry credentials of this machine, in the same way as `docker build` does. Returns the ID of the session, which
+// is passed to the build, and a function which closes the session after the build.
+func startBuildSession(cli *client.Client, b ImageBuild) (string, func(), error) {
+
+	var attachables []session.Attachable
+	attachables = append(attachables, &registryAuthProvider{})
+	if len(b.Secrets) > 0 {
+		var sources []secretsprovider.Source
+		for _, secret := range b.Secrets {
+			source, err := parseSecret(secret)
+			if err != nil {
+				return "", nil, err
+			}
+			sources = append(sources, source)
+		}
+		store, err := secretsprovider.NewStore(sources)
+		if err != nil {
+			return "", nil, err
+		}
+		attachables = append(attachables, secretsprovider.NewSecretProvider(store))
+	}
+	if len(b.SSH) > 0 {
+		var configs []sshprovider.AgentConfig
+		for _, s := range b.SSH {
+			configs = append(configs, parseSSH(s))
+		}
+		provider, err := sshprovider.NewSSHAgentProvider(configs)
+		if err != nil {
+			return "", nil, err
+		}
+		attachables = append(attachables, provider)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := session.NewSession(ctx, "maru", "")
+	if err != nil {
+		cancel()
+		return "", nil, err
+	}
+	for _, a := range attachables {
+		s.Allow(a)
+	}
+
+	go func() {
+		// The session is served over a connection which the daemon hijacks, until it's closed
+		err := s.Run(ctx, func(ctx context.Context, proto string, meta map[string][]string) (net.Conn, error) {
+			return cli.DialHijack(ctx, "/session", proto, meta)
+		})
+		if err != nil {
+			PrintDebug("BuildKit session ended: %s", err)
+		}
+	}()
+	return s.ID(), func() {
+		s.Close()
+		cancel()
+	}, nil
+}
+
+// ParseSecretOptions parses a BuildKit secret such as id=git_token,env=GITHUB_TOKEN into its options
+func ParseSecretOptions(secret string) map[string]string {
+	options := make(map[string]string)
+	for _, option := range strings.Split(secret, ",") {
+		if s := strings.SplitN(option, "=", 2); len(s) == 2 {
+			options[strings.TrimSpace(s[0])] = strings.TrimSpace(s[1])
+		}
+	}
+	return options
+}
+
+// Parses a secret in the format of `docker build --secret`, e.g. id=git_token,env=GITHUB_TOKEN or
+// id=known_hosts,src=known_hosts. Without a source, the secret is taken from the environment variable or file
+// named like its ID.
+func parseSecret(secret string) (secretsprovider.Source, error) {
+	var source secretsprovider.Source
+	kind := "file"
+	for key, value := range ParseSecretOptions(secret) {
+		switch strings.ToLower(key) {
+		case "type":
+			if value != "file" && value != "env" {
+				return source, fmt.Errorf("unsupported secret type %s in %s", value, secret)
+			}
+			kind = value
+		case "id":
+			source.ID = value
+		case "source", "src":
+			source.FilePath = value
+		case "env":
+			source.Env = value
+		default:
+			return source, fmt.Errorf("unexpected key %s in secret %s", key, secret)
+		}
+	}
+	if source.ID == "" {
+		return source, fmt.Errorf("secret %s has no id", secret)
+	}
+	if kind == "env" && source.Env == "" {
+		source.Env, source.FilePath = source.FilePath, ""
+	}
+	return source, nil
+}
+
+// Parses an SSH agent in the format of `docker build --ssh`, e.g. default, or default=/path/to/key,/path/to/agent
+func parseSSH(s string) sshprovider.AgentConfig {
+	parts := strings.SplitN(s, "=", 2)
+	config := sshprovider.AgentConfig{ID: parts[0]}
+	if len(parts) == 2 {
+		config.Paths = strings.Split(parts[1], ",")
+	}
+	return config
+}
+
+// registryAuthProvider gives BuildKit the credentials saved by `docker login`, to pull private base images and to
+// import the build cache
+type registryAuthProvider struct {
+	auth.UnimplementedAuthServer
+}
+
+func (p *registryAuthProvider) Register(server *grpc.Server) {
+	auth.RegisterAuthServer(server, p)
+}
+
+func (p *registryAuthProvider) Credentials(ctx context.Context, req *auth.CredentialsRequest) (*auth.CredentialsResponse, error) {
+	registry := req.Host
+	if registry == dockerHubRegistryHost {
+		registry = "docker.io"
+	}
+	creds, err := getRegistryCredentials(registry)
+	if err != nil {
+		return nil, err
+	}
+	if creds.IdentityToken != "" {
+		return &auth.CredentialsResponse{Secret: creds.IdentityToken}, nil
+	}
+	return &auth.CredentialsResponse{Username: creds.Username, Secret: creds.Password}, nil
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/moby/buildkit/session/secrets/secretsprovider"
+	"github.com/moby/buildkit/session/sshforward/sshprovider"
+)
+
+func TestParseSecret(t *testing.T) {
+	tests := []struct {
+		secret  string
+		want    secretsprovider.Source
+		wantErr bool
+	}{
+		{secret: "id=git_token,env=GITHUB_TOKEN", want: secretsprovider.Source{ID: "git_token", Env: "GITHUB_TOKEN"}},
+		{secret: "id=known_hosts,src=known_hosts", want: secretsprovider.Source{ID: "known_hosts", FilePath: "known_hosts"}},
+		{secret: "id=token,source=/run/token", want: secretsprovider.Source{ID: "token", FilePath: "/run/token"}},
+		{secret: "type=env,id=token,src=TOKEN", want: secretsprovider.Source{ID: "token", Env: "TOKEN"}},
+		{secret: "type=file,id=token", want: secretsprovider.Source{ID: "token"}},
+		{secret: "id = token , env = TOKEN", want: secretsprovider.Source{ID: "token", Env: "TOKEN"}},
+		{secret: "env=TOKEN", wantErr: true},
+		{secret: "type=ssh,id=token", wantErr: true},
+		{secret: "id=token,required=true", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.secret, func(t *testing.T) {
+			got, err := parseSecret(tt.secret)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseSecret() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("parseSecret() = %+v, %v, want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSSH(t *testing.T) {
+	tests := []struct {
+		ssh  string
+		want sshprovider.AgentConfig
+	}{
+		{ssh: "default", want: sshprovider.AgentConfig{ID: "default"}},
+		{ssh: "default=/home/me/.ssh/id_rsa", want: sshprovider.AgentConfig{ID: "default", Paths: []string{"/home/me/.ssh/id_rsa"}}},
+		{ssh: "github=/a,/b", want: sshprovider.AgentConfig{ID: "github", Paths: []string{"/a", "/b"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ssh, func(t *testing.T) {
+			if got := parseSSH(tt.ssh); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSSH() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
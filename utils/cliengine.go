@@ -0,0 +1,394 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+)
+
+// cliEngine runs an engine whose command line interface is compatible with the docker CLI
+type cliEngine struct {
+	name string
+	// Command used for everything except builds
+	command string
+	// Command used for builds, which differs for Buildah
+	buildCommand string
+	// Whether the container user is mapped to the current user in rootless mode, so that files written to
+	// mounted directories are owned by the current user, as they would be with Docker
+	keepUserNamespace bool
+	// Whether multi-platform builds are stored as manifest lists, as by Podman and Buildah, instead of as a single
+	// image for several platforms, as by containerd
+	manifestLists bool
+	// Whether the build cache is stored as layers, as by Podman and Buildah, instead of as BuildKit cache
+	layerCache bool
+	// Transport through which Singularity reads local images, or empty if images are exported to an archive first
+	singularityTransport string
+}
+
+// Podman runs rootless, and keeps its images in containers-storage, which Singularity can read directly
+func newPodmanEngine() *cliEngine {
+	return &cliEngine{
+		name:                 "podman",
+		command:              "podman",
+		buildCommand:         "podman",
+		keepUserNamespace:    true,
+		manifestLists:        true,
+		layerCache:           true,
+		singularityTransport: "containers-storage",
+	}
+}
+
+// nerdctl keeps its images in containerd, which Singularity can't read, and builds them with BuildKit
+func newNerdctlEngine() *cliEngine {
+	return &cliEngine{
+		name:         "nerdctl",
+		command:      "nerdctl",
+		buildCommand: "nerdctl",
+	}
+}
+
+// Buildah can't run containers, so it's only used for builds and everything else is done by Podman, which shares
+// the same image storage
+func newBuildahEngine() *cliEngine {
+	e := newPodmanEngine()
+	e.name = "buildah"
+	e.buildCommand = "buildah"
+	return e
+}
+
+func (e *cliEngine) Name() string {
+	return e.name
+}
+
+func (e *cliEngine) Command() string {
+	return e.command
+}
+
+// BuildImage runs the build command of the engine. Podman and Buildah store multi-platform builds as a manifest
+// list, which is created again by each build.
+func (e *cliEngine) BuildImage(b ImageBuild) error {
+
+	tags := b.Tags
+	manifest := e.manifestLists && len(b.Platforms) > 1
+	if manifest {
+		// Otherwise the images would be added to the manifest list of the last build
+		e.output("manifest", "rm", tags[0])
+		b.Tags = nil
+	}
+
+	manifestList := ""
+	if manifest {
+		manifestList = tags[0]
+	}
+	err := runBuildCommand(e.buildCommand, b, func(dockerfilePath string) []string {
+		return e.getBuildArgs(b, dockerfilePath, manifestList)
+	})
+	if err != nil || !manifest {
+		return err
+	}
+	for _, tag := range tags[1:] {
+		if err = e.TagImage(tags[0], tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the arguments of the build command, which adds the images to the given manifest list, if any, instead of
+// tagging them
+func (e *cliEngine) getBuildArgs(b ImageBuild, dockerfilePath string, manifestList string) []string {
+	args := append([]string{"build"}, getBuildCommandArgs(b, dockerfilePath)...)
+	if manifestList != "" {
+		args = append(args, "--manifest", manifestList)
+	}
+	if e.layerCache {
+		args = append(args, getLayerCacheArgs(b)...)
+	} else {
+		args = append(args, getBuildKitCacheArgs(b)...)
+	}
+	return append(args, b.Dir)
+}
+
+// Returns the arguments which import and export the build cache with Podman and Buildah. They store each layer in
+// a registry repository, tagged with its digest, so the tags of the cache images are left out. The cache images
+// should therefore be in a repository of their own, like the default remote/name-buildcache.
+func getLayerCacheArgs(b ImageBuild) []string {
+	args := []string{"--layers"}
+	if !b.NoCache {
+		for _, ref := range b.CacheFrom {
+			args = append(args, "--cache-from", getRepository(ref))
+		}
+	}
+	for _, ref := range b.CacheTo {
+		args = append(args, "--cache-to", getRepository(ref))
+	}
+	return args
+}
+
+// Returns the repository of an image reference, without its tag or digest
+func getRepository(ref string) string {
+	if named, err := reference.ParseNormalizedNamed(ref); err == nil {
+		return reference.FamiliarName(named)
+	}
+	return ref
+}
+
+func (e *cliEngine) TagImage(source, target string) error {
+	_, err := e.output("tag", source, target)
+	return err
+}
+
+// PushImage pushes an image using the credentials saved by the login command of the engine
+func (e *cliEngine) PushImage(image string) error {
+	PrintHint("%% %s push %s", e.command, image)
+	if err := RunCommand(e.command, "push", image); err != nil {
+		return fmt.Errorf("command `%s push` failed with %s", e.command, err)
+	}
+	return nil
+}
+
+// PushManifestList pushes a multi-platform image with the images of all its platforms
+func (e *cliEngine) PushManifestList(image, target string, platforms []string) error {
+	args := []string{"push", "--all-platforms", target}
+	if e.manifestLists {
+		args = []string{"manifest", "push", "--all", image, "docker://" + target}
+	} else if err := e.TagImage(image, target); err != nil {
+		return err
+	}
+	PrintHint("%% %s %s", e.command, strings.Join(args, " "))
+	if err := RunCommand(e.command, args...); err != nil {
+		return fmt.Errorf("command `%s %s` failed with %s", e.command, args[0], err)
+	}
+	return nil
+}
+
+// ImagePlatforms returns the platforms in the manifest list or index of a multi-platform image, or else the
+// platform of the image
+func (e *cliEngine) ImagePlatforms(image string) ([]string, error) {
+
+	details, err := e.InspectImage(image)
+	if err != nil || details == nil {
+		return nil, err
+	}
+
+	var out []byte
+	if e.manifestLists {
+		out, err = e.output("manifest", "inspect", image)
+	} else {
+		out, err = e.output("image", "inspect", "--mode=native", image)
+		// The index is part of the native details of the image
+		var native []struct{ Index json.RawMessage }
+		if err == nil && json.Unmarshal(out, &native) == nil && len(native) > 0 {
+			out = native[0].Index
+		}
+	}
+	if err != nil {
+		PrintDebug("Not a multi-platform image: %s", err)
+		return []string{details.Platform()}, nil
+	}
+
+	var index struct {
+		Manifests []struct {
+			Platform *struct {
+				OS           string
+				Architecture string
+				Variant      string
+			}
+		}
+	}
+	var platforms []string
+	if json.Unmarshal(out, &index) == nil {
+		for _, manifest := range index.Manifests {
+			// Attestations are stored with an unknown platform
+			if p := manifest.Platform; p != nil && p.OS != "unknown" {
+				platform := (&ImageDetails{Os: p.OS, Architecture: p.Architecture, Variant: p.Variant}).Platform()
+				platforms = append(platforms, platform)
+			}
+		}
+	}
+	if len(platforms) == 0 {
+		return []string{details.Platform()}, nil
+	}
+	return platforms, nil
+}
+
+// RunContainer runs a container with the standard streams attached, and returns its exit code
+func (e *cliEngine) RunContainer(r ContainerRun) (int, error) {
+
+	args := e.getRunArgs(r, r.Tty && IsInteractive(), os.Geteuid() != 0)
+	PrintHint("%% %s %s", e.command, strings.Join(args, " "))
+	err := RunCommand(e.command, args...)
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// Returns the arguments of the run command, which allocates a pseudo-TTY if tty is set
+func (e *cliEngine) getRunArgs(r ContainerRun, tty bool, rootless bool) []string {
+
+	args := []string{"run", "-i"}
+	if tty {
+		args = append(args, "-t")
+	}
+	// Mapping the user only works in rootless mode
+	if e.keepUserNamespace && rootless {
+		args = append(args, "--userns=keep-id")
+	}
+	for _, env := range r.Env {
+		args = append(args, "-e", env)
+	}
+	if r.User != "" {
+		args = append(args, "-u", r.User)
+	}
+
+	// The entrypoint flag only takes the command, so any arguments in the entrypoint are passed before the others
+	cmd := r.Cmd
+	if len(r.Entrypoint) > 0 {
+		args = append(args, "--entrypoint", r.Entrypoint[0])
+		cmd = append(append([]string{}, r.Entrypoint[1:]...), r.Cmd...)
+	}
+	args = append(args, r.Image)
+	return append(args, cmd...)
+}
+
+// ContainerOutput runs a command in a container which is removed when it exits, and returns its standard output
+func (e *cliEngine) ContainerOutput(image string, command []string) ([]byte, error) {
+	args := append([]string{"run", "--rm", "--entrypoint", command[0], image}, command[1:]...)
+	return e.output(args...)
+}
+
+// InspectImage returns the details of a local image, or nil if it doesn't exist
+func (e *cliEngine) InspectImage(image string) (*ImageDetails, error) {
+	inspect, err := e.inspect(image)
+	if err != nil || inspect == nil {
+		return nil, err
+	}
+	return newImageDetails(*inspect), nil
+}
+
+// Returns the output of `image inspect`, which is in the same format as the Docker Engine API, or nil if the image
+// doesn't exist
+func (e *cliEngine) inspect(image string) (*types.ImageInspect, error) {
+	out, err := e.output("image", "inspect", image)
+	if err != nil {
+		message := strings.ToLower(err.Error())
+		if strings.Contains(message, "not known") || strings.Contains(message, "no such") ||
+			strings.Contains(message, "not found") {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var inspect []types.ImageInspect
+	if err = json.Unmarshal(out, &inspect); err != nil {
+		return nil, fmt.Errorf("cannot read the output of `%s image inspect`: %s", e.command, err)
+	}
+	if len(inspect) == 0 {
+		return nil, nil
+	}
+	return &inspect[0], nil
+}
+
+// ListImages returns the local tags of the given repository
+func (e *cliEngine) ListImages(repository string) ([]string, error) {
+	out, err := e.output("images", "--format", "{{.Repository}}:{{.Tag}}", repository)
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line == "" || strings.HasSuffix(line, ":<none>") {
+			continue
+		}
+		// Podman qualifies images which were built locally with localhost
+		tags = append(tags, strings.TrimPrefix(line, "localhost/"))
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// ResolveDigest pulls the image and returns the digest it was pulled by, because the CLIs have no command to ask the
+// registry directly
+func (e *cliEngine) ResolveDigest(image string) (string, error) {
+
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+
+	PrintDebug("Pulling %s to resolve its digest...", image)
+	if _, err = e.output("pull", "--quiet", image); err != nil {
+		return "", fmt.Errorf("could not pull %s: %s", image, err)
+	}
+	inspect, err := e.inspect(image)
+	if err != nil {
+		return "", err
+	}
+	if inspect != nil {
+		for _, repoDigest := range inspect.RepoDigests {
+			ref, err := reference.ParseNormalizedNamed(repoDigest)
+			if err != nil || ref.Name() != named.Name() {
+				continue
+			}
+			if canonical, ok := ref.(reference.Canonical); ok {
+				return canonical.Digest().String(), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("could not find the digest of %s", image)
+}
+
+// SingularitySource returns the image in the engine's storage, or else exports it to a Docker archive
+func (e *cliEngine) SingularitySource(image string) (string, string, func(), error) {
+
+	if e.singularityTransport != "" {
+		return e.singularityTransport, qualifyLocalImage(image), func() {}, nil
+	}
+
+	dir, err := ioutil.TempDir("", "maru_image_")
+	if err != nil {
+		return "", "", nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+	archive := filepath.Join(dir, "image.tar")
+	PrintHint("%% %s save -o %s %s", e.command, archive, image)
+	if err = RunCommand(e.command, "save", "-o", archive, image); err != nil {
+		cleanup()
+		return "", "", nil, fmt.Errorf("command `%s save` failed with %s", e.command, err)
+	}
+	return "docker-archive", archive, cleanup, nil
+}
+
+// Returns the image name as it's stored by Podman, where images without a registry are qualified with localhost
+func qualifyLocalImage(image string) string {
+	first := strings.SplitN(image, "/", 2)[0]
+	if !strings.Contains(image, "/") || !strings.ContainsAny(first, ".:") && first != "localhost" {
+		return "localhost/" + image
+	}
+	return image
+}
+
+// Runs a command of the engine and returns its output. Errors include the message printed by the command.
+func (e *cliEngine) output(args ...string) ([]byte, error) {
+	PrintDebug("%% %s %s", e.command, strings.Join(args, " "))
+	cmd := exec.Command(e.command, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return out, fmt.Errorf("%s", message)
+		}
+		return out, fmt.Errorf("command `%s %s` failed with %s", e.command, args[0], err)
+	}
+	return out, nil
+}
@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCLIEngineCommands(t *testing.T) {
+	tests := []struct {
+		engine       *cliEngine
+		command      string
+		buildCommand string
+	}{
+		{engine: newPodmanEngine(), command: "podman", buildCommand: "podman"},
+		{engine: newNerdctlEngine(), command: "nerdctl", buildCommand: "nerdctl"},
+		// Buildah can't run containers, so they are run by Podman
+		{engine: newBuildahEngine(), command: "podman", buildCommand: "buildah"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.engine.Name(), func(t *testing.T) {
+			if tt.engine.Command() != tt.command || tt.engine.buildCommand != tt.buildCommand {
+				t.Errorf("commands = %s and %s, want %s and %s", tt.engine.Command(), tt.engine.buildCommand,
+					tt.command, tt.buildCommand)
+			}
+		})
+	}
+}
+
+func TestCLIEngineBuildArgs(t *testing.T) {
+	build := ImageBuild{
+		Dir:       "/src",
+		Tags:      []string{"myapp:latest"},
+		CacheFrom: []string{"ghcr.io/me/myapp-buildcache:main"},
+		CacheTo:   []string{"ghcr.io/me/myapp-buildcache:main"},
+	}
+	multiPlatform := build
+	multiPlatform.Tags = nil
+	multiPlatform.Platforms = []string{"linux/amd64", "linux/arm64"}
+
+	tests := []struct {
+		name         string
+		engine       *cliEngine
+		build        ImageBuild
+		manifestList string
+		want         string
+	}{
+		{
+			name:   "podman",
+			engine: newPodmanEngine(),
+			build:  build,
+			want: "build -f /tmp/Dockerfile -t myapp:latest --layers --cache-from ghcr.io/me/myapp-buildcache " +
+				"--cache-to ghcr.io/me/myapp-buildcache /src",
+		},
+		{
+			name:         "podman manifest list",
+			engine:       newPodmanEngine(),
+			build:        multiPlatform,
+			manifestList: "myapp:latest",
+			want: "build -f /tmp/Dockerfile --platform linux/amd64,linux/arm64 --manifest myapp:latest --layers " +
+				"--cache-from ghcr.io/me/myapp-buildcache --cache-to ghcr.io/me/myapp-buildcache /src",
+		},
+		{
+			name:   "nerdctl",
+			engine: newNerdctlEngine(),
+			build:  build,
+			want: "build -f /tmp/Dockerfile -t myapp:latest --cache-from type=registry,ref=ghcr.io/me/myapp-buildcache:main " +
+				"--cache-to type=registry,ref=ghcr.io/me/myapp-buildcache:main,mode=max /src",
+		},
+		{
+			name:   "buildah",
+			engine: newBuildahEngine(),
+			build:  build,
+			want: "build -f /tmp/Dockerfile -t myapp:latest --layers --cache-from ghcr.io/me/myapp-buildcache " +
+				"--cache-to ghcr.io/me/myapp-buildcache /src",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := strings.Join(tt.engine.getBuildArgs(tt.build, "/tmp/Dockerfile", tt.manifestList), " ")
+			if got != tt.want {
+				t.Errorf("getBuildArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetLayerCacheArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		build ImageBuild
+		want  string
+	}{
+		{name: "no cache", build: ImageBuild{}, want: "--layers"},
+		{
+			name: "tags and digests are left out",
+			build: ImageBuild{
+				CacheFrom: []string{"myapp-buildcache:main"},
+				CacheTo:   []string{"ghcr.io/me/myapp-buildcache@" + fakeDigest("cache")},
+			},
+			want: "--layers --cache-from myapp-buildcache --cache-to ghcr.io/me/myapp-buildcache",
+		},
+		{
+			name:  "only exported without the cache",
+			build: ImageBuild{NoCache: true, CacheFrom: []string{"myapp-buildcache"}, CacheTo: []string{"myapp-buildcache"}},
+			want:  "--layers --cache-to myapp-buildcache",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(getLayerCacheArgs(tt.build), " "); got != tt.want {
+				t.Errorf("getLayerCacheArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCLIEngineRunArgs(t *testing.T) {
+	run := ContainerRun{
+		Image:      "myapp:latest",
+		Entrypoint: []string{"/bin/sh", "-c"},
+		Cmd:        []string{"make"},
+		Env:        []string{"HOME=/home/me"},
+		User:       "1000:1000",
+	}
+	tests := []struct {
+		name     string
+		engine   *cliEngine
+		tty      bool
+		rootless bool
+		want     string
+	}{
+		{
+			name:     "podman rootless",
+			engine:   newPodmanEngine(),
+			tty:      true,
+			rootless: true,
+			want:     "run -i -t --userns=keep-id -e HOME=/home/me -u 1000:1000 --entrypoint /bin/sh myapp:latest -c make",
+		},
+		{
+			name:   "podman as root",
+			engine: newPodmanEngine(),
+			want:   "run -i -e HOME=/home/me -u 1000:1000 --entrypoint /bin/sh myapp:latest -c make",
+		},
+		{
+			name:     "nerdctl rootless",
+			engine:   newNerdctlEngine(),
+			rootless: true,
+			want:     "run -i -e HOME=/home/me -u 1000:1000 --entrypoint /bin/sh myapp:latest -c make",
+		},
+		{
+			name:     "buildah rootless",
+			engine:   newBuildahEngine(),
+			rootless: true,
+			want:     "run -i --userns=keep-id -e HOME=/home/me -u 1000:1000 --entrypoint /bin/sh myapp:latest -c make",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(tt.engine.getRunArgs(run, tt.tty, tt.rootless), " "); got != tt.want {
+				t.Errorf("getRunArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCLIEngineSingularitySource(t *testing.T) {
+	for _, e := range []*cliEngine{newPodmanEngine(), newBuildahEngine()} {
+		t.Run(e.Name(), func(t *testing.T) {
+			transport, ref, cleanup, err := e.SingularitySource("myapp:1.0.0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			cleanup()
+			if transport != "containers-storage" || ref != "localhost/myapp:1.0.0" {
+				t.Errorf("SingularitySource() = %s %s, want containers-storage localhost/myapp:1.0.0", transport, ref)
+			}
+		})
+	}
+}
+
+func TestQualifyLocalImage(t *testing.T) {
+	tests := map[string]string{
+		"myapp:1.0.0":               "localhost/myapp:1.0.0",
+		"me/myapp:1.0.0":            "localhost/me/myapp:1.0.0",
+		"localhost/myapp:1.0.0":     "localhost/myapp:1.0.0",
+		"ghcr.io/me/myapp:1.0.0":    "ghcr.io/me/myapp:1.0.0",
+		"registry:5000/myapp:1.0.0": "registry:5000/myapp:1.0.0",
+	}
+	for image, want := range tests {
+		if got := qualifyLocalImage(image); got != want {
+			t.Errorf("qualifyLocalImage(%s) = %s, want %s", image, got, want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DiffLine is one line of a line-based diff. Kind is ' ' for a line found in both files, '-' for a line only found
+// in the old file, and '+' for a line only found in the new file.
+type DiffLine struct {
+	Kind byte
+	Text string
+}
+
+// SplitLines splits text into lines, without the line endings, which can be either \n or \r\n
+func SplitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+// DiffLines computes a minimal line-based diff between a and b, using their longest common subsequence
+func DiffLines(a, b []string) []DiffLine {
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	diff := make([]DiffLine, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] == b[j] {
+			diff = append(diff, DiffLine{' ', a[i]})
+			i++
+			j++
+		} else if lcs[i+1][j] >= lcs[i][j+1] {
+			diff = append(diff, DiffLine{'-', a[i]})
+			i++
+		} else {
+			diff = append(diff, DiffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, DiffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, DiffLine{'+', b[j]})
+	}
+	return diff
+}
+
+// UnifiedDiff returns the differences between the old and new text in unified diff format, with the given
+// number of context lines around each change. Returns an empty string if the texts are identical.
+func UnifiedDiff(oldText, newText, oldName, newName string, context int) string {
+
+	diff := DiffLines(SplitLines(oldText), SplitLines(newText))
+
+	var sb strings.Builder
+	oldLine, newLine := 1, 1
+	for start := 0; start < len(diff); {
+
+		// Find the next change
+		first := start
+		for first < len(diff) && diff[first].Kind == ' ' {
+			first++
+		}
+		if first == len(diff) {
+			break
+		}
+
+		// Extend the hunk until there are more than 2*context unchanged lines in a row
+		last := first
+		for k := first; k < len(diff); k++ {
+			if diff[k].Kind != ' ' {
+				last = k
+			} else if k-last > 2*context {
+				break
+			}
+		}
+
+		hunkStart := first - context
+		if hunkStart < start {
+			hunkStart = start
+		}
+		hunkEnd := last + context + 1
+		if hunkEnd > len(diff) {
+			hunkEnd = len(diff)
+		}
+
+		// Count the lines before the hunk to find where it starts in each file
+		for k := start; k < hunkStart; k++ {
+			oldLine++
+			newLine++
+		}
+		oldCount, newCount := 0, 0
+		for k := hunkStart; k < hunkEnd; k++ {
+			if diff[k].Kind != '+' {
+				oldCount++
+			}
+			if diff[k].Kind != '-' {
+				newCount++
+			}
+		}
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(oldLine, oldCount), hunkRange(newLine, newCount))
+		for k := hunkStart; k < hunkEnd; k++ {
+			fmt.Fprintf(&sb, "%c%s\n", diff[k].Kind, diff[k].Text)
+		}
+
+		oldLine += oldCount
+		newLine += newCount
+		start = hunkEnd
+	}
+
+	return sb.String()
+}
+
+// Formats the line range of a hunk, as used in unified diff headers
+func hunkRange(line, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", line-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+// Returns, for each line of a, the index of the matching line in b according to their longest common subsequence,
+// or -1 if the line is not in the subsequence
+func matchLines(a, b []string) []int {
+	matches := make([]int, len(a))
+	i, j := 0, 0
+	for _, line := range DiffLines(a, b) {
+		switch line.Kind {
+		case ' ':
+			matches[i] = j
+			i++
+			j++
+		case '-':
+			matches[i] = -1
+			i++
+		case '+':
+			j++
+		}
+	}
+	return matches
+}
+
+// Merge3 performs a three-way merge, applying both the changes made from base to ours, and those made from base to
+// theirs. Where both sides changed the same lines differently, the merged text contains both versions between
+// conflict markers labelled with the given names. The merged text has the same line endings as ours. Returns the
+// merged text and true if there were any conflicts.
+func Merge3(base, ours, theirs, oursName, theirsName string) (string, bool) {
+
+	o, a, b := SplitLines(base), SplitLines(ours), SplitLines(theirs)
+	matchA, matchB := matchLines(o, a), matchLines(o, b)
+
+	var merged []string
+	conflicts := false
+
+	// Resolves a chunk of lines which changed on at least one side
+	resolve := func(oc, ac, bc []string) {
+		switch {
+		case equalLines(ac, oc):
+			merged = append(merged, bc...)
+		case equalLines(bc, oc) || equalLines(ac, bc):
+			merged = append(merged, ac...)
+		default:
+			conflicts = true
+			merged = append(merged, "<<<<<<< "+oursName)
+			merged = append(merged, ac...)
+			merged = append(merged, "=======")
+			merged = append(merged, bc...)
+			merged = append(merged, ">>>>>>> "+theirsName)
+		}
+	}
+
+	io, ia, ib := 0, 0, 0
+	for {
+		// Find the next base line which is unchanged on both sides
+		next := io
+		for next < len(o) && (matchA[next] < 0 || matchB[next] < 0) {
+			next++
+		}
+		if next == len(o) {
+			resolve(o[io:], a[ia:], b[ib:])
+			break
+		}
+		if next == io && matchA[next] == ia && matchB[next] == ib {
+			merged = append(merged, o[io])
+			io, ia, ib = io+1, ia+1, ib+1
+			continue
+		}
+		resolve(o[io:next], a[ia:matchA[next]], b[ib:matchB[next]])
+		io, ia, ib = next, matchA[next], matchB[next]
+	}
+
+	if len(merged) == 0 {
+		return "", conflicts
+	}
+	newline := "\n"
+	if strings.Contains(ours, "\r\n") {
+		newline = "\r\n"
+	}
+	return strings.Join(merged, newline) + newline, conflicts
+}
+
+// Returns true if the two slices contain the same lines
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
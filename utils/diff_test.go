@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitLines(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"single line without newline", "a", []string{"a"}},
+		{"trailing newline", "a\nb\n", []string{"a", "b"}},
+		{"no trailing newline", "a\nb", []string{"a", "b"}},
+		{"blank lines", "a\n\nb\n\n", []string{"a", "", "b", ""}},
+		{"crlf", "a\r\nb\r\n", []string{"a", "b"}},
+		{"mixed line endings", "a\r\nb\nc", []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SplitLines(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitLines(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		context  int
+		want     string
+	}{
+		{
+			name: "identical",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			name: "only line endings differ",
+			old:  "a\r\nb\r\n",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			name:    "changed line",
+			old:     "a\nb\nc\n",
+			new:     "a\nB\nc\n",
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name:    "new file",
+			old:     "",
+			new:     "a\nb\n",
+			context: 3,
+			want:    "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:    "deleted file",
+			old:     "a\n",
+			new:     "",
+			context: 3,
+			want:    "--- old\n+++ new\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name:    "line added at end",
+			old:     "a\nb\n",
+			new:     "a\nb\nc\n",
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -2 +2,2 @@\n b\n+c\n",
+		},
+		{
+			name:    "separate hunks",
+			old:     "1\n2\n3\n4\n5\n6\n7\n",
+			new:     "one\n2\n3\n4\n5\n6\nseven\n",
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -1,2 +1,2 @@\n-1\n+one\n 2\n@@ -6,2 +6,2 @@\n 6\n-7\n+seven\n",
+		},
+		{
+			name:    "hunks joined by shared context",
+			old:     "1\n2\n3\n4\n5\n",
+			new:     "one\n2\n3\n4\nfive\n",
+			context: 2,
+			want:    "--- old\n+++ new\n@@ -1,5 +1,5 @@\n-1\n+one\n 2\n 3\n 4\n-5\n+five\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UnifiedDiff(tt.old, tt.new, "old", "new", tt.context); got != tt.want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		conflicts          bool
+	}{
+		{
+			name: "no changes",
+			base: "a\nb\nc\n", ours: "a\nb\nc\n", theirs: "a\nb\nc\n",
+			want: "a\nb\nc\n",
+		},
+		{
+			name: "only ours changed",
+			base: "a\nb\nc\n", ours: "a\nB\nc\n", theirs: "a\nb\nc\n",
+			want: "a\nB\nc\n",
+		},
+		{
+			name: "only theirs changed",
+			base: "a\nb\nc\n", ours: "a\nb\nc\n", theirs: "a\nb\nC\n",
+			want: "a\nb\nC\n",
+		},
+		{
+			name: "same change on both sides",
+			base: "a\nb\nc\n", ours: "a\nB\nc\n", theirs: "a\nB\nc\n",
+			want: "a\nB\nc\n",
+		},
+		{
+			name: "separate edits",
+			base: "a\nb\nc\nd\ne\n", ours: "A\nb\nc\nd\ne\n", theirs: "a\nb\nc\nd\nE\n",
+			want: "A\nb\nc\nd\nE\n",
+		},
+		{
+			name: "adjacent edits conflict",
+			base: "a\nb\nc\nd\n", ours: "a\nB\nc\nd\n", theirs: "a\nb\nC\nd\n",
+			want:      "a\n<<<<<<< ours\nB\nc\n=======\nb\nC\n>>>>>>> theirs\nd\n",
+			conflicts: true,
+		},
+		{
+			name: "different changes to the same line conflict",
+			base: "a\nb\nc\n", ours: "a\nX\nc\n", theirs: "a\nY\nc\n",
+			want:      "a\n<<<<<<< ours\nX\n=======\nY\n>>>>>>> theirs\nc\n",
+			conflicts: true,
+		},
+		{
+			name: "insertions at the same place conflict",
+			base: "a\nb\n", ours: "a\nX\nb\n", theirs: "a\nY\nb\n",
+			want:      "a\n<<<<<<< ours\nX\n=======\nY\n>>>>>>> theirs\nb\n",
+			conflicts: true,
+		},
+		{
+			name: "deletion and edit of the same line conflict",
+			base: "a\nb\nc\n", ours: "a\nc\n", theirs: "a\nB\nc\n",
+			want:      "a\n<<<<<<< ours\n=======\nB\n>>>>>>> theirs\nc\n",
+			conflicts: true,
+		},
+		{
+			name: "same deletion on both sides",
+			base: "a\nb\nc\n", ours: "a\nc\n", theirs: "a\nc\n",
+			want: "a\nc\n",
+		},
+		{
+			name: "appended lines on one side",
+			base: "a\n", ours: "a\nb\n", theirs: "A\n",
+			want:      "<<<<<<< ours\na\nb\n=======\nA\n>>>>>>> theirs\n",
+			conflicts: true,
+		},
+		{
+			name: "everything deleted",
+			base: "a\n", ours: "", theirs: "a\n",
+			want: "",
+		},
+		{
+			name: "ours without trailing newline",
+			base: "a\nb\n", ours: "a\nb", theirs: "a\nB\n",
+			want: "a\nB\n",
+		},
+		{
+			name: "crlf edits keep their line endings",
+			base: "a\nb\nc\n", ours: "A\r\nb\r\nc\r\n", theirs: "a\nb\nC\n",
+			want: "A\r\nb\r\nC\r\n",
+		},
+		{
+			name: "crlf conversion alone is not a change",
+			base: "a\nb\n", ours: "a\r\nb\r\n", theirs: "a\nB\n",
+			want: "a\r\nB\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, conflicts := Merge3(tt.base, tt.ours, tt.theirs, "ours", "theirs")
+			if got != tt.want || conflicts != tt.conflicts {
+				t.Errorf("Merge3() = %q, %t, want %q, %t", got, conflicts, tt.want, tt.conflicts)
+			}
+		})
+	}
+}
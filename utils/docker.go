@@ -0,0 +1,622 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/moby/term"
+	"github.com/opencontainers/go-digest"
+)
+
+// NewDockerClient connects to the Docker Engine given by DOCKER_HOST, or to the local socket by default
+func NewDockerClient() (*client.Client, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to Docker: %s", err)
+	}
+	return cli, nil
+}
+
+// dockerEngine uses the Docker Engine API, so that a remote daemon given by DOCKER_HOST works without the docker CLI
+type dockerEngine struct{}
+
+func (e *dockerEngine) Name() string {
+	return "docker"
+}
+
+func (e *dockerEngine) Command() string {
+	return "docker"
+}
+
+// BuildImage builds an image with BuildKit through the Docker Engine API, and prints its progress. A BuildKit session
+// gives the build the secrets, SSH agents and registry credentials of this machine.
+func (e *dockerEngine) BuildImage(b ImageBuild) error {
+
+	if len(b.Platforms) > 1 {
+		return e.buildPlatforms(b)
+	}
+
+	cli, err := NewDockerClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	// The context is streamed to the daemon while it's being created
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(WriteBuildContext(writer, b.Dir, b.Dockerfile))
+	}()
+	defer reader.Close()
+
+	buildArgs := make(map[string]*string)
+	for key, value := range b.BuildArgs {
+		if value == nil {
+			if env, ok := os.LookupEnv(key); ok {
+				value = &env
+			}
+		}
+		buildArgs[key] = value
+	}
+
+	// BuildKit in the daemon imports the cache from these images in the registry. The cache is exported inline, in
+	// the image itself, which is pushed to the cache images after the build. The default builder of Docker can't
+	// export the cache of the intermediate stages, only the layers of the final image.
+	var cacheFrom []string
+	if !b.NoCache {
+		cacheFrom = b.CacheFrom
+	}
+	tags := b.Tags
+	if len(b.CacheTo) > 0 {
+		inlineCache := "1"
+		buildArgs["BUILDKIT_INLINE_CACHE"] = &inlineCache
+		tags = append(append([]string(nil), b.Tags...), b.CacheTo...)
+	}
+
+	// Only the classic builder uses these, BuildKit asks the session for the credentials of each registry
+	authConfigs, err := GetAllRegistryAuths()
+	if err != nil {
+		return err
+	}
+	sessionID, closeSession, err := startBuildSession(cli, b)
+	if err != nil {
+		return err
+	}
+	defer closeSession()
+
+	PrintDebug("Building %s with build arguments %s", strings.Join(tags, ", "), formatBuildArgs(buildArgs))
+	resp, err := cli.ImageBuild(context.Background(), reader, types.ImageBuildOptions{
+		Tags:        tags,
+		Dockerfile:  ContextDockerfilePath,
+		BuildArgs:   buildArgs,
+		Labels:      b.Labels,
+		Remove:      true,
+		ForceRemove: true,
+		NoCache:     b.NoCache,
+		PullParent:  b.Pull,
+		CacheFrom:   cacheFrom,
+		Platform:    strings.Join(b.Platforms, ","),
+		Target:      b.Target,
+		Version:     types.BuilderBuildKit,
+		SessionID:   sessionID,
+		AuthConfigs: authConfigs,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	progress := newBuildProgress(os.Stdout)
+	var progressErr error
+	err = displayJSONMessages(resp.Body, func(msg jsonmessage.JSONMessage) {
+		if msg.ID != BuildKitTraceID || progressErr != nil {
+			return
+		}
+		var trace []byte
+		if progressErr = json.Unmarshal(*msg.Aux, &trace); progressErr == nil {
+			progressErr = progress.handleTrace(trace)
+		}
+	})
+	if err == nil && progressErr != nil {
+		PrintDebug("Cannot show build progress: %s", progressErr)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range b.CacheTo {
+		PrintMessage("Exporting the build cache to %s...", ref)
+		if err = e.PushImage(ref); err != nil {
+			return fmt.Errorf("cannot export the build cache to %s: %s", ref, err)
+		}
+	}
+	return nil
+}
+
+// Builds the image for each platform in turn, because Docker only stores images for a single platform. Each image
+// is tagged for its platform, e.g. myapp:1.0.0-linux-arm64, and the image for the first platform is also tagged
+// with the given tags. The images are only joined into a manifest list when they are pushed.
+func (e *dockerEngine) buildPlatforms(b ImageBuild) error {
+
+	for i, platform := range sortPlatforms(b.Platforms) {
+		PrintMessage("Building for %s...", platform)
+		pb := b
+		pb.Platforms = []string{platform}
+		pb.Tags = nil
+		if i == 0 {
+			pb.Tags = append(pb.Tags, b.Tags...)
+		}
+		for _, tag := range b.Tags {
+			pb.Tags = append(pb.Tags, GetPlatformTag(tag, platform))
+		}
+		// Each platform has its own cache, so that they don't replace each other
+		pb.CacheFrom, pb.CacheTo = nil, nil
+		for _, ref := range b.CacheFrom {
+			pb.CacheFrom = append(pb.CacheFrom, GetPlatformTag(getTaggedRef(ref), platform))
+		}
+		for _, ref := range b.CacheTo {
+			pb.CacheTo = append(pb.CacheTo, GetPlatformTag(getTaggedRef(ref), platform))
+		}
+		if err := e.BuildImage(pb); err != nil {
+			return fmt.Errorf("build for %s failed: %s", platform, err)
+		}
+	}
+	return nil
+}
+
+// Returns an image reference with its tag, e.g. remote/name-buildcache:latest, so that a platform can be added to the
+// tag instead of the repository
+func getTaggedRef(ref string) string {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return ref
+	}
+	if _, ok := named.(reference.Digested); ok {
+		return ref
+	}
+	return reference.FamiliarString(reference.TagNameOnly(named))
+}
+
+// Formats the build arguments for debug output, without their values, which may be secret
+func formatBuildArgs(buildArgs map[string]*string) string {
+	var keys []string
+	for key := range buildArgs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
+
+// TagImage adds a tag to an existing image
+func (e *dockerEngine) TagImage(source, target string) error {
+	cli, err := NewDockerClient()
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	return cli.ImageTag(context.Background(), source, target)
+}
+
+// PushImage pushes an image to its registry, using the credentials saved by `docker login`, and prints the progress
+// of each layer
+func (e *dockerEngine) PushImage(image string) error {
+	_, err := e.pushImage(image)
+	return err
+}
+
+// Pushes an image like PushImage, and returns the digest and size of the manifest which was pushed
+func (e *dockerEngine) pushImage(image string) (types.PushResult, error) {
+
+	var result types.PushResult
+	cli, err := NewDockerClient()
+	if err != nil {
+		return result, err
+	}
+	defer cli.Close()
+
+	auth, err := GetRegistryAuth(image)
+	if err != nil {
+		return result, err
+	}
+
+	resp, err := cli.ImagePush(context.Background(), image, types.ImagePushOptions{RegistryAuth: auth})
+	if err != nil {
+		return result, err
+	}
+	defer resp.Close()
+	err = displayJSONMessages(resp, func(msg jsonmessage.JSONMessage) {
+		if msg.Aux != nil {
+			if err := json.Unmarshal(*msg.Aux, &result); err != nil {
+				PrintDebug("Cannot read the result of the push: %s", err)
+			}
+		}
+	})
+	return result, err
+}
+
+// PushManifestList pushes the image of each platform, and then a manifest list which refers to them by digest. The
+// Engine API can only push tagged images, so each platform is pushed under a tag of its own, e.g.
+// myapp:1.0.0-linux-arm64. The target tag is only put on the manifest list once every platform was pushed, so it
+// never points to the image of a single platform, and is left as it was if a push fails.
+func (e *dockerEngine) PushManifestList(image, target string, platforms []string) error {
+
+	var manifests []manifestlist.ManifestDescriptor
+	for _, platform := range platforms {
+		source := GetPlatformTag(image, platform)
+		details, err := e.InspectImage(source)
+		if err != nil {
+			return err
+		} else if details == nil {
+			return fmt.Errorf("image %s was not found, use `maru build` to build it", source)
+		}
+		platformTarget := GetPlatformTag(target, platform)
+		if err := e.TagImage(source, platformTarget); err != nil {
+			return err
+		}
+		PrintMessage("Pushing the image for %s...", platform)
+		pushed, err := e.pushImage(platformTarget)
+		if err != nil {
+			return err
+		}
+		if pushed.Digest == "" {
+			return fmt.Errorf("the registry didn't return the digest of %s", source)
+		}
+		manifests = append(manifests, manifestlist.ManifestDescriptor{
+			Descriptor: distribution.Descriptor{
+				MediaType: schema2.MediaTypeManifest,
+				Digest:    digest.Digest(pushed.Digest),
+				Size:      int64(pushed.Size),
+			},
+			Platform: manifestlist.PlatformSpec{
+				OS:           details.Os,
+				Architecture: details.Architecture,
+				Variant:      details.Variant,
+			},
+		})
+	}
+
+	// The local tag points to the same image as the one which was built, like after pushing a single platform
+	if err := e.TagImage(image, target); err != nil {
+		return err
+	}
+	PrintMessage("Pushing manifest list %s...", target)
+	return PutManifestList(target, manifests)
+}
+
+// ImagePlatforms returns the platforms of a multi-platform build, which are found from the tags of each platform.
+// If the image wasn't built by the latest multi-platform build, its own platform is returned.
+func (e *dockerEngine) ImagePlatforms(image string) ([]string, error) {
+
+	main, err := e.InspectImage(image)
+	if err != nil || main == nil {
+		return nil, err
+	}
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := e.ListImages(reference.FamiliarName(named))
+	if err != nil {
+		return nil, err
+	}
+
+	var platforms []string
+	current := false
+	for _, tag := range tags {
+		if !strings.HasPrefix(tag, image+"-") {
+			continue
+		}
+		details, err := e.InspectImage(tag)
+		if err != nil {
+			return nil, err
+		}
+		platform := strings.ReplaceAll(strings.TrimPrefix(tag, image+"-"), "-", "/")
+		if details == nil || !strings.HasPrefix(platform+"/", details.Os+"/"+details.Architecture+"/") {
+			continue
+		}
+		platforms = append(platforms, platform)
+		if details.ID == main.ID {
+			current = true
+		}
+	}
+	if !current {
+		return []string{main.Platform()}, nil
+	}
+	return platforms, nil
+}
+
+// Prints a stream of JSON messages from the Engine API, with progress bars if the output is a terminal. Returns
+// the error reported by the daemon, if any.
+func displayJSONMessages(in io.Reader, auxCallback func(jsonmessage.JSONMessage)) error {
+	fd, isTerminal := term.GetFdInfo(os.Stdout)
+	return jsonmessage.DisplayJSONMessagesStream(in, os.Stdout, fd, isTerminal, auxCallback)
+}
+
+// RunContainer creates and starts a container, attaches the standard streams to it, and waits for it to exit.
+// Returns the exit code of the container.
+func (e *dockerEngine) RunContainer(r ContainerRun) (int, error) {
+
+	cli, err := NewDockerClient()
+	if err != nil {
+		return 0, err
+	}
+	defer cli.Close()
+	ctx := context.Background()
+
+	stdinFd, stdinIsTerminal := term.GetFdInfo(os.Stdin)
+	tty := r.Tty && stdinIsTerminal
+	if r.Tty && !tty {
+		PrintDebug("Not allocating a TTY, because STDIN is not a terminal")
+	}
+
+	created, err := cli.ContainerCreate(ctx, &container.Config{
+		Image:        r.Image,
+		Entrypoint:   strslice.StrSlice(r.Entrypoint),
+		Cmd:          strslice.StrSlice(r.Cmd),
+		Env:          r.Env,
+		User:         r.User,
+		Tty:          tty,
+		OpenStdin:    true,
+		StdinOnce:    true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	}, nil, nil, nil, "")
+	if client.IsErrNotFound(err) {
+		return 0, fmt.Errorf("image %s was not found, use `maru build` to build it", r.Image)
+	} else if err != nil {
+		return 0, err
+	}
+	PrintDebug("Created container %s", created.ID)
+
+	// Attach before starting, so that no output is missed
+	attached, err := cli.ContainerAttach(ctx, created.ID, types.ContainerAttachOptions{
+		Stream: true,
+		Stdin:  true,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer attached.Close()
+
+	// Wait for the next exit before starting, because a short-lived container may exit before the wait is set up
+	waitCh, waitErrCh := cli.ContainerWait(ctx, created.ID, container.WaitConditionNextExit)
+
+	if tty {
+		state, err := term.SetRawTerminal(stdinFd)
+		if err != nil {
+			return 0, err
+		}
+		defer term.RestoreTerminal(stdinFd, state)
+	}
+
+	outputDone := make(chan error, 1)
+	go func() {
+		var err error
+		if tty {
+			// With a TTY, stdout and stderr are a single raw stream
+			_, err = io.Copy(os.Stdout, attached.Reader)
+		} else {
+			_, err = stdcopy.StdCopy(os.Stdout, os.Stderr, attached.Reader)
+		}
+		outputDone <- err
+	}()
+	go func() {
+		io.Copy(attached.Conn, os.Stdin)
+		attached.CloseWrite()
+	}()
+
+	if err := cli.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		return 0, err
+	}
+	if tty {
+		stopResizing := monitorTerminalSize(func(height, width uint) {
+			cli.ContainerResize(ctx, created.ID, types.ResizeOptions{Height: height, Width: width})
+		})
+		defer stopResizing()
+	}
+
+	// The connection may be reset once the container exits, so the exit status is what decides success
+	outputErr := <-outputDone
+	select {
+	case result := <-waitCh:
+		if outputErr != nil {
+			PrintDebug("Error reading output of the container: %s", outputErr)
+		}
+		if result.Error != nil {
+			return 0, fmt.Errorf("%s", result.Error.Message)
+		}
+		return int(result.StatusCode), nil
+	case err := <-waitErrCh:
+		return 0, err
+	}
+}
+
+// ContainerOutput runs a command in a container without attaching the terminal, and returns its standard output.
+// The command fails if it exits with a non-zero code, with what it printed to standard error.
+func (e *dockerEngine) ContainerOutput(image string, command []string) ([]byte, error) {
+
+	cli, err := NewDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+	ctx := context.Background()
+
+	created, err := cli.ContainerCreate(ctx, &container.Config{
+		Image:        image,
+		Entrypoint:   strslice.StrSlice(command[:1]),
+		Cmd:          strslice.StrSlice(command[1:]),
+		AttachStdout: true,
+		AttachStderr: true,
+	}, nil, nil, nil, "")
+	if client.IsErrNotFound(err) {
+		return nil, fmt.Errorf("image %s was not found, use `maru build` to build it", image)
+	} else if err != nil {
+		return nil, err
+	}
+	PrintDebug("Created container %s to run %s", created.ID, strings.Join(command, " "))
+	defer func() {
+		if err := cli.ContainerRemove(ctx, created.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+			PrintDebug("Cannot remove container %s: %s", created.ID, err)
+		}
+	}()
+
+	attached, err := cli.ContainerAttach(ctx, created.ID, types.ContainerAttachOptions{
+		Stream: true,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer attached.Close()
+
+	waitCh, waitErrCh := cli.ContainerWait(ctx, created.ID, container.WaitConditionNextExit)
+	if err := cli.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	_, outputErr := stdcopy.StdCopy(&stdout, &stderr, attached.Reader)
+	select {
+	case result := <-waitCh:
+		if result.Error != nil {
+			return nil, fmt.Errorf("%s", result.Error.Message)
+		}
+		if result.StatusCode != 0 {
+			message := strings.TrimSpace(stderr.String())
+			if message == "" {
+				message = fmt.Sprintf("exit code %d", result.StatusCode)
+			}
+			return nil, fmt.Errorf("command `%s` failed with %s", strings.Join(command, " "), message)
+		}
+		if outputErr != nil {
+			PrintDebug("Error reading output of the container: %s", outputErr)
+		}
+		return stdout.Bytes(), nil
+	case err := <-waitErrCh:
+		return nil, err
+	}
+}
+
+// InspectImage returns the details of a local image, or nil if it doesn't exist
+func (e *dockerEngine) InspectImage(image string) (*ImageDetails, error) {
+
+	cli, err := NewDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	inspect, _, err := cli.ImageInspectWithRaw(context.Background(), image)
+	if client.IsErrNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return newImageDetails(inspect), nil
+}
+
+// Converts the details of an image returned by the Engine API, which other engines also use for their output
+func newImageDetails(inspect types.ImageInspect) *ImageDetails {
+	details := &ImageDetails{
+		ID:           inspect.ID,
+		Created:      inspect.Created,
+		Size:         inspect.Size,
+		Architecture: inspect.Architecture,
+		Variant:      inspect.Variant,
+		Os:           inspect.Os,
+		Layers:       inspect.RootFS.Layers,
+	}
+	if inspect.Config != nil {
+		details.Labels = inspect.Config.Labels
+		details.Env = inspect.Config.Env
+		details.Entrypoint = inspect.Config.Entrypoint
+		details.Cmd = inspect.Config.Cmd
+	}
+	return details
+}
+
+// ListImages returns the local tags of the given repository
+func (e *dockerEngine) ListImages(repository string) ([]string, error) {
+
+	cli, err := NewDockerClient()
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+
+	images, err := cli.ImageList(context.Background(), types.ImageListOptions{
+		Filters: filters.NewArgs(filters.Arg("reference", repository)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	var tags []string
+	for _, image := range images {
+		tags = append(tags, image.RepoTags...)
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// ResolveDigest returns the digest of the manifest which the given image reference currently points to in its
+// registry. For multi-platform images this is the digest of the manifest list.
+func (e *dockerEngine) ResolveDigest(image string) (string, error) {
+
+	cli, err := NewDockerClient()
+	if err != nil {
+		return "", err
+	}
+	defer cli.Close()
+
+	auth, err := GetRegistryAuth(image)
+	if err != nil {
+		return "", err
+	}
+
+	PrintDebug("Resolving digest of %s...", image)
+	inspect, err := cli.DistributionInspect(context.Background(), image, auth)
+	if err != nil {
+		return "", fmt.Errorf("could not inspect %s: %s", image, err)
+	}
+	return inspect.Descriptor.Digest.String(), nil
+}
+
+// SingularitySource reads the image directly from the Docker daemon
+func (e *dockerEngine) SingularitySource(image string) (string, string, func(), error) {
+	return "docker-daemon", image, func() {}, nil
+}
+
+// Returns the size of the terminal connected to the standard output
+func getTerminalSize() (uint, uint, bool) {
+	fd, isTerminal := term.GetFdInfo(os.Stdout)
+	if !isTerminal {
+		return 0, 0, false
+	}
+	size, err := term.GetWinsize(fd)
+	if err != nil || size.Height == 0 || size.Width == 0 {
+		return 0, 0, false
+	}
+	return uint(size.Height), uint(size.Width), true
+}
@@ -0,0 +1,503 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/auth"
+	"github.com/moby/buildkit/session/secrets"
+)
+
+var apiVersionPrefix = regexp.MustCompile(`^/v[0-9.]+`)
+
+// Starts a fake Docker daemon on a unix socket, and points DOCKER_HOST to it until the returned function is called.
+// The handler gets the paths of the Engine API without the version, e.g. /build.
+func startFakeDaemon(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, path string)) func() {
+
+	dir, err := ioutil.TempDir("", "maru-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := apiVersionPrefix.ReplaceAllString(r.URL.Path, "")
+		if path == "/_ping" {
+			w.Header().Set("API-Version", "1.41")
+			w.Write([]byte("OK"))
+			return
+		}
+		handler(w, r, path)
+	}))
+	server.Listener = listener
+	server.Start()
+
+	restoreHost := setEnv("DOCKER_HOST", "unix://"+socket)
+	return func() {
+		restoreHost()
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// Sets an environment variable, and returns a function which restores its previous value
+func setEnv(key, value string) func() {
+	previous, set := os.LookupEnv(key)
+	os.Setenv(key, value)
+	return func() {
+		if set {
+			os.Setenv(key, previous)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+// Writes a Docker configuration with the given content to a temporary directory, and points DOCKER_CONFIG to it until
+// the returned function is called
+func useDockerConfig(t *testing.T, config string) func() {
+	dir, err := ioutil.TempDir("", "maru-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	restore := setEnv("DOCKER_CONFIG", dir)
+	return func() {
+		restore()
+		os.RemoveAll(dir)
+	}
+}
+
+// Writes a stream of JSON messages, as returned by the Engine API for builds and pushes
+func writeJSONMessages(w http.ResponseWriter, messages ...interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	for _, m := range messages {
+		json.NewEncoder(w).Encode(m)
+	}
+}
+
+// Runs fn with the standard output redirected, and returns what it printed
+func captureStdout(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	output := make(chan string)
+	go func() {
+		var b bytes.Buffer
+		io.Copy(&b, r)
+		output <- b.String()
+	}()
+	defer func() {
+		os.Stdout = stdout
+	}()
+	fn()
+	w.Close()
+	return <-output
+}
+
+func TestDockerBuildImage(t *testing.T) {
+
+	defer useDockerConfig(t, `{"auths":{"https://index.docker.io/v1/":{"auth":"Ym9iOnB3"}}}`)()
+	defer setEnv("MARU_TEST_TOKEN", "s3cret")()
+
+	sessions, err := session.NewManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var query map[string][]string
+	var contextFiles []string
+	var registryConfig, secret, username string
+	var pushed []string
+	defer startFakeDaemon(t, func(w http.ResponseWriter, r *http.Request, path string) {
+		switch {
+		case path == "/session":
+			sessions.HandleHTTPRequest(context.Background(), w, r)
+		case path == "/build":
+			query = r.URL.Query()
+			registryConfig = r.Header.Get("X-Registry-Config")
+			tr := tar.NewReader(r.Body)
+			for {
+				header, err := tr.Next()
+				if err != nil {
+					break
+				}
+				contextFiles = append(contextFiles, header.Name)
+			}
+
+			// The builder reads the secret and the registry credentials from the session of the client
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			caller, err := sessions.Get(ctx, query["session"][0], false)
+			if err != nil {
+				writeJSONMessages(w, map[string]string{"error": err.Error()})
+				return
+			}
+			if data, err := secrets.GetSecret(ctx, caller, "git_token"); err == nil {
+				secret = string(data)
+			}
+			creds, err := auth.NewAuthClient(caller.Conn()).Credentials(ctx,
+				&auth.CredentialsRequest{Host: dockerHubRegistryHost})
+			if err == nil {
+				username = creds.Username
+			}
+			writeJSONMessages(w, map[string]interface{}{"aux": map[string]string{"ID": "sha256:123"}, "id": "moby.image.id"})
+		case strings.HasSuffix(path, "/push"):
+			pushed = append(pushed, path+":"+r.URL.Query().Get("tag"))
+			writeJSONMessages(w, map[string]string{"status": "Pushed"})
+		default:
+			http.NotFound(w, r)
+		}
+	})()
+
+	dir, err := ioutil.TempDir("", "maru-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644)
+
+	value := "1"
+	engine := &dockerEngine{}
+	err = engine.BuildImage(ImageBuild{
+		Dir:        dir,
+		Dockerfile: "FROM scratch\n",
+		Tags:       []string{"myapp:1.0"},
+		BuildArgs:  map[string]*string{"A": &value},
+		Secrets:    []string{"id=git_token,env=MARU_TEST_TOKEN"},
+		CacheTo:    []string{"lab/myapp-buildcache"},
+	})
+	if err != nil {
+		t.Fatalf("BuildImage() error = %v", err)
+	}
+
+	if got := query["t"]; strings.Join(got, " ") != "myapp:1.0 lab/myapp-buildcache" {
+		t.Errorf("tags = %q, want the image and the cache image", got)
+	}
+	if got := query["buildargs"]; len(got) != 1 || !strings.Contains(got[0], `"BUILDKIT_INLINE_CACHE":"1"`) {
+		t.Errorf("build args = %q, want the inline cache enabled", got)
+	}
+	if got := query["version"]; len(got) != 1 || got[0] != "2" {
+		t.Errorf("version = %q, want BuildKit", got)
+	}
+	sort.Strings(contextFiles)
+	if got := strings.Join(contextFiles, " "); got != ContextDockerfilePath+" main.go" {
+		t.Errorf("build context = %q", got)
+	}
+	if secret != "s3cret" {
+		t.Errorf("secret = %q, want it read from the environment through the session", secret)
+	}
+	if username != "bob" {
+		t.Errorf("registry username = %q, want the saved login", username)
+	}
+	decoded, _ := base64.URLEncoding.DecodeString(registryConfig)
+	if !strings.Contains(string(decoded), `"https://index.docker.io/v1/":{"username":"bob","password":"pw"`) {
+		t.Errorf("registry config = %s, want the saved login", decoded)
+	}
+	if strings.Join(pushed, " ") != "/images/lab/myapp-buildcache/push:latest" {
+		t.Errorf("pushed = %q, want the cache image", pushed)
+	}
+}
+
+func TestDockerBuildImageFails(t *testing.T) {
+
+	defer useDockerConfig(t, `{}`)()
+	defer startFakeDaemon(t, func(w http.ResponseWriter, r *http.Request, path string) {
+		switch path {
+		case "/session":
+			w.WriteHeader(http.StatusNotFound)
+		case "/build":
+			writeJSONMessages(w, map[string]interface{}{
+				"errorDetail": map[string]string{"message": "process did not complete successfully"},
+				"error":       "process did not complete successfully",
+			})
+		}
+	})()
+
+	dir, err := ioutil.TempDir("", "maru-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = (&dockerEngine{}).BuildImage(ImageBuild{Dir: dir, Dockerfile: "FROM scratch\n", CacheTo: []string{"x:cache"}})
+	if err == nil || !strings.Contains(err.Error(), "did not complete successfully") {
+		t.Errorf("BuildImage() error = %v, want the error of the build", err)
+	}
+}
+
+// Writes a frame of the multiplexed stream of a container without a TTY
+func writeStdFrame(w io.Writer, stream byte, data string) {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+	w.Write(append(header, data...))
+}
+
+func TestDockerRunContainer(t *testing.T) {
+	tests := []struct {
+		name       string
+		run        ContainerRun
+		exitCode   int
+		waitError  string
+		wantOutput string
+		wantErr    string
+	}{
+		{
+			name:       "exit code",
+			run:        ContainerRun{Image: "myapp:1.0"},
+			exitCode:   3,
+			wantOutput: "hello\n",
+		},
+		{
+			name:       "no TTY without a terminal",
+			run:        ContainerRun{Image: "myapp:1.0", Tty: true},
+			wantOutput: "hello\n",
+		},
+		{
+			name:      "wait error",
+			run:       ContainerRun{Image: "myapp:1.0"},
+			waitError: "container was removed",
+			wantErr:   "container was removed",
+		},
+		{
+			name:    "missing image",
+			run:     ContainerRun{Image: "missing:1.0"},
+			wantErr: "image missing:1.0 was not found",
+		},
+	}
+
+	// Standard input isn't a terminal, even if the tests are run from one
+	stdin := os.Stdin
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	os.Stdin = devNull
+	defer func() { os.Stdin = stdin }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var config map[string]interface{}
+			defer startFakeDaemon(t, func(w http.ResponseWriter, r *http.Request, path string) {
+				switch path {
+				case "/containers/create":
+					json.NewDecoder(r.Body).Decode(&config)
+					if config["Image"] == "missing:1.0" {
+						w.WriteHeader(http.StatusNotFound)
+						json.NewEncoder(w).Encode(map[string]string{"message": "No such image"})
+						return
+					}
+					w.WriteHeader(http.StatusCreated)
+					json.NewEncoder(w).Encode(map[string]string{"Id": "c1"})
+				case "/containers/c1/attach":
+					conn, buf, err := w.(http.Hijacker).Hijack()
+					if err != nil {
+						return
+					}
+					defer conn.Close()
+					buf.WriteString("HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\n" +
+						"Connection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+					writeStdFrame(buf, 1, "hello\n")
+					writeStdFrame(buf, 2, "an error\n")
+					buf.Flush()
+				case "/containers/c1/wait":
+					result := map[string]interface{}{"StatusCode": tt.exitCode}
+					if tt.waitError != "" {
+						result["Error"] = map[string]string{"Message": tt.waitError}
+					}
+					json.NewEncoder(w).Encode(result)
+				case "/containers/c1/start":
+					w.WriteHeader(http.StatusNoContent)
+				default:
+					http.NotFound(w, r)
+				}
+			})()
+
+			var exitCode int
+			var err error
+			output := captureStdout(t, func() {
+				exitCode, err = (&dockerEngine{}).RunContainer(tt.run)
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("RunContainer() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RunContainer() error = %v", err)
+			}
+			if exitCode != tt.exitCode {
+				t.Errorf("RunContainer() = %d, want %d", exitCode, tt.exitCode)
+			}
+			if output != tt.wantOutput {
+				t.Errorf("output = %q, want %q", output, tt.wantOutput)
+			}
+			if config["Tty"] != false {
+				t.Errorf("Tty = %v, want false because standard input isn't a terminal", config["Tty"])
+			}
+		})
+	}
+}
+
+// Returns a digest which is different for each given string
+func fakeDigest(s string) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(s)))
+}
+
+func TestDockerPushManifestList(t *testing.T) {
+
+	defer useDockerConfig(t, `{}`)()
+
+	var manifestPath, manifestType string
+	var list manifestlist.ManifestList
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodPut && strings.Contains(r.URL.Path, "/manifests/"):
+			manifestPath, manifestType = r.URL.Path, r.Header.Get("Content-Type")
+			json.NewDecoder(r.Body).Decode(&list)
+			w.Header().Set("Docker-Content-Digest", "sha256:"+strings.Repeat("f", 64))
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer registry.Close()
+	target := strings.TrimPrefix(registry.URL, "http://") + "/lab/myapp:1.0"
+
+	var tagged, pushed []string
+	source := ""
+	defer startFakeDaemon(t, func(w http.ResponseWriter, r *http.Request, path string) {
+		switch {
+		case strings.HasSuffix(path, "/json"):
+			arch := "amd64"
+			if strings.Contains(path, "arm64") {
+				arch = "arm64"
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"Id": "sha256:" + arch, "Os": "linux", "Architecture": arch})
+		case strings.HasSuffix(path, "/tag"):
+			source = strings.TrimSuffix(strings.TrimPrefix(path, "/images/"), "/tag")
+			tagged = append(tagged, source+" "+r.URL.Query().Get("repo")+":"+r.URL.Query().Get("tag"))
+			w.WriteHeader(http.StatusCreated)
+		case strings.HasSuffix(path, "/push"):
+			tag := r.URL.Query().Get("tag")
+			pushed = append(pushed, tag)
+			writeJSONMessages(w,
+				map[string]string{"status": "Pushed"},
+				map[string]interface{}{"aux": map[string]interface{}{"Tag": tag, "Digest": fakeDigest(source), "Size": 528}})
+		default:
+			http.NotFound(w, r)
+		}
+	})()
+
+	err := (&dockerEngine{}).PushManifestList("myapp:1.0", target, []string{"linux/amd64", "linux/arm64"})
+	if err != nil {
+		t.Fatalf("PushManifestList() error = %v", err)
+	}
+
+	if strings.Join(pushed, " ") != "1.0-linux-amd64 1.0-linux-arm64" {
+		t.Errorf("pushed tags = %q, want the image of each platform pushed under its own tag", pushed)
+	}
+	wantTagged := []string{
+		"myapp:1.0-linux-amd64 " + target + "-linux-amd64",
+		"myapp:1.0-linux-arm64 " + target + "-linux-arm64",
+		"myapp:1.0 " + target,
+	}
+	if strings.Join(tagged, "\n") != strings.Join(wantTagged, "\n") {
+		t.Errorf("tagged = %q, want %q", tagged, wantTagged)
+	}
+	if manifestPath != "/v2/lab/myapp/manifests/1.0" || manifestType != manifestlist.MediaTypeManifestList {
+		t.Errorf("manifest list was put to %s as %s", manifestPath, manifestType)
+	}
+	var got []string
+	for _, m := range list.Manifests {
+		got = append(got, fmt.Sprintf("%s/%s %s %d", m.Platform.OS, m.Platform.Architecture, m.Digest, m.Size))
+	}
+	want := []string{
+		"linux/amd64 " + fakeDigest("myapp:1.0-linux-amd64") + " 528",
+		"linux/arm64 " + fakeDigest("myapp:1.0-linux-arm64") + " 528",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("manifests = %q, want %q", got, want)
+	}
+}
+
+func TestDockerPushManifestListFailure(t *testing.T) {
+
+	defer useDockerConfig(t, `{}`)()
+
+	manifestPut := false
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			manifestPut = true
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer registry.Close()
+	target := strings.TrimPrefix(registry.URL, "http://") + "/lab/myapp:1.0"
+
+	var tagged []string
+	defer startFakeDaemon(t, func(w http.ResponseWriter, r *http.Request, path string) {
+		switch {
+		case strings.HasSuffix(path, "/json"):
+			json.NewEncoder(w).Encode(map[string]interface{}{"Id": "sha256:1", "Os": "linux", "Architecture": "amd64"})
+		case strings.HasSuffix(path, "/tag"):
+			tagged = append(tagged, r.URL.Query().Get("repo")+":"+r.URL.Query().Get("tag"))
+			w.WriteHeader(http.StatusCreated)
+		case strings.HasSuffix(path, "/push"):
+			tag := r.URL.Query().Get("tag")
+			if strings.HasSuffix(tag, "arm64") {
+				writeJSONMessages(w, map[string]string{"error": "denied"})
+				return
+			}
+			writeJSONMessages(w,
+				map[string]interface{}{"aux": map[string]interface{}{"Tag": tag, "Digest": fakeDigest(tag), "Size": 528}})
+		default:
+			http.NotFound(w, r)
+		}
+	})()
+
+	err := (&dockerEngine{}).PushManifestList("myapp:1.0", target, []string{"linux/amd64", "linux/arm64"})
+	if err == nil {
+		t.Fatal("PushManifestList() succeeded, want an error")
+	}
+	for _, tag := range tagged {
+		if tag == target {
+			t.Errorf("%s was tagged although a platform failed to push", target)
+		}
+	}
+	if manifestPut {
+		t.Errorf("the manifest list was pushed although a platform failed to push")
+	}
+}
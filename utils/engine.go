@@ -0,0 +1,275 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// EngineName selects the container engine, set by the --engine flag, MARU_ENGINE or the user configuration.
+// If it's empty, the engine is detected.
+var EngineName string
+
+// Engine builds, runs and publishes images using a container engine such as Docker or Podman
+type Engine interface {
+	// Name of the engine, e.g. podman
+	Name() string
+	// Command which runs and manages the images of the engine, which is podman for Buildah
+	Command() string
+	BuildImage(b ImageBuild) error
+	TagImage(source, target string) error
+	PushImage(image string) error
+	// PushManifestList pushes the images of a multi-platform build to the registry, as one manifest list with the
+	// given name
+	PushManifestList(image, target string, platforms []string) error
+	// ImagePlatforms returns the platforms which a local image was built for, e.g. linux/amd64, or none if it
+	// doesn't exist
+	ImagePlatforms(image string) ([]string, error)
+	// RunContainer runs a container and returns its exit code
+	RunContainer(r ContainerRun) (int, error)
+	// ContainerOutput runs a command in a new container of the image, instead of its entrypoint, and returns what it
+	// printed. The container is removed afterwards.
+	ContainerOutput(image string, command []string) ([]byte, error)
+	// InspectImage returns the details of a local image, or nil if it doesn't exist
+	InspectImage(image string) (*ImageDetails, error)
+	// ListImages returns the local tags of the given repository, e.g. myapp:1.0.0
+	ListImages(repository string) ([]string, error)
+	// ResolveDigest returns the digest which the given image reference currently points to in its registry
+	ResolveDigest(image string) (string, error)
+	// SingularitySource returns the transport and reference with which Singularity can read a local image, e.g.
+	// docker-daemon and myapp:1.0.0, and a function which cleans up anything that was exported for it
+	SingularitySource(image string) (string, string, func(), error)
+}
+
+// ImageBuild describes an image to build
+type ImageBuild struct {
+	// Directory which is sent as the build context
+	Dir string
+	// Content of the Dockerfile, which is built instead of any Dockerfile in the directory
+	Dockerfile string
+	Tags       []string
+	// Stage of the Dockerfile to build, or empty for the last one
+	Target string
+	// Build arguments. A nil value takes the variable from the environment.
+	BuildArgs map[string]*string
+	// Labels of the image, e.g. org.opencontainers.image.source
+	Labels map[string]string
+	// BuildKit secrets and SSH agents, e.g. id=git_token,env=GITHUB_TOKEN and default
+	Secrets []string
+	SSH     []string
+	// Registry images which the build cache is imported from and exported to
+	CacheFrom []string
+	CacheTo   []string
+	// Build every step again instead of using the cache
+	NoCache bool
+	// Pull newer versions of the base images
+	Pull bool
+	// Platforms to build for, e.g. linux/arm64, or none to build for the platform of the engine
+	Platforms []string
+}
+
+// ContainerRun describes a container to run
+type ContainerRun struct {
+	Image      string
+	Entrypoint []string
+	Cmd        []string
+	Env        []string
+	User       string
+	// Allocate a pseudo-TTY, which is only done if the standard input is a terminal
+	Tty bool
+}
+
+// ImageDetails describes a local image
+type ImageDetails struct {
+	ID           string
+	Created      string
+	Size         int64
+	Architecture string
+	Variant      string
+	Os           string
+	Labels       map[string]string
+	Env          []string
+	Entrypoint   []string
+	Cmd          []string
+	Layers       []string
+}
+
+// Platform returns the platform of the image, e.g. linux/arm64/v8
+func (d *ImageDetails) Platform() string {
+	platform := d.Os + "/" + d.Architecture
+	if d.Variant != "" {
+		platform += "/" + d.Variant
+	}
+	return platform
+}
+
+// Engines which are supported, in the order they are detected
+var engineNames = []string{"docker", "podman", "nerdctl", "buildah"}
+
+var engine Engine
+
+// GetEngine returns the container engine selected by the user, or the first one which is installed
+func GetEngine() Engine {
+
+	if engine != nil {
+		return engine
+	}
+
+	name := EngineName
+	if name == "" {
+		name = detectEngine()
+		PrintDebug("Using container engine %s", name)
+	}
+
+	switch name {
+	case "docker":
+		engine = &dockerEngine{}
+	case "podman":
+		engine = newPodmanEngine()
+	case "nerdctl":
+		engine = newNerdctlEngine()
+	case "buildah":
+		engine = newBuildahEngine()
+	default:
+		PrintFatal("Unknown container engine %s. Supported engines are: %s", name, strings.Join(engineNames, ", "))
+	}
+	return engine
+}
+
+// Returns docker if its daemon is configured or its command is installed, or else the first engine that is installed
+func detectEngine() string {
+	if os.Getenv("DOCKER_HOST") != "" || FileExists("/var/run/docker.sock") {
+		return "docker"
+	}
+	for _, name := range engineNames {
+		if _, err := exec.LookPath(name); err == nil {
+			return name
+		}
+	}
+	return "docker"
+}
+
+// Returns the build arguments as KEY=value, or as KEY for those taken from the environment, in a stable order
+func formatBuildArgList(buildArgs map[string]*string) []string {
+	var list []string
+	for key, value := range buildArgs {
+		if value == nil {
+			list = append(list, key)
+		} else {
+			list = append(list, key+"="+*value)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Returns the arguments of a build command which are shared by the docker, podman, nerdctl and buildah CLIs,
+// without the command itself, the cache and the build context
+func getBuildCommandArgs(b ImageBuild, dockerfilePath string) []string {
+
+	args := []string{"-f", dockerfilePath}
+	for _, buildArg := range formatBuildArgList(b.BuildArgs) {
+		args = append(args, "--build-arg", buildArg)
+	}
+
+	var keys []string
+	for key := range b.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "--label", key+"="+b.Labels[key])
+	}
+
+	// Secrets and SSH agents are only available to RUN instructions which mount them
+	for _, secret := range b.Secrets {
+		args = append(args, "--secret", secret)
+	}
+	for _, s := range b.SSH {
+		args = append(args, "--ssh", s)
+	}
+
+	if b.NoCache {
+		args = append(args, "--no-cache")
+	}
+	if b.Pull {
+		args = append(args, "--pull")
+	}
+
+	if b.Target != "" {
+		args = append(args, "--target", b.Target)
+	}
+	if len(b.Platforms) > 0 {
+		args = append(args, "--platform", strings.Join(b.Platforms, ","))
+	}
+
+	for _, tag := range b.Tags {
+		args = append(args, "-t", tag)
+	}
+	return args
+}
+
+// Returns the arguments which import and export the build cache with BuildKit, as used by nerdctl.
+// All intermediate layers are exported, not only those of the final image.
+func getBuildKitCacheArgs(b ImageBuild) []string {
+	var args []string
+	if !b.NoCache {
+		for _, ref := range b.CacheFrom {
+			args = append(args, "--cache-from", "type=registry,ref="+ref)
+		}
+	}
+	for _, ref := range b.CacheTo {
+		args = append(args, "--cache-to", "type=registry,ref="+ref+",mode=max")
+	}
+	return args
+}
+
+// Builds an image by running a command, e.g. docker build. The Dockerfile is written to a temporary file, so that
+// the project's Dockerfile is left as it is, and getArgs returns the arguments which build with that file.
+func runBuildCommand(command string, b ImageBuild, getArgs func(dockerfilePath string) []string) error {
+
+	f, err := ioutil.TempFile("", "maru_Dockerfile_")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(b.Dockerfile)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	args := getArgs(f.Name())
+	PrintHint("%% %s %s", command, strings.Join(args, " "))
+	if err = RunCommand(command, args...); err != nil {
+		return fmt.Errorf("command `%s %s` failed with %s", command, args[0], err)
+	}
+	return nil
+}
+
+// GetPlatformTag returns the tag of the image built for one platform of a multi-platform build, e.g.
+// myapp:1.0.0-linux-arm64
+func GetPlatformTag(image string, platform string) string {
+	return image + "-" + strings.ReplaceAll(platform, "/", "-")
+}
+
+// Orders the platforms so that the platform of this machine comes first, if it's one of them, because the image
+// for the first platform is the one which is run locally. Containers run on Linux, also on a Mac.
+func sortPlatforms(platforms []string) []string {
+	native := "linux/" + runtime.GOARCH
+	sorted := []string{}
+	for _, platform := range platforms {
+		if platform == native || strings.HasPrefix(platform, native+"/") {
+			sorted = append([]string{platform}, sorted...)
+		} else {
+			sorted = append(sorted, platform)
+		}
+	}
+	return sorted
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetBuildCommandArgs(t *testing.T) {
+	release := "release"
+	tests := []struct {
+		name  string
+		build ImageBuild
+		want  string
+	}{
+		{
+			name:  "tags",
+			build: ImageBuild{Dir: ".", Tags: []string{"myapp:latest", "myapp:1.0.0"}},
+			want:  "-f /tmp/Dockerfile -t myapp:latest -t myapp:1.0.0",
+		},
+		{
+			name: "build arguments and labels are sorted",
+			build: ImageBuild{
+				BuildArgs: map[string]*string{"BUILD_TYPE": &release, "GITHUB_TOKEN": nil, "A": &release},
+				Labels:    map[string]string{"org.opencontainers.image.version": "1.0.0", "maintainer": "me"},
+				Tags:      []string{"myapp:latest"},
+			},
+			want: "-f /tmp/Dockerfile --build-arg A=release --build-arg BUILD_TYPE=release --build-arg GITHUB_TOKEN " +
+				"--label maintainer=me --label org.opencontainers.image.version=1.0.0 -t myapp:latest",
+		},
+		{
+			name: "secrets and SSH agents",
+			build: ImageBuild{
+				Secrets: []string{"id=git_token,env=GITHUB_TOKEN"},
+				SSH:     []string{"default"},
+				Tags:    []string{"myapp:latest"},
+			},
+			want: "-f /tmp/Dockerfile --secret id=git_token,env=GITHUB_TOKEN --ssh default -t myapp:latest",
+		},
+		{
+			name: "options",
+			build: ImageBuild{
+				NoCache:   true,
+				Pull:      true,
+				Target:    "builder",
+				Platforms: []string{"linux/amd64", "linux/arm64"},
+				Tags:      []string{"myapp:latest"},
+			},
+			want: "-f /tmp/Dockerfile --no-cache --pull --target builder --platform linux/amd64,linux/arm64 -t myapp:latest",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(getBuildCommandArgs(tt.build, "/tmp/Dockerfile"), " "); got != tt.want {
+				t.Errorf("getBuildCommandArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetBuildKitCacheArgs(t *testing.T) {
+	tests := []struct {
+		name  string
+		build ImageBuild
+		want  string
+	}{
+		{name: "no cache", build: ImageBuild{}, want: ""},
+		{
+			name: "import and export",
+			build: ImageBuild{
+				CacheFrom: []string{"ghcr.io/me/myapp-buildcache:main"},
+				CacheTo:   []string{"ghcr.io/me/myapp-buildcache:dev"},
+			},
+			want: "--cache-from type=registry,ref=ghcr.io/me/myapp-buildcache:main " +
+				"--cache-to type=registry,ref=ghcr.io/me/myapp-buildcache:dev,mode=max",
+		},
+		{
+			name:  "only exported without the cache",
+			build: ImageBuild{NoCache: true, CacheFrom: []string{"myapp-buildcache"}, CacheTo: []string{"myapp-buildcache"}},
+			want:  "--cache-to type=registry,ref=myapp-buildcache,mode=max",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(getBuildKitCacheArgs(tt.build), " "); got != tt.want {
+				t.Errorf("getBuildKitCacheArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// Matches the scp-like syntax for SSH URLs accepted by git, e.g. git@github.com:org/repo.git
+var scpLikeUrlRegex = regexp.MustCompile(`^(?:[\w.-]+@)?([\w.-]+):[^/].*$`)
+
+// ValidateRepoUrl checks that the given URL is a git URL which Maru can build from: https, ssh (including the
+// scp-like syntax) or file.
+func ValidateRepoUrl(repoUrl string) error {
+
+	if m := scpLikeUrlRegex.FindStringSubmatch(repoUrl); m != nil && !strings.Contains(repoUrl, "://") {
+		return nil
+	}
+
+	u, err := url.Parse(repoUrl)
+	if err != nil {
+		return fmt.Errorf("problem parsing Git URL: %s", err)
+	}
+
+	switch u.Scheme {
+	case "https", "ssh":
+		if u.Host == "" {
+			return fmt.Errorf("URL must contain valid hostname")
+		}
+	case "file":
+		if u.Path == "" {
+			return fmt.Errorf("URL must contain a path")
+		}
+	default:
+		return fmt.Errorf("URL must begin with https, ssh or file")
+	}
+
+	return nil
+}
+
+// KnownHostsSecretID is the id of the BuildKit secret holding the known_hosts file, which the host keys of ssh
+// repositories are verified against when they are cloned by the build
+const KnownHostsSecretID = "known_hosts"
+
+// GetSSHHost returns the host of an ssh repository URL as it's written in a known_hosts file, e.g. github.com, or
+// [git.example.org]:2222 for a non-standard port. Returns an empty string for other URLs.
+func GetSSHHost(repoUrl string) string {
+	if m := scpLikeUrlRegex.FindStringSubmatch(repoUrl); m != nil && !strings.Contains(repoUrl, "://") {
+		return m[1]
+	}
+	u, err := url.Parse(repoUrl)
+	if err != nil || u.Scheme != "ssh" {
+		return ""
+	}
+	if port := u.Port(); port != "" && port != "22" {
+		return "[" + u.Hostname() + "]:" + port
+	}
+	return u.Hostname()
+}
+
+// CheckKnownHost checks that the known_hosts file has a key for the given host, so that a build which can't verify
+// the host fails before it starts. The check is skipped if ssh-keygen isn't installed.
+func CheckKnownHost(knownHostsFile, host string) error {
+	if !FileExists(knownHostsFile) {
+		return fmt.Errorf("%s does not exist", knownHostsFile)
+	}
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		PrintDebug("Cannot check %s for %s: %s", knownHostsFile, host, err)
+		return nil
+	}
+	// ssh-keygen exits with 1 if the host isn't found, also for hashed host names
+	if err := exec.Command("ssh-keygen", "-F", host, "-f", knownHostsFile).Run(); err != nil {
+		return fmt.Errorf("%s has no key for %s", knownHostsFile, host)
+	}
+	return nil
+}
+
+// GetLocalRepoPath returns the local path for a file:// URL, or an empty string for any other URL
+func GetLocalRepoPath(repoUrl string) string {
+	u, err := url.Parse(repoUrl)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return u.Path
+}
+
+// GetGitRevision returns the short commit hash of HEAD in the given directory, and whether the working tree
+// has any uncommitted changes. Returns an error if the directory is not a git checkout.
+func GetGitRevision(dir string) (string, bool, error) {
+
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		return "", false, fmt.Errorf("%s is not a git repository", dir)
+	}
+	revision := strings.TrimSpace(string(out))
+
+	out, err = exec.Command("git", "-C", dir, "status", "--porcelain").Output()
+	if err != nil {
+		return "", false, err
+	}
+	dirty := strings.TrimSpace(string(out)) != ""
+
+	return revision, dirty, nil
+}
+
+// Matches a full commit hash
+var commitRegex = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Commits which were already resolved, keyed by repository URL and ref
+var resolvedCommits = make(map[string]string)
+
+// ResolveGitCommit returns the full hash of the commit which the given tag or branch points to in the repository.
+// Remote repositories are queried with git ls-remote, so nothing is cloned.
+func ResolveGitCommit(repoUrl, ref string) (string, error) {
+
+	if commitRegex.MatchString(ref) {
+		return ref, nil
+	}
+	cacheKey := repoUrl + "#" + ref
+	if commit, ok := resolvedCommits[cacheKey]; ok {
+		return commit, nil
+	}
+
+	commit := ""
+	if path := GetLocalRepoPath(repoUrl); path != "" {
+		out, err := exec.Command("git", "-C", path, "rev-parse", ref+"^{commit}").Output()
+		if err != nil {
+			return "", fmt.Errorf("%s not found in %s", ref, repoUrl)
+		}
+		commit = strings.TrimSpace(string(out))
+	} else {
+		PrintDebug("Resolving %s in %s...", ref, repoUrl)
+		cmd := exec.Command("git", "ls-remote", repoUrl, ref, ref+"^{}")
+		// Fail instead of asking for credentials
+		cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+		out, err := cmd.Output()
+		if err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+				err = fmt.Errorf("%s", strings.TrimSpace(string(exitErr.Stderr)))
+			}
+			return "", fmt.Errorf("could not query %s: %s", repoUrl, err)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) != 2 {
+				continue
+			}
+			// Annotated tags are listed twice, and the peeled ref^{} is the commit they point to
+			if commit == "" || strings.HasSuffix(fields[1], "^{}") {
+				commit = fields[0]
+			}
+		}
+		if commit == "" {
+			return "", fmt.Errorf("%s not found in %s", ref, repoUrl)
+		}
+	}
+
+	resolvedCommits[cacheKey] = commit
+	return commit, nil
+}
+
+// PinGitCommit makes ResolveGitCommit return the given commit for the ref, e.g. the commit recorded in maru.lock
+func PinGitCommit(repoUrl, ref, commit string) {
+	resolvedCommits[repoUrl+"#"+ref] = commit
+}
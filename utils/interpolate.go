@@ -0,0 +1,256 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Time used by ${date:...}, so that every value interpolated during one run of Maru uses the same date. Commands
+// other than build use the time of the last build instead, see InterpolationTime.
+var interpolationTime = time.Now()
+
+// Set by UseCurrentTime for commands which create new images, and so don't use the time of the last build
+var useCurrentTime = false
+
+// Placeholder for ${git_commit} when interpolating offline
+var offlineGitCommit = strings.Repeat("0", 40)
+
+// Layout used by ${date} when none is given
+const defaultDateLayout = "20060102"
+
+// Variables which can also be written without braces, as in older versions of Maru, e.g. $version
+var bareVariables = []string{"version", "name", "git_tag", "git_commit"}
+
+// errNotSet is returned for a variable which has no value, so that its default can be used instead
+type errNotSet struct {
+	variable string
+}
+
+func (e errNotSet) Error() string {
+	return fmt.Sprintf("%s is not set", e.variable)
+}
+
+// interpolation is the state of a single interpolation
+type interpolation struct {
+	// Variables whose values are currently being interpolated, to detect cycles
+	resolving []string
+	// Whether to avoid looking up values over the network
+	offline bool
+}
+
+// Interpolate replaces the variables in the given string with their values. The supported variables are:
+//
+//	${version}              the container version
+//	${name}                 the container name
+//	${git_tag}              the GIT_TAG build argument
+//	${git_commit}           the full hash of the commit that GIT_TAG points to in the repository
+//	${date:20060102-1504}   the current date and time, formatted using a Go time layout
+//	${env:VAR}              the environment variable VAR
+//
+// Any variable can be given a default which is used when it is empty or unset, e.g. ${env:REGISTRY:-janeliascicomp}.
+// Use $$ for a literal $. The variables version, name, git_tag and git_commit can also be written without braces.
+//
+// ${git_commit} is the commit pinned in the maru.lock if it was locked for the same repository and tag, and is
+// otherwise looked up in the repository. ${date} is the time of the last build, except when building, so that
+// commands run after the build such as push use the same version.
+func (c *MaruConfig) Interpolate(s string) (string, error) {
+	return c.interpolate(s, interpolation{})
+}
+
+// InterpolateOffline interpolates the string in the same way as Interpolate, but without looking anything up in
+// the repository, which is enough to check it for errors. ${git_commit} is replaced by a placeholder.
+func (c *MaruConfig) InterpolateOffline(s string) (string, error) {
+	return c.interpolate(s, interpolation{offline: true})
+}
+
+// UseCurrentTime makes ${date} use the current time instead of the time of the last build, for the build itself
+func UseCurrentTime() {
+	useCurrentTime = true
+}
+
+// Interpolates the string in the given state
+func (c *MaruConfig) interpolate(s string, state interpolation) (string, error) {
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+
+		if s[i] != '$' || i+1 == len(s) {
+			sb.WriteByte(s[i])
+			continue
+		}
+
+		switch {
+		case s[i+1] == '$':
+			sb.WriteByte('$')
+			i++
+
+		case s[i+1] == '{':
+			end := findClosingBrace(s, i+2)
+			if end < 0 {
+				return "", fmt.Errorf("missing } in %s", s)
+			}
+			value, err := c.interpolateExpression(s[i+2:end], state)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(value)
+			i = end
+
+		default:
+			name := bareVariableAt(s[i+1:])
+			if name == "" {
+				// Not a variable, e.g. a shell variable in a build argument
+				sb.WriteByte('$')
+				continue
+			}
+			value, err := c.resolveVariable(name, "", state)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(value)
+			i += len(name)
+		}
+	}
+	return sb.String(), nil
+}
+
+// Returns the index of the } which closes the expression starting at the given index, or -1 if there is none
+func findClosingBrace(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			depth++
+			i++
+		case s[i] == '}':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		}
+	}
+	return -1
+}
+
+// Returns the name of the bare variable at the start of the string, or an empty string if there isn't one
+func bareVariableAt(s string) string {
+	end := 0
+	for end < len(s) && (s[end] == '_' || s[end] >= 'a' && s[end] <= 'z') {
+		end++
+	}
+	for _, name := range bareVariables {
+		if s[:end] == name {
+			return name
+		}
+	}
+	return ""
+}
+
+// Interpolates the expression found between ${ and }, e.g. "env:HOME:-/root"
+func (c *MaruConfig) interpolateExpression(expr string, state interpolation) (string, error) {
+
+	name, arg := expr, ""
+	if i := strings.Index(expr, ":"); i >= 0 {
+		name, arg = expr[:i], expr[i+1:]
+	}
+
+	defaultValue, hasDefault := "", false
+	if i := strings.Index(arg, ":-"); i >= 0 && (name == "env" || name == "date") {
+		arg, defaultValue, hasDefault = arg[:i], arg[i+2:], true
+	} else if strings.HasPrefix(arg, "-") && name != "env" && name != "date" {
+		arg, defaultValue, hasDefault = "", arg[1:], true
+	} else if arg != "" && name != "env" && name != "date" {
+		return "", fmt.Errorf("invalid variable ${%s}", expr)
+	}
+
+	value, err := c.resolveVariable(name, arg, state)
+	if _, notSet := err.(errNotSet); err != nil && !notSet {
+		return "", err
+	}
+	if value == "" && hasDefault {
+		return c.interpolate(defaultValue, state)
+	}
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// Returns the value of the given variable
+func (c *MaruConfig) resolveVariable(name, arg string, state interpolation) (string, error) {
+
+	for _, r := range state.resolving {
+		if r == name {
+			return "", fmt.Errorf("cyclic reference: %s -> %s", strings.Join(state.resolving, " -> "), name)
+		}
+	}
+	state.resolving = append(state.resolving[:len(state.resolving):len(state.resolving)], name)
+
+	switch name {
+	case "version":
+		return c.interpolate(c.Version, state)
+	case "name":
+		return c.Name, nil
+	case "git_tag":
+		return c.interpolate(c.BuildArgs["GIT_TAG"], state)
+	case "git_commit":
+		tag, err := c.interpolate(c.BuildArgs["GIT_TAG"], state)
+		if err != nil {
+			return "", err
+		}
+		if state.offline {
+			return offlineGitCommit, nil
+		}
+		return c.resolveGitCommit(tag)
+	case "date":
+		if arg == "" {
+			arg = defaultDateLayout
+		}
+		return InterpolationTime().Format(arg), nil
+	case "env":
+		if arg == "" {
+			return "", fmt.Errorf("missing variable name in ${env:}")
+		}
+		value, ok := os.LookupEnv(arg)
+		if !ok {
+			return "", errNotSet{"environment variable " + arg}
+		}
+		return value, nil
+	}
+
+	return "", fmt.Errorf("unknown variable %s", name)
+}
+
+// Returns the commit which the tag points to, preferring the one pinned in the maru.lock
+func (c *MaruConfig) resolveGitCommit(tag string) (string, error) {
+	repoUrl := c.TemplateArgs.Build.RepoUrl
+	if tag == "" {
+		tag = "HEAD"
+	}
+	if lock := ReadLock(); lock != nil && lock.RepoUrl == repoUrl && lock.GitTag == tag && lock.GitCommit != "" {
+		return lock.GitCommit, nil
+	}
+	return ResolveGitCommit(repoUrl, tag)
+}
+
+// InterpolationTime returns the time used by ${date}, which is the time of the last build recorded in the project,
+// unless UseCurrentTime was called or the project was never built
+func InterpolationTime() time.Time {
+	if !useCurrentTime {
+		if state := ReadBuildState(); state != nil && !state.Time.IsZero() {
+			return state.Time
+		}
+	}
+	return interpolationTime
+}
+
+// Interpolates the string, or quits with an error message naming the setting it came from
+func (c *MaruConfig) mustInterpolate(setting, s string) string {
+	value, err := c.Interpolate(s)
+	if err != nil {
+		PrintFatal("Error in %s: %s", setting, err)
+	}
+	return value
+}
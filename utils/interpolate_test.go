@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns a configuration for testing interpolation
+func newInterpolationConfig(version, gitTag string) *MaruConfig {
+	c := NewMaruConfig("myapp", version)
+	c.BuildArgs = map[string]string{"GIT_TAG": gitTag}
+	c.TemplateArgs.Build.RepoUrl = "https://github.com/example/repo.git"
+	return c
+}
+
+// Runs the test in a new temporary directory, which is removed afterwards
+func inTempDir(t *testing.T, test func()) {
+	dir, err := ioutil.TempDir("", "maru-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(cwd)
+	test()
+}
+
+func TestInterpolate(t *testing.T) {
+	os.Setenv("MARU_TEST_REGISTRY", "registry.example.org")
+	os.Unsetenv("MARU_TEST_UNSET")
+	os.Setenv("MARU_TEST_EMPTY", "")
+
+	tests := []struct {
+		name    string
+		version string
+		gitTag  string
+		s       string
+		want    string
+		wantErr string
+	}{
+		{name: "no variables", s: "plain text", want: "plain text"},
+		{name: "version", version: "1.0.0", s: "${version}", want: "1.0.0"},
+		{name: "name", s: "${name}:latest", want: "myapp:latest"},
+		{name: "git tag", gitTag: "v1.0", s: "${git_tag}", want: "v1.0"},
+		{name: "version from git tag", version: "${git_tag}", gitTag: "v2.1", s: "${version}", want: "v2.1"},
+		{name: "git tag from version", version: "1.2.3", gitTag: "v${version}", s: "${git_tag}", want: "v1.2.3"},
+		{name: "bare variables", version: "1.0", gitTag: "main", s: "$name-$version-$git_tag", want: "myapp-1.0-main"},
+		{name: "shell variables are kept", s: "$HOME/${name}", want: "$HOME/myapp"},
+		{name: "trailing dollar", s: "cost$", want: "cost$"},
+		{name: "escaped dollar", s: "$${version}", want: "${version}"},
+		{name: "environment variable", s: "${env:MARU_TEST_REGISTRY}/lab", want: "registry.example.org/lab"},
+		{name: "environment variable default", s: "${env:MARU_TEST_UNSET:-janeliascicomp}", want: "janeliascicomp"},
+		{name: "empty environment variable default", s: "${env:MARU_TEST_EMPTY:-default}", want: "default"},
+		{name: "empty environment variable", s: "[${env:MARU_TEST_EMPTY}]", want: "[]"},
+		{name: "nested default", s: "${env:MARU_TEST_UNSET:-${name}}", want: "myapp"},
+		{name: "default of empty variable", gitTag: "", s: "${git_tag:-main}", want: "main"},
+		{name: "default not used", gitTag: "v1", s: "${git_tag:-main}", want: "v1"},
+		{name: "date", s: "${date:2006-01-02}", want: "2020-12-31"},
+		{name: "default date layout", s: "${date}", want: "20201231"},
+		{name: "unset environment variable", s: "${env:MARU_TEST_UNSET}", wantErr: "environment variable MARU_TEST_UNSET is not set"},
+		{name: "missing environment variable name", s: "${env:}", wantErr: "missing variable name"},
+		{name: "unknown variable", s: "${nope}", wantErr: "unknown variable nope"},
+		{name: "argument for variable without one", s: "${name:x}", wantErr: "invalid variable ${name:x}"},
+		{name: "missing brace", s: "${version", wantErr: "missing }"},
+		{name: "cycle", version: "${git_tag}", gitTag: "${version}", s: "${version}", wantErr: "cyclic reference: version -> git_tag -> version"},
+	}
+
+	useCurrentTime = true
+	interpolationTime = time.Date(2020, 12, 31, 23, 59, 0, 0, time.UTC)
+	defer func() { useCurrentTime, interpolationTime = false, time.Now() }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newInterpolationConfig(tt.version, tt.gitTag)
+			got, err := c.Interpolate(tt.s)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Interpolate(%q) error = %v, want %q", tt.s, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Interpolate(%q) error = %v", tt.s, err)
+			}
+			if got != tt.want {
+				t.Errorf("Interpolate(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterpolateGitCommit(t *testing.T) {
+	commit := strings.Repeat("a", 40)
+	locked := strings.Repeat("b", 40)
+
+	inTempDir(t, func() {
+		c := newInterpolationConfig("1.0-${git_commit}", "v1.0")
+		PinGitCommit(c.TemplateArgs.Build.RepoUrl, "v1.0", commit)
+		defer delete(resolvedCommits, c.TemplateArgs.Build.RepoUrl+"#v1.0")
+
+		if got, err := c.InterpolateOffline("${version}"); err != nil || got != "1.0-"+offlineGitCommit {
+			t.Errorf("InterpolateOffline() = %q, %v, want the placeholder commit", got, err)
+		}
+		if got, err := c.Interpolate("${version}"); err != nil || got != "1.0-"+commit {
+			t.Errorf("Interpolate() = %q, %v, want the resolved commit", got, err)
+		}
+
+		// The commit pinned in the lock is used, but only if it's for the same repository and tag
+		WriteLock(&MaruLock{RepoUrl: c.TemplateArgs.Build.RepoUrl, GitTag: "v1.0", GitCommit: locked})
+		if got, err := c.Interpolate("${git_commit}"); err != nil || got != locked {
+			t.Errorf("Interpolate() = %q, %v, want the locked commit", got, err)
+		}
+		WriteLock(&MaruLock{RepoUrl: c.TemplateArgs.Build.RepoUrl, GitTag: "v0.9", GitCommit: locked})
+		if got, err := c.Interpolate("${git_commit}"); err != nil || got != commit {
+			t.Errorf("Interpolate() = %q, %v, want the resolved commit", got, err)
+		}
+	})
+}
+
+func TestInterpolateBuildTime(t *testing.T) {
+	buildTime := time.Date(2021, 3, 4, 5, 6, 0, 0, time.UTC)
+
+	inTempDir(t, func() {
+		c := newInterpolationConfig("${date:20060102-1504}", "")
+
+		// Without a recorded build, the current time is used
+		if got := c.mustInterpolate("version", "${version}"); got != interpolationTime.Format("20060102-1504") {
+			t.Errorf("version = %q, want the current time", got)
+		}
+
+		WriteBuildState(&BuildState{Time: buildTime})
+		if got := c.mustInterpolate("version", "${version}"); got != "20210304-0506" {
+			t.Errorf("version = %q, want the time of the build", got)
+		}
+
+		useCurrentTime = true
+		defer func() { useCurrentTime = false }()
+		if got := c.mustInterpolate("version", "${version}"); got != interpolationTime.Format("20060102-1504") {
+			t.Errorf("version = %q, want the current time when building", got)
+		}
+	})
+}
+
+func TestGetVersionIsResolvedOnce(t *testing.T) {
+	c := newInterpolationConfig("${git_tag}-${env:MARU_TEST_VERSION}", "v1")
+	os.Setenv("MARU_TEST_VERSION", "a")
+	defer os.Unsetenv("MARU_TEST_VERSION")
+
+	if got := c.GetVersion(); got != "v1-a" {
+		t.Fatalf("GetVersion() = %q, want v1-a", got)
+	}
+	os.Setenv("MARU_TEST_VERSION", "b")
+	if got := c.GetVersion(); got != "v1-a" {
+		t.Errorf("GetVersion() = %q, want the version resolved before", got)
+	}
+
+	// Changing the settings it depends on resolves it again, e.g. when a profile builds another Git tag
+	c.BuildArgs["GIT_TAG"] = "v2"
+	if got := c.GetVersion(); got != "v2-b" {
+		t.Errorf("GetVersion() = %q, want v2-b", got)
+	}
+}
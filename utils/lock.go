@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// LockFile pins the inputs of the build, so that rebuilding the same version produces the same image
+const LockFile = "maru.lock"
+
+// MaruLock records the exact commit and base images which a build used
+type MaruLock struct {
+	RepoUrl    string            `yaml:"repo_url,omitempty"`
+	GitTag     string            `yaml:"git_tag,omitempty"`
+	GitCommit  string            `yaml:"git_commit,omitempty"`
+	BaseImages map[string]string `yaml:"base_images,omitempty"`
+}
+
+// ReadLock reads the lock file in the current directory. Returns nil if there is no lock file.
+func ReadLock() *MaruLock {
+
+	if !FileExists(LockFile) {
+		return nil
+	}
+
+	raw, err := ioutil.ReadFile(LockFile)
+	if err != nil {
+		PrintFatal("Error reading %s: %s", LockFile, err)
+	}
+
+	var l = &MaruLock{}
+	err = yaml.Unmarshal(raw, l)
+	if err != nil {
+		PrintFatal("Error reading %s: %s", LockFile, err)
+	}
+
+	return l
+}
+
+// WriteLock writes the lock file in the current directory
+func WriteLock(l *MaruLock) {
+
+	raw, err := yaml.Marshal(l)
+	if err != nil {
+		PrintFatal("Error creating %s: %s", LockFile, err)
+	}
+
+	header := "# Generated by Maru. Use `maru lock --update` to pin newer commits and base images.\n"
+	PrintDebug("Writing to %s...", LockFile)
+	err = ioutil.WriteFile(LockFile, append([]byte(header), raw...), 0644)
+	if err != nil {
+		PrintFatal("Error writing %s: %s", LockFile, err)
+	}
+}
+
+// StaleReason describes how the lock differs from the given inputs, or returns an empty string if it pins exactly
+// those inputs
+func (l *MaruLock) StaleReason(repoUrl, gitTag string, baseImages []string) string {
+
+	if l == nil {
+		return LockFile + " does not exist"
+	}
+	if l.RepoUrl != repoUrl {
+		return "the repository changed"
+	}
+	if l.GitTag != gitTag {
+		return fmt.Sprintf("the Git tag changed from %s to %s", l.GitTag, gitTag)
+	}
+	if repoUrl != "" && l.GitCommit == "" {
+		return "no commit is pinned"
+	}
+	if len(l.BaseImages) != len(baseImages) {
+		return "the base images changed"
+	}
+	for _, image := range baseImages {
+		if _, ok := l.BaseImages[image]; !ok {
+			return fmt.Sprintf("the base image %s is not pinned", image)
+		}
+	}
+	return ""
+}
+
+// GetBaseImages returns the external images which the given Dockerfile builds on, in the order they first appear.
+// Build stages, scratch, images which are already pinned to a digest, and images named using build arguments are
+// not included.
+func GetBaseImages(dockerfile string) []string {
+	return getFromImages(dockerfile, false)
+}
+
+// GetFromImages returns every external image which the given Dockerfile builds on, including images which are
+// pinned to a digest, in the order they first appear
+func GetFromImages(dockerfile string) []string {
+	return getFromImages(dockerfile, true)
+}
+
+// Returns the external images in the FROM instructions of the Dockerfile, optionally including pinned images
+func getFromImages(dockerfile string, includePinned bool) []string {
+
+	stages := make(map[string]bool)
+	seen := make(map[string]bool)
+	var images []string
+
+	scanner := bufio.NewScanner(strings.NewReader(dockerfile))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
+		fields = fields[1:]
+		for len(fields) > 0 && strings.HasPrefix(fields[0], "--") {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		image := fields[0]
+		external := !stages[strings.ToLower(image)] && image != "scratch" &&
+			(includePinned || !strings.Contains(image, "@")) && !strings.Contains(image, "$")
+		if len(fields) >= 3 && strings.EqualFold(fields[1], "AS") {
+			stages[strings.ToLower(fields[2])] = true
+		}
+		if external && !seen[image] {
+			seen[image] = true
+			images = append(images, image)
+		}
+	}
+	return images
+}
+
+// ResolveImageDigest returns the digest which the given image reference currently points to in its registry, using
+// the selected container engine
+func ResolveImageDigest(image string) (string, error) {
+	return GetEngine().ResolveDigest(image)
+}
+
+// SortedBaseImages returns the pinned base images in a stable order
+func (l *MaruLock) SortedBaseImages() []string {
+	var images []string
+	for image := range l.BaseImages {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+	return images
+}
+
+// PinBaseImages returns the Dockerfile with the given base images replaced by their digests, e.g.
+// FROM ubuntu:18.04 becomes FROM ubuntu:18.04@sha256:...
+func PinBaseImages(dockerfile string, digests map[string]string) string {
+
+	lines := strings.SplitAfter(dockerfile, "\n")
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
+		image := ""
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "--") {
+				image = field
+				break
+			}
+		}
+		if digest, ok := digests[image]; ok {
+			// Only the image is replaced, not a stage with the same name
+			imageRegex := regexp.MustCompile(`\s` + regexp.QuoteMeta(image) + `(\s|$)`)
+			if loc := imageRegex.FindStringSubmatchIndex(line); loc != nil {
+				lines[i] = line[:loc[2]] + "@" + digest + line[loc[2]:]
+			}
+		}
+	}
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestGetBaseImages(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		want       []string
+		wantAll    []string
+	}{
+		{
+			name:       "single stage",
+			dockerfile: "FROM ubuntu:18.04\nRUN make\n",
+			want:       []string{"ubuntu:18.04"},
+		},
+		{
+			name: "multi-stage",
+			dockerfile: "FROM janeliascicomp/builder:1.2.1 as builder\nRUN make\n\n" +
+				"from builder AS tested\nRUN make test\n\n" +
+				"FROM openjdk:8-jre\nCOPY --from=builder /app /app\n",
+			want: []string{"janeliascicomp/builder:1.2.1", "openjdk:8-jre"},
+		},
+		{
+			name:       "platform flag",
+			dockerfile: "FROM --platform=$BUILDPLATFORM golang:1.15 AS build\nFROM --platform=linux/amd64 alpine:3.12\n",
+			want:       []string{"golang:1.15", "alpine:3.12"},
+		},
+		{
+			name:       "each image once",
+			dockerfile: "FROM ubuntu:18.04 AS a\nFROM ubuntu:18.04 AS b\n",
+			want:       []string{"ubuntu:18.04"},
+		},
+		{
+			name: "scratch, pinned images and build arguments",
+			dockerfile: "ARG BASE=ubuntu\nFROM $BASE\nFROM ${BASE}:18.04\nFROM scratch\n" +
+				"FROM alpine:3.12@" + testDigest + "\n",
+			want:    nil,
+			wantAll: []string{"alpine:3.12@" + testDigest},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetBaseImages(tt.dockerfile); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetBaseImages() = %q, want %q", got, tt.want)
+			}
+			wantAll := tt.wantAll
+			if wantAll == nil {
+				wantAll = tt.want
+			}
+			if got := GetFromImages(tt.dockerfile); !reflect.DeepEqual(got, wantAll) {
+				t.Errorf("GetFromImages() = %q, want %q", got, wantAll)
+			}
+		})
+	}
+}
+
+func TestPinBaseImages(t *testing.T) {
+	digests := map[string]string{"ubuntu:18.04": testDigest, "golang:1.15": testDigest}
+	tests := []struct {
+		name       string
+		dockerfile string
+		want       string
+	}{
+		{
+			name:       "single stage",
+			dockerfile: "FROM ubuntu:18.04\nRUN make\n",
+			want:       "FROM ubuntu:18.04@" + testDigest + "\nRUN make\n",
+		},
+		{
+			name:       "multi-stage",
+			dockerfile: "FROM golang:1.15 AS build\nRUN make\nFROM build AS test\nFROM ubuntu:18.04\nCOPY --from=build /app /app\n",
+			want: "FROM golang:1.15@" + testDigest + " AS build\nRUN make\nFROM build AS test\nFROM ubuntu:18.04@" +
+				testDigest + "\nCOPY --from=build /app /app\n",
+		},
+		{
+			name:       "platform flag",
+			dockerfile: "FROM --platform=$BUILDPLATFORM golang:1.15 AS build\n",
+			want:       "FROM --platform=$BUILDPLATFORM golang:1.15@" + testDigest + " AS build\n",
+		},
+		{
+			name:       "stage with the name of the image",
+			dockerfile: "from ubuntu:18.04 as ubuntu:18.04\n",
+			want:       "from ubuntu:18.04@" + testDigest + " as ubuntu:18.04\n",
+		},
+		{
+			name:       "CRLF line endings",
+			dockerfile: "FROM ubuntu:18.04\r\nRUN make\r\n",
+			want:       "FROM ubuntu:18.04@" + testDigest + "\r\nRUN make\r\n",
+		},
+		{
+			name:       "images without a digest",
+			dockerfile: "FROM ubuntu:20.04\nFROM ubuntu\n",
+			want:       "FROM ubuntu:20.04\nFROM ubuntu\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PinBaseImages(tt.dockerfile, digests); got != tt.want {
+				t.Errorf("PinBaseImages() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStaleReason(t *testing.T) {
+	repoUrl := "https://github.com/example/repo.git"
+	lock := &MaruLock{
+		RepoUrl:    repoUrl,
+		GitTag:     "1.0.0",
+		GitCommit:  "0123456789abcdef0123456789abcdef01234567",
+		BaseImages: map[string]string{"ubuntu:18.04": testDigest},
+	}
+	tests := []struct {
+		name       string
+		lock       *MaruLock
+		repoUrl    string
+		gitTag     string
+		baseImages []string
+		want       string
+	}{
+		{name: "up to date", lock: lock, repoUrl: repoUrl, gitTag: "1.0.0", baseImages: []string{"ubuntu:18.04"}},
+		{name: "missing lock", repoUrl: repoUrl, gitTag: "1.0.0", want: "maru.lock does not exist"},
+		{name: "repository changed", lock: lock, repoUrl: "https://github.com/example/fork.git", gitTag: "1.0.0",
+			baseImages: []string{"ubuntu:18.04"}, want: "the repository changed"},
+		{name: "Git tag changed", lock: lock, repoUrl: repoUrl, gitTag: "1.1.0", baseImages: []string{"ubuntu:18.04"},
+			want: "the Git tag changed from 1.0.0 to 1.1.0"},
+		{name: "no commit", lock: &MaruLock{RepoUrl: repoUrl, GitTag: "1.0.0"}, repoUrl: repoUrl, gitTag: "1.0.0",
+			want: "no commit is pinned"},
+		{name: "base image added", lock: lock, repoUrl: repoUrl, gitTag: "1.0.0",
+			baseImages: []string{"ubuntu:18.04", "alpine:3.12"}, want: "the base images changed"},
+		{name: "base image replaced", lock: lock, repoUrl: repoUrl, gitTag: "1.0.0",
+			baseImages: []string{"ubuntu:20.04"}, want: "the base image ubuntu:20.04 is not pinned"},
+		{name: "project without a repository", lock: &MaruLock{BaseImages: map[string]string{}},
+			baseImages: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.lock.StaleReason(tt.repoUrl, tt.gitTag, tt.baseImages); got != tt.want {
+				t.Errorf("StaleReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadLock(t *testing.T) {
+	inTempDir(t, func() {
+		if lock := ReadLock(); lock != nil {
+			t.Errorf("ReadLock() = %+v without a lock file, want nil", lock)
+		}
+
+		lock := &MaruLock{
+			RepoUrl:    "https://github.com/example/repo.git",
+			GitTag:     "1.0.0",
+			GitCommit:  "0123456789abcdef0123456789abcdef01234567",
+			BaseImages: map[string]string{"ubuntu:18.04": testDigest},
+		}
+		WriteLock(lock)
+		raw, _ := ioutil.ReadFile(LockFile)
+		if !strings.HasPrefix(string(raw), "# Generated by Maru") {
+			t.Errorf("%s = %q, want a header", LockFile, raw)
+		}
+		if got := ReadLock(); !reflect.DeepEqual(got, lock) {
+			t.Errorf("ReadLock() = %+v, want %+v", got, lock)
+		}
+	})
+}
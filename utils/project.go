@@ -4,7 +4,10 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
+	"path"
+	"sort"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -12,13 +15,31 @@ import (
 // ConfFile is the maru configuration file for the project
 const ConfFile = "maru.yaml"
 
+// Labels which are added to every image, following the OCI image annotations
+const (
+	LabelCreated  = "org.opencontainers.image.created"
+	LabelSource   = "org.opencontainers.image.source"
+	LabelRevision = "org.opencontainers.image.revision"
+	LabelVersion  = "org.opencontainers.image.version"
+	LabelTitle    = "org.opencontainers.image.title"
+	// Version of Maru which built the image, and the flavor it was built with
+	LabelMaruVersion = "org.janelia.maru.version"
+	LabelMaruFlavor  = "org.janelia.maru.flavor"
+)
+
 // MaruConfig is the parsed configuration file in memory
 type MaruConfig struct {
 	MaruVersion string `yaml:"maru_version"`
 	Name        string
 	Version     string
-	Remotes     []string          `yaml:"remotes,omitempty"`
-	BuildArgs   map[string]string `yaml:"build_args,omitempty"`
+	Remotes     []string                `yaml:"remotes,omitempty"`
+	BuildArgs   map[string]string       `yaml:"build_args,omitempty"`
+	Secrets     []string                `yaml:"secrets,omitempty"`
+	SSH         []string                `yaml:"ssh,omitempty"`
+	Platforms   []string                `yaml:"platforms,omitempty"`
+	Labels      map[string]string       `yaml:"labels,omitempty"`
+	Cache       MaruCache               `yaml:"cache,omitempty"`
+	Profiles    map[string]*MaruProfile `yaml:"profiles,omitempty"`
 
 	TemplateArgs struct {
 		Flavor string
@@ -33,9 +54,12 @@ type MaruConfig struct {
 		} `yaml:"executable,omitempty"`
 
 		PythonConda struct {
-			PythonVersion      string `yaml:"python_version"`
-			Dependencies       string `yaml:"dependencies"`
-			RelativeScriptPath string `yaml:"script_path"`
+			PythonVersion      string   `yaml:"python_version,omitempty"`
+			EnvironmentFile    string   `yaml:"environment_file,omitempty"`
+			Channels           []string `yaml:"channels,omitempty"`
+			Dependencies       string   `yaml:"dependencies,omitempty"`
+			PipPackages        []string `yaml:"pip_packages,omitempty"`
+			RelativeScriptPath string   `yaml:"script_path"`
 		} `yaml:"python_conda,omitempty"`
 
 		JavaMaven struct {
@@ -49,23 +73,149 @@ type MaruConfig struct {
 			MacroName string `yaml:"macro_name"`
 		} `yaml:"fiji_macro,omitempty"`
 
+		RRenv struct {
+			RVersion           string `yaml:"r_version"`
+			LockfilePath       string `yaml:"lockfile_path,omitempty"`
+			Packages           string `yaml:"packages,omitempty"`
+			RelativeScriptPath string `yaml:"script_path"`
+		} `yaml:"r_renv,omitempty"`
+
 		MatlabCompiled struct {
+			RuntimeRelease string `yaml:"runtime_release"`
+			RuntimeUpdate  string `yaml:"runtime_update"`
+			CompiledDir    string `yaml:"compiled_dir"`
+			MainFunction   string `yaml:"main_function"`
 		} `yaml:"matlab_compiled,omitempty"`
+
+		// Answers for declarative flavors, keyed by flavor name and then by question key
+		Custom map[string]map[string]string `yaml:",inline"`
 	} `yaml:"template_args,omitempty"`
+
+	// Set by ApplyProfile for the selected profile, and not part of the maru.yaml
+	Profile   string   `yaml:"-"`
+	Target    string   `yaml:"-"`
+	ExtraTags []string `yaml:"-"`
+	// Whether the profile builds a different Git tag than the one which is locked
+	ProfileGitTag bool `yaml:"-"`
+
+	resolvedVersion *resolvedVersion
+}
+
+// resolvedVersion is the interpolated version, along with the settings it was resolved from
+type resolvedVersion struct {
+	key     string
+	version string
+}
+
+// MaruCache lists the registry images which hold the BuildKit cache, so that other machines can reuse the layers
+// of earlier builds
+type MaruCache struct {
+	From   []string `yaml:"from,omitempty"`
+	To     []string `yaml:"to,omitempty"`
+	Export bool     `yaml:"export,omitempty"`
+}
+
+// MaruProfile is a named variant of the build, e.g. dev or release, which overrides some of the settings
+type MaruProfile struct {
+	GitTag    string            `yaml:"git_tag,omitempty"`
+	BuildArgs map[string]string `yaml:"build_args,omitempty"`
+	// Additional tags for the image, e.g. stable
+	Tags []string `yaml:"tags,omitempty"`
+	// Stage of the Dockerfile to build
+	Target  string     `yaml:"target,omitempty"`
+	Cache   *MaruCache `yaml:"cache,omitempty"`
+	Remotes []string   `yaml:"remotes,omitempty"`
 }
 
 // NewMaruConfig is the constructor for a MaruConfig
 func NewMaruConfig(name string, version string) *MaruConfig {
 	c := &MaruConfig{}
+	c.MaruVersion = MaruVersion
 	c.Name = name
 	c.Version = version
 	return c
 }
 
+// ApplyProfile overrides the settings with those of the given profile. Build arguments are merged, while the cache
+// and remotes are replaced if the profile has them. The result must not be written back to the maru.yaml.
+func (c *MaruConfig) ApplyProfile(name string) error {
+
+	profile := c.Profiles[name]
+	if profile == nil {
+		var names []string
+		for n := range c.Profiles {
+			names = append(names, n)
+		}
+		if len(names) == 0 {
+			return fmt.Errorf("there is no profile %s, because no profiles are defined in %s", name, ConfFile)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("there is no profile %s. The profiles are: %s", name, strings.Join(names, ", "))
+	}
+
+	gitTag := c.BuildArgs["GIT_TAG"]
+	buildArgs := make(map[string]string)
+	for key, value := range c.BuildArgs {
+		buildArgs[key] = value
+	}
+	for key, value := range profile.BuildArgs {
+		buildArgs[key] = value
+	}
+	if profile.GitTag != "" {
+		buildArgs["GIT_TAG"] = profile.GitTag
+	}
+	c.BuildArgs = buildArgs
+
+	if profile.Cache != nil {
+		c.Cache = *profile.Cache
+	}
+	if profile.Remotes != nil {
+		c.Remotes = profile.Remotes
+	}
+	c.Profile = name
+	c.Target = profile.Target
+	c.ExtraTags = profile.Tags
+	c.ProfileGitTag = buildArgs["GIT_TAG"] != gitTag
+	return nil
+}
+
+// GetExtraTags returns the additional tags of the selected profile, after applying string interpolation, e.g.
+// name:stable
+func (c *MaruConfig) GetExtraTags() []string {
+	var tags []string
+	for _, tag := range c.ExtraTags {
+		tags = append(tags, c.Name+":"+c.mustInterpolate("profiles."+c.Profile+".tags", tag))
+	}
+	return tags
+}
+
+// GetImageLabels returns the labels of an image built from the given version and commit, followed by the labels in
+// the maru.yaml, which can override them. Empty values are left out.
+func (c *MaruConfig) GetImageLabels(version, revision string, created time.Time) map[string]string {
+	labels := map[string]string{
+		LabelCreated:     created.UTC().Format(time.RFC3339),
+		LabelSource:      c.TemplateArgs.Build.RepoUrl,
+		LabelRevision:    revision,
+		LabelVersion:     version,
+		LabelTitle:       c.Name,
+		LabelMaruVersion: MaruVersion,
+		LabelMaruFlavor:  c.TemplateArgs.Flavor,
+	}
+	for key, value := range c.Labels {
+		labels[key] = c.mustInterpolate("labels."+key, value)
+	}
+	for key, value := range labels {
+		if value == "" {
+			delete(labels, key)
+		}
+	}
+	return labels
+}
+
 // GetBuildArg returns the value of BuildArgs with the given key. Applies string interpolation to the value,
-// e.g. $version becomes the value of Version.
+// e.g. ${version} becomes the value of Version.
 func (c *MaruConfig) GetBuildArg(key string) string {
-	return strings.Replace(c.BuildArgs[key], "$version", c.Version, 1)
+	return c.mustInterpolate("build_args."+key, c.BuildArgs[key])
 }
 
 // SetBuildArg sets the given key/value pair in BuildArgs
@@ -82,24 +232,91 @@ func (c *MaruConfig) GetRepoTag() string {
 }
 
 // GetVersion returns the value of Version, after applying string interpolation,
-// e.g. $git_tag becomes the value of GIT_TAG in BuildArgs.
+// e.g. ${git_tag} becomes the value of GIT_TAG in BuildArgs. It's only resolved once for the same settings, so that
+// every tag and label uses the same version and the repository is only queried once.
 func (c *MaruConfig) GetVersion() string {
-	return strings.Replace(c.Version, "$git_tag", c.BuildArgs["GIT_TAG"], 1)
+	key := c.Version + "\n" + c.BuildArgs["GIT_TAG"] + "\n" + c.TemplateArgs.Build.RepoUrl
+	if c.resolvedVersion == nil || c.resolvedVersion.key != key {
+		c.resolvedVersion = &resolvedVersion{key, c.mustInterpolate("version", "${version}")}
+	}
+	return c.resolvedVersion.version
 }
 
-// GetNameVersion returns the versioned name of the container, e.g. name:version
+// GetNameVersion returns the versioned name of the container, e.g. name:version. A profile which builds another Git
+// tag adds its name, e.g. name:version-dev, so that its images are never taken for the release.
 func (c *MaruConfig) GetNameVersion() string {
+	if c.ProfileGitTag {
+		return c.Name + ":" + c.GetVersion() + "-" + c.Profile
+	}
 	return c.Name + ":" + c.GetVersion()
 }
 
+// GetTags returns the local tags of a build: name:latest, the versioned name and the additional tags of the profile.
+// Profiles which build another Git tag don't replace name:latest.
+func (c *MaruConfig) GetTags() []string {
+	tags := []string{c.GetNameVersion()}
+	if !c.ProfileGitTag {
+		tags = append([]string{c.GetNameLatest()}, tags...)
+	}
+	return append(tags, c.GetExtraTags()...)
+}
+
 // GetNameLatest returns the name of the container tagged with latest, e.g. name:latest
 func (c *MaruConfig) GetNameLatest() string {
 	return c.Name + ":latest"
 }
 
+// GetRemote returns the given remote, after applying string interpolation, e.g. ${env:REGISTRY}/lab
+func (c *MaruConfig) GetRemote(remote string) string {
+	return c.mustInterpolate("remotes", remote)
+}
+
 // GetDockerTag returns the namespaced tag for the given remote, e.g. remote/name:version
 func (c *MaruConfig) GetDockerTag(remote string) string {
-	return remote + "/" + c.GetNameVersion()
+	return c.GetRemote(remote) + "/" + c.GetNameVersion()
+}
+
+// GetCacheRef returns the default build cache image for the given remote, e.g. remote/name-buildcache. It is kept in
+// its own repository, because Podman and Buildah add a tag for each cached layer to the repository of the cache image.
+func (c *MaruConfig) GetCacheRef(remote string) string {
+	return c.GetRemote(remote) + "/" + c.Name + "-buildcache"
+}
+
+// GetCacheFrom returns the images which the build cache is imported from, after applying string interpolation.
+// By default, this is the cache image of each remote.
+func (c *MaruConfig) GetCacheFrom() []string {
+	if len(c.Cache.From) == 0 {
+		return c.getDefaultCacheRefs()
+	}
+	var refs []string
+	for _, ref := range c.Cache.From {
+		refs = append(refs, c.mustInterpolate("cache.from", ref))
+	}
+	return refs
+}
+
+// GetCacheTo returns the images which the build cache is exported to, after applying string interpolation. If
+// none are configured, the cache is only exported if Export is set, to the cache image of each remote.
+func (c *MaruConfig) GetCacheTo() []string {
+	if len(c.Cache.To) == 0 {
+		if c.Cache.Export {
+			return c.getDefaultCacheRefs()
+		}
+		return nil
+	}
+	var refs []string
+	for _, ref := range c.Cache.To {
+		refs = append(refs, c.mustInterpolate("cache.to", ref))
+	}
+	return refs
+}
+
+func (c *MaruConfig) getDefaultCacheRefs() []string {
+	var refs []string
+	for _, remote := range c.Remotes {
+		refs = append(refs, c.GetCacheRef(remote))
+	}
+	return refs
 }
 
 // GetBuildCommand returns the command to use for building the code, prepended with line continuation
@@ -110,12 +327,94 @@ func (c *MaruConfig) GetBuildCommand() string {
 	return "\\\n    && " + c.TemplateArgs.Build.Command
 }
 
+// GetFlavorArgs returns the answers stored for the current flavor, if it's a declarative flavor,
+// e.g. {{ .GetFlavorArgs.plugin_name }}
+func (c *MaruConfig) GetFlavorArgs() map[string]string {
+	return c.TemplateArgs.Custom[c.TemplateArgs.Flavor]
+}
+
+// SetFlavorArgs stores the answers for the given declarative flavor
+func (c *MaruConfig) SetFlavorArgs(flavor string, args map[string]string) {
+	if c.TemplateArgs.Custom == nil {
+		c.TemplateArgs.Custom = make(map[string]map[string]string)
+	}
+	c.TemplateArgs.Custom[flavor] = args
+}
+
+// GetMatlabRuntimeURL returns the download URL for the MATLAB Runtime installer matching the configured release and update
+func (c *MaruConfig) GetMatlabRuntimeURL() string {
+	mc := c.TemplateArgs.MatlabCompiled
+	zipName := "MATLAB_Runtime_" + mc.RuntimeRelease
+	if mc.RuntimeUpdate != "" && mc.RuntimeUpdate != "0" {
+		zipName += "_Update_" + mc.RuntimeUpdate
+	}
+	update := mc.RuntimeUpdate
+	if update == "" {
+		update = "0"
+	}
+	return "https://ssd.mathworks.com/supportfiles/downloads/" + mc.RuntimeRelease + "/Release/" + update +
+		"/deployment_files/installer/complete/glnxa64/" + zipName + "_glnxa64.zip"
+}
+
+// GetPythonEnvironmentType returns the kind of environment file used by the python_conda flavor, based on its name:
+// "conda" for a Conda environment.yml, "requirements" for a pip requirements.txt, "pyproject" for a pyproject.toml,
+// or an empty string if there is no environment file.
+func (c *MaruConfig) GetPythonEnvironmentType() string {
+	envFile := c.TemplateArgs.PythonConda.EnvironmentFile
+	if envFile == "" {
+		return ""
+	}
+	switch name := path.Base(envFile); {
+	case name == "pyproject.toml":
+		return "pyproject"
+	case strings.HasSuffix(name, ".yml") || strings.HasSuffix(name, ".yaml"):
+		return "conda"
+	case strings.HasSuffix(name, ".txt"):
+		return "requirements"
+	}
+	return "unknown"
+}
+
+// GetCondaCreateArgs returns the arguments for creating the Conda environment when there is no environment.yml,
+// e.g. python=3.8 -c conda-forge h5py=2.8.0
+func (c *MaruConfig) GetCondaCreateArgs() string {
+	pc := c.TemplateArgs.PythonConda
+	args := []string{"python=" + pc.PythonVersion}
+	for _, channel := range pc.Channels {
+		args = append(args, "-c", channel)
+	}
+	if pc.Dependencies != "" {
+		args = append(args, pc.Dependencies)
+	}
+	return strings.Join(args, " ")
+}
+
+// GetPipPackages returns the pip packages for the python_conda flavor, quoted so that version specifiers are
+// not interpreted by the shell
+func (c *MaruConfig) GetPipPackages() string {
+	packages := make([]string, len(c.TemplateArgs.PythonConda.PipPackages))
+	for i, p := range c.TemplateArgs.PythonConda.PipPackages {
+		packages[i] = "'" + p + "'"
+	}
+	return strings.Join(packages, " ")
+}
+
+// GetRPackages returns the configured R packages as a quoted, comma-separated list for use in an R vector
+func (c *MaruConfig) GetRPackages() string {
+	packages := strings.Fields(c.TemplateArgs.RRenv.Packages)
+	for i, p := range packages {
+		packages[i] = "\"" + p + "\""
+	}
+	return strings.Join(packages, ", ")
+}
+
 // HasRemotes returns true if the Remotes array is not empty
 func (c *MaruConfig) HasRemotes() bool {
 	return c.Remotes != nil && len(c.Remotes) > 0
 }
 
-// GetTemplateArgsChecksum calculates a checksum for the current values stored in the TemplateArgs
+// GetTemplateArgsChecksum calculates a checksum for the current values stored in the TemplateArgs. This is the
+// checksum which older versions of Maru wrote into the Dockerfile, so it's only used to compare against those.
 func (c *MaruConfig) GetTemplateArgsChecksum() string {
 	h := sha256.New()
 	s := fmt.Sprintf("%v", c.TemplateArgs)
@@ -124,11 +423,27 @@ func (c *MaruConfig) GetTemplateArgsChecksum() string {
 	return fmt.Sprintf("%x", sum)
 }
 
+// GetInputChecksum calculates a checksum of everything the Dockerfile is generated from: the whole project
+// configuration, which is available to the templates, and the hash of the templates themselves. The configuration
+// is marshalled as YAML, which is canonical because maps are written with their keys sorted.
+func (c *MaruConfig) GetInputChecksum(templateHash string) string {
+	raw, err := yaml.Marshal(c)
+	if err != nil {
+		PrintFatal("Error creating project config: %s", err)
+	}
+	return HashString(string(raw) + templateHash)
+}
+
 // WriteProjectConfig writes the given project configuration to the working directory
 func WriteProjectConfig(c *MaruConfig) {
 
-	// Always overwrite the Maru version with the current version
-	c.MaruVersion = MaruVersion
+	// Settings only understood by a newer version of Maru would be lost
+	if newer, err := CompareVersions(c.MaruVersion, MaruVersion); err != nil {
+		PrintFatal("Refusing to write %s, which has an invalid maru_version: %s", ConfFile, err)
+	} else if newer > 0 {
+		PrintFatal("Refusing to write %s, which was written by Maru %s. Please upgrade Maru, which is version %s.",
+			ConfFile, c.MaruVersion, MaruVersion)
+	}
 
 	raw, err := yaml.Marshal(&c)
 	if err != nil {
@@ -143,7 +458,19 @@ func WriteProjectConfig(c *MaruConfig) {
 }
 
 // ReadProjectConfig reads the current project configuration from the working directory. Returns nil if no file exists.
+// Quits if the file contains unknown keys or values of the wrong type, unless it was written by a newer version of
+// Maru.
 func ReadProjectConfig() *MaruConfig {
+	return readProjectConfig(true)
+}
+
+// ReadWorkspaceProjectConfig reads the project configuration in the working directory like ReadProjectConfig, but
+// without warning if it was written by another version of Maru. Workspaces report that for each project by name.
+func ReadWorkspaceProjectConfig() *MaruConfig {
+	return readProjectConfig(false)
+}
+
+func readProjectConfig(checkVersion bool) *MaruConfig {
 
 	PrintDebug("Checking for %s...", ConfFile)
 	if !FileExists(ConfFile) {
@@ -163,9 +490,76 @@ func ReadProjectConfig() *MaruConfig {
 		PrintFatal("Error reading config file: %s", err)
 	}
 
+	newer, err := CompareVersions(c.MaruVersion, MaruVersion)
+	if err != nil {
+		PrintError("%s", ReadConfigDocument().NewConfigError("maru_version", "Invalid maru_version: %s", err))
+		PrintFatal("Invalid project configuration")
+	}
+	if checkVersion {
+		checkConfigVersion(c)
+	}
+
+	// Keys added by a newer version of Maru are expected to be unknown
+	if newer <= 0 {
+		if errs := ReadConfigDocument().CheckKeys(); len(errs) > 0 {
+			for _, e := range errs {
+				PrintError("%s", e)
+			}
+			PrintFatal("Invalid project configuration")
+		}
+	}
+
 	return c
 }
 
+// ReadConfigDocument reads the current project configuration as a YAML document, to check its keys and find
+// where they are in the file
+func ReadConfigDocument() *ConfigDocument {
+	raw, err := ioutil.ReadFile(ConfFile)
+	if err != nil {
+		PrintFatal("Error reading config file: %s", err)
+	}
+	doc, err := ParseConfigDocument(raw)
+	if err != nil {
+		PrintFatal("Error reading config file: %s", err)
+	}
+	return doc
+}
+
+// Warns if the project configuration was written by a different version of Maru, which may interpret it differently
+func checkConfigVersion(c *MaruConfig) {
+	if problem := GetConfigVersionProblem(c); problem != "" {
+		PrintError("%s %s", ConfFile, problem)
+	}
+}
+
+// GetConfigVersionProblem describes why the version of Maru which wrote the project configuration doesn't match this
+// one, e.g. "was written by Maru 0.1.0. Run `maru upgrade` ...", or returns an empty string if it matches
+func GetConfigVersionProblem(c *MaruConfig) string {
+	newer, err := CompareVersions(c.MaruVersion, MaruVersion)
+	if err != nil {
+		return fmt.Sprintf("has an invalid maru_version: %s", err)
+	}
+	// The schema version is a valid version number, and the configuration's version was checked above
+	older, _ := CompareVersions(c.MaruVersion, SchemaVersion)
+	if newer > 0 {
+		return fmt.Sprintf("was written by Maru %s, which is newer than this version (%s). Some settings may be ignored.",
+			c.MaruVersion, MaruVersion)
+	} else if older < 0 {
+		return fmt.Sprintf("was written by Maru %s. Run `maru upgrade` to upgrade it to the current version.",
+			GetConfigVersion(c))
+	}
+	return ""
+}
+
+// GetConfigVersion returns the version of Maru which wrote the project configuration
+func GetConfigVersion(c *MaruConfig) string {
+	if c.MaruVersion == "" {
+		return "unknown"
+	}
+	return c.MaruVersion
+}
+
 // ReadMandatoryProjectConfig reads the current project configuration from the working directory.
 // Prints an errror message and quits if no configuration exists in the working directory.
 func ReadMandatoryProjectConfig() *MaruConfig {
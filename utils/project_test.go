@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProfileTags(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		want    string
+		wantGit bool
+	}{
+		{name: "no profile", want: "myapp:latest myapp:1.0.0"},
+		{name: "same Git tag", profile: "release", want: "myapp:latest myapp:1.0.0 myapp:stable"},
+		{name: "another Git tag", profile: "dev", want: "myapp:1.0.0-dev myapp:nightly", wantGit: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newInterpolationConfig("1.0.0", "1.0.0")
+			c.Profiles = map[string]*MaruProfile{
+				"release": {BuildArgs: map[string]string{"BUILD_TYPE": "release"}, Tags: []string{"stable"}},
+				"dev":     {GitTag: "main", Tags: []string{"nightly"}},
+			}
+			if tt.profile != "" {
+				if err := c.ApplyProfile(tt.profile); err != nil {
+					t.Fatalf("ApplyProfile() error = %v", err)
+				}
+			}
+			if c.ProfileGitTag != tt.wantGit {
+				t.Errorf("ProfileGitTag = %v, want %v", c.ProfileGitTag, tt.wantGit)
+			}
+			if got := strings.Join(c.GetTags(), " "); got != tt.want {
+				t.Errorf("GetTags() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/client"
+	"github.com/docker/distribution/registry/client/auth"
+	"github.com/docker/distribution/registry/client/auth/challenge"
+	"github.com/docker/distribution/registry/client/transport"
+	"github.com/docker/docker/api/types"
+)
+
+// PutManifestList uploads a manifest list with the given name to its registry. The manifests it refers to must have
+// been pushed to the same repository already. The Docker Engine can't push manifest lists, so the registry API is
+// used directly, with the credentials saved by `docker login`.
+func PutManifestList(target string, manifests []manifestlist.ManifestDescriptor) error {
+
+	named, err := reference.ParseNormalizedNamed(target)
+	if err != nil {
+		return err
+	}
+	tagged, ok := reference.TagNameOnly(named).(reference.Tagged)
+	if !ok {
+		return fmt.Errorf("%s has no tag", target)
+	}
+	registry := reference.Domain(named)
+	creds, err := getRegistryCredentials(registry)
+	if err != nil {
+		return err
+	}
+
+	baseURL := getRegistryURL(registry)
+	PrintDebug("Using registry API at %s", baseURL)
+	resp, err := http.Get(baseURL + "/v2/")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	// The response says how the registry authenticates, e.g. with a token from Docker Hub's auth server
+	challenges := challenge.NewSimpleManager()
+	if err = challenges.AddResponse(resp); err != nil {
+		return err
+	}
+	store := registryCredentialStore(creds)
+	authorizer := auth.NewAuthorizer(challenges,
+		auth.NewTokenHandler(http.DefaultTransport, store, reference.Path(named), "pull", "push"),
+		auth.NewBasicHandler(store))
+
+	path, err := reference.WithName(reference.Path(named))
+	if err != nil {
+		return err
+	}
+	repo, err := client.NewRepository(path, baseURL, transport.NewTransport(http.DefaultTransport, authorizer))
+	if err != nil {
+		return err
+	}
+
+	list, err := manifestlist.FromDescriptors(manifests)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	service, err := repo.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+	dgst, err := service.Put(ctx, list, distribution.WithTag(tagged.Tag()))
+	if err != nil {
+		return fmt.Errorf("cannot push manifest list %s: %s", target, err)
+	}
+	PrintDebug("Pushed manifest list %s@%s", target, dgst)
+	return nil
+}
+
+// Returns the URL of the API of the given registry. Docker Hub's API is served by registry-1.docker.io. Like the
+// Docker daemon, plain HTTP is used for registries on this machine and those configured as insecure registries.
+func getRegistryURL(registry string) string {
+	if registry == "docker.io" {
+		return "https://" + dockerHubRegistryHost
+	}
+	if isInsecureRegistry(registry) {
+		return "http://" + registry
+	}
+	return "https://" + registry
+}
+
+// Returns whether the daemon reaches the given registry over plain HTTP
+func isInsecureRegistry(registry string) bool {
+
+	host := registry
+	if h, _, err := net.SplitHostPort(registry); err == nil {
+		host = h
+	}
+	ip := net.ParseIP(host)
+	if host == "localhost" || ip != nil && ip.IsLoopback() {
+		return true
+	}
+
+	cli, err := NewDockerClient()
+	if err != nil {
+		return false
+	}
+	defer cli.Close()
+	info, err := cli.Info(context.Background())
+	if err != nil || info.RegistryConfig == nil {
+		PrintDebug("Cannot read the registry configuration of the daemon: %v", err)
+		return false
+	}
+	if index := info.RegistryConfig.IndexConfigs[registry]; index != nil {
+		return !index.Secure
+	}
+	for _, cidr := range info.RegistryConfig.InsecureRegistryCIDRs {
+		if ip != nil && (*net.IPNet)(cidr).Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// registryCredentialStore gives the credentials saved by `docker login` to the registry client
+type registryCredentialStore types.AuthConfig
+
+func (s registryCredentialStore) Basic(*url.URL) (string, string) {
+	return s.Username, s.Password
+}
+
+func (s registryCredentialStore) RefreshToken(*url.URL, string) string {
+	return s.IdentityToken
+}
+
+func (s registryCredentialStore) SetRefreshToken(*url.URL, string, string) {
+}
@@ -0,0 +1,226 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// Key of Docker Hub in the Docker configuration
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+// dockerConfig is the part of the Docker CLI configuration (~/.docker/config.json) which holds credentials
+type dockerConfig struct {
+	Auths       map[string]types.AuthConfig `json:"auths"`
+	CredsStore  string                      `json:"credsStore"`
+	CredHelpers map[string]string           `json:"credHelpers"`
+}
+
+// GetRegistryAuth returns the encoded credentials for the registry of the given image, which were saved by
+// `docker login`, or an empty string if there are none. Credential helpers such as docker-credential-desktop are
+// used in the same way as by the Docker CLI.
+func GetRegistryAuth(image string) (string, error) {
+
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", err
+	}
+	auth, err := getRegistryCredentials(reference.Domain(named))
+	if err != nil || auth == (types.AuthConfig{}) {
+		return "", err
+	}
+
+	raw, err := json.Marshal(auth)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(raw), nil
+}
+
+// GetAllRegistryAuths returns the credentials of every registry which has any saved by `docker login`, keyed by the
+// address of the registry in the Docker configuration, e.g. for pulling private base images
+func GetAllRegistryAuths() (map[string]types.AuthConfig, error) {
+
+	config, err := readDockerConfig()
+	if err != nil || config == nil {
+		return nil, err
+	}
+
+	var registries []string
+	for key := range config.Auths {
+		registries = append(registries, getRegistryHost(key))
+	}
+	for registry := range config.CredHelpers {
+		registries = append(registries, registry)
+	}
+	if config.CredsStore != "" {
+		stored, err := listHelperCredentials(config.CredsStore)
+		if err != nil {
+			return nil, err
+		}
+		for key := range stored {
+			registries = append(registries, getRegistryHost(key))
+		}
+	}
+
+	auths := make(map[string]types.AuthConfig)
+	for _, registry := range registries {
+		auth, err := getConfigCredentials(config, registry)
+		if err != nil {
+			return nil, err
+		}
+		if auth.Username != "" || auth.IdentityToken != "" {
+			auths[auth.ServerAddress] = auth
+		}
+	}
+	return auths, nil
+}
+
+// Returns the credentials for the given registry, e.g. docker.io, or empty credentials without the address of the
+// registry if there is no Docker configuration
+func getRegistryCredentials(registry string) (types.AuthConfig, error) {
+	config, err := readDockerConfig()
+	if err != nil || config == nil {
+		return types.AuthConfig{}, err
+	}
+	return getConfigCredentials(config, registry)
+}
+
+// Returns the credentials for the given registry from the Docker configuration or its credential helpers
+func getConfigCredentials(config *dockerConfig, registry string) (types.AuthConfig, error) {
+
+	key := registry
+	if registry == "docker.io" {
+		key = dockerHubAuthKey
+	}
+
+	var auth types.AuthConfig
+	var err error
+	if helper := config.CredHelpers[registry]; helper != "" {
+		auth, err = getHelperCredentials(helper, key)
+	} else if config.CredsStore != "" {
+		auth, err = getHelperCredentials(config.CredsStore, key)
+	} else {
+		auth = config.Auths[key]
+		if auth == (types.AuthConfig{}) {
+			// Logins are also saved with the URL of the registry, e.g. https://ghcr.io
+			for k, a := range config.Auths {
+				if getRegistryHost(k) == registry {
+					auth = a
+				}
+			}
+		}
+		if auth.Auth != "" {
+			err = decodeBasicAuth(&auth)
+		}
+	}
+	if err != nil {
+		return types.AuthConfig{}, fmt.Errorf("error getting credentials for %s: %s", registry, err)
+	}
+	auth.ServerAddress = key
+	return auth, nil
+}
+
+// Returns the registry of an address in the Docker configuration, e.g. docker.io for https://index.docker.io/v1/
+// and ghcr.io for https://ghcr.io
+func getRegistryHost(address string) string {
+	if address == dockerHubAuthKey {
+		return "docker.io"
+	}
+	host := strings.TrimPrefix(strings.TrimPrefix(address, "https://"), "http://")
+	return strings.SplitN(host, "/", 2)[0]
+}
+
+// Reads the Docker CLI configuration, from $DOCKER_CONFIG or ~/.docker. Returns nil if there is none.
+func readDockerConfig() (*dockerConfig, error) {
+
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var config dockerConfig
+	if err = json.Unmarshal(raw, &config); err != nil {
+		return nil, fmt.Errorf("error reading Docker configuration: %s", err)
+	}
+	return &config, nil
+}
+
+// Splits the base64 encoded user:password of a saved login into the username and password
+func decodeBasicAuth(auth *types.AuthConfig) error {
+	decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+	if err != nil {
+		return err
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid saved login")
+	}
+	auth.Username, auth.Password, auth.Auth = parts[0], parts[1], ""
+	return nil
+}
+
+// Asks a Docker credential helper, e.g. docker-credential-desktop, for the credentials of the given registry
+func getHelperCredentials(helper, serverURL string) (types.AuthConfig, error) {
+
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// Helpers report missing credentials on stdout
+		if strings.Contains(string(out), "credentials not found") {
+			return types.AuthConfig{}, nil
+		}
+		return types.AuthConfig{}, fmt.Errorf("docker-credential-%s failed: %s %s", helper, err,
+			strings.TrimSpace(stderr.String()))
+	}
+
+	var creds struct {
+		Username string
+		Secret   string
+	}
+	if err = json.Unmarshal(out, &creds); err != nil {
+		return types.AuthConfig{}, err
+	}
+	// Identity tokens are returned with a special user name
+	if creds.Username == "<token>" {
+		return types.AuthConfig{IdentityToken: creds.Secret}, nil
+	}
+	return types.AuthConfig{Username: creds.Username, Password: creds.Secret}, nil
+}
+
+// Asks a Docker credential helper for the addresses of the registries it has credentials for
+func listHelperCredentials(helper string) (map[string]string, error) {
+	out, err := exec.Command("docker-credential-"+helper, "list").Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker-credential-%s failed: %s", helper, err)
+	}
+	var list map[string]string
+	if err = json.Unmarshal(out, &list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
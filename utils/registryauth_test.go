@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+// Installs a Docker credential helper named test, which knows the credentials of ghcr.io and quay.io, and returns a
+// function which removes it again
+func installCredentialHelper(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "maru-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := `#!/bin/sh
+read server
+case "$1 $server" in
+	"get ghcr.io") echo '{"ServerURL":"ghcr.io","Username":"alice","Secret":"token1"}' ;;
+	"get quay.io") echo '{"ServerURL":"quay.io","Username":"<token>","Secret":"identity"}' ;;
+	"list "*) echo '{"ghcr.io":"alice"}' ;;
+	*) echo "credentials not found in native keychain"; exit 1 ;;
+esac
+`
+	if err = ioutil.WriteFile(filepath.Join(dir, "docker-credential-test"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	restore := setEnv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return func() {
+		restore()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestGetRegistryAuth(t *testing.T) {
+	defer installCredentialHelper(t)()
+
+	tests := []struct {
+		name    string
+		config  string
+		image   string
+		want    types.AuthConfig
+		wantErr bool
+	}{
+		{
+			name:   "docker hub login",
+			config: `{"auths":{"https://index.docker.io/v1/":{"auth":"Ym9iOnB3"}}}`,
+			image:  "janeliascicomp/fiji:latest",
+			want:   types.AuthConfig{Username: "bob", Password: "pw", ServerAddress: dockerHubAuthKey},
+		},
+		{
+			name:   "login saved with the URL of the registry",
+			config: `{"auths":{"https://registry.example.org":{"auth":"Ym9iOnB3"}}}`,
+			image:  "registry.example.org/lab/myapp:1.0",
+			want:   types.AuthConfig{Username: "bob", Password: "pw", ServerAddress: "registry.example.org"},
+		},
+		{
+			name:   "no login for the registry",
+			config: `{"auths":{"https://index.docker.io/v1/":{"auth":"Ym9iOnB3"}}}`,
+			image:  "registry.example.org/lab/myapp:1.0",
+			want:   types.AuthConfig{ServerAddress: "registry.example.org"},
+		},
+		{
+			name:   "credential helper for the registry",
+			config: `{"credHelpers":{"ghcr.io":"test"}}`,
+			image:  "ghcr.io/lab/myapp:1.0",
+			want:   types.AuthConfig{Username: "alice", Password: "token1", ServerAddress: "ghcr.io"},
+		},
+		{
+			name:   "identity token from the credentials store",
+			config: `{"credsStore":"test"}`,
+			image:  "quay.io/lab/myapp:1.0",
+			want:   types.AuthConfig{IdentityToken: "identity", ServerAddress: "quay.io"},
+		},
+		{
+			name:   "credentials not found by the store",
+			config: `{"credsStore":"test"}`,
+			image:  "myapp:1.0",
+			want:   types.AuthConfig{ServerAddress: dockerHubAuthKey},
+		},
+		{
+			name:    "missing credential helper",
+			config:  `{"credsStore":"missing"}`,
+			image:   "myapp:1.0",
+			wantErr: true,
+		},
+		{
+			name:    "invalid saved login",
+			config:  `{"auths":{"https://index.docker.io/v1/":{"auth":"Ym9i"}}}`,
+			image:   "myapp:1.0",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer useDockerConfig(t, tt.config)()
+			encoded, err := GetRegistryAuth(tt.image)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("GetRegistryAuth() error = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetRegistryAuth() error = %v", err)
+			}
+			raw, err := base64.URLEncoding.DecodeString(encoded)
+			if err != nil {
+				t.Fatalf("GetRegistryAuth() = %q, which isn't base64: %v", encoded, err)
+			}
+			var got types.AuthConfig
+			if err = json.Unmarshal(raw, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("GetRegistryAuth() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRegistryAuthWithoutConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maru-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer setEnv("DOCKER_CONFIG", dir)()
+
+	encoded, err := GetRegistryAuth("myapp:1.0")
+	if err != nil {
+		t.Fatalf("GetRegistryAuth() error = %v", err)
+	}
+	if encoded != "" {
+		t.Errorf("GetRegistryAuth() = %q, want no credentials", encoded)
+	}
+}
+
+func TestGetAllRegistryAuths(t *testing.T) {
+	defer installCredentialHelper(t)()
+	defer useDockerConfig(t, `{
+		"auths": {"https://index.docker.io/v1/": {"auth": "Ym9iOnB3"}, "registry.example.org": {}},
+		"credHelpers": {"quay.io": "test"}
+	}`)()
+
+	auths, err := GetAllRegistryAuths()
+	if err != nil {
+		t.Fatalf("GetAllRegistryAuths() error = %v", err)
+	}
+	want := map[string]types.AuthConfig{
+		dockerHubAuthKey: {Username: "bob", Password: "pw", ServerAddress: dockerHubAuthKey},
+		"quay.io":        {IdentityToken: "identity", ServerAddress: "quay.io"},
+	}
+	if len(auths) != len(want) {
+		t.Errorf("GetAllRegistryAuths() = %+v, want %+v", auths, want)
+	}
+	for key, auth := range want {
+		if auths[key] != auth {
+			t.Errorf("GetAllRegistryAuths()[%s] = %+v, want %+v", key, auths[key], auth)
+		}
+	}
+
+	// The registries are listed by the credentials store
+	defer useDockerConfig(t, `{"credsStore": "test"}`)()
+	auths, err = GetAllRegistryAuths()
+	if err != nil {
+		t.Fatalf("GetAllRegistryAuths() error = %v", err)
+	}
+	if len(auths) != 1 || auths["ghcr.io"].Username != "alice" {
+		t.Errorf("GetAllRegistryAuths() = %+v, want the login for ghcr.io", auths)
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !windows
+// +build !windows
+
+package utils
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Calls resize with the size of the terminal now and whenever it changes, until the returned function is called
+func monitorTerminalSize(resize func(height, width uint)) func() {
+
+	if height, width, ok := getTerminalSize(); ok {
+		resize(height, width)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGWINCH)
+	go func() {
+		for range signals {
+			if height, width, ok := getTerminalSize(); ok {
+				resize(height, width)
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(signals)
+	}
+}
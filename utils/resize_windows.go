@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package utils
+
+// Calls resize with the size of the terminal. Windows has no signal for size changes, so later changes are not seen.
+func monitorTerminalSize(resize func(height, width uint)) func() {
+	if height, width, ok := getTerminalSize(); ok {
+		resize(height, width)
+	}
+	return func() {}
+}
@@ -0,0 +1,543 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// ConfigError is a problem found in the project configuration. Line and Column give its position in the file,
+// or are zero if the problem isn't tied to a particular key.
+type ConfigError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e ConfigError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", ConfFile, e.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", ConfFile, e.Line, e.Column, e.Message)
+}
+
+// ConfigDocument is the YAML document of the project configuration, which remembers where each key was found
+type ConfigDocument struct {
+	root *yamlv3.Node
+}
+
+// ParseConfigDocument parses the project configuration without decoding it
+func ParseConfigDocument(raw []byte) (*ConfigDocument, error) {
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	d := &ConfigDocument{root: &doc}
+	if len(doc.Content) > 0 {
+		d.root = doc.Content[0]
+	}
+	return d, nil
+}
+
+// NewConfigError returns an error located at the given dotted path, or at the closest enclosing key which exists.
+// List items are given by their index, e.g. remotes.1 for the second remote.
+func (d *ConfigDocument) NewConfigError(path string, format string, a ...interface{}) ConfigError {
+	e := ConfigError{Message: fmt.Sprintf(format, a...)}
+	node := d.root
+	for _, key := range strings.Split(path, ".") {
+		if i, err := strconv.Atoi(key); err == nil && node.Kind == yamlv3.SequenceNode && i < len(node.Content) {
+			node = node.Content[i]
+			e.Line, e.Column = node.Line, node.Column
+			continue
+		}
+		if node.Kind != yamlv3.MappingNode {
+			break
+		}
+		var found *yamlv3.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				e.Line, e.Column = node.Content[i].Line, node.Content[i].Column
+				found = node.Content[i+1]
+			}
+		}
+		if found == nil {
+			break
+		}
+		node = found
+	}
+	return e
+}
+
+// CheckKeys checks that every key in the document is part of the project configuration, and that each value
+// has the right type
+func (d *ConfigDocument) CheckKeys() []ConfigError {
+	var errs []ConfigError
+	if d.root.Kind != 0 {
+		checkNode(d.root, reflect.TypeOf(MaruConfig{}), "", &errs)
+	}
+	return errs
+}
+
+// Checks the node against the given type, recursively
+func checkNode(node *yamlv3.Node, t reflect.Type, path string, errs *[]ConfigError) {
+
+	if node.Kind == yamlv3.AliasNode {
+		node = node.Alias
+	}
+	if node.Tag == "!!null" {
+		return
+	}
+
+	mismatch := func(expected string) {
+		*errs = append(*errs, ConfigError{node.Line, node.Column, fmt.Sprintf("%s must be %s", path, expected)})
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		checkNode(node, t.Elem(), path, errs)
+	case reflect.Struct:
+		if node.Kind != yamlv3.MappingNode {
+			mismatch("a mapping")
+			return
+		}
+		fields := ConfigFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			childPath := joinPath(path, key.Value)
+			if field, ok := fields[key.Value]; ok {
+				checkNode(value, field.Type, childPath, errs)
+			} else if inline := inlineMapType(t); inline != nil {
+				checkNode(value, inline.Elem(), childPath, errs)
+			} else {
+				message := "Unknown key " + childPath
+				if suggestion := closestKey(key.Value, fields); suggestion != "" {
+					message += fmt.Sprintf(" (did you mean %s?)", joinPath(path, suggestion))
+				}
+				*errs = append(*errs, ConfigError{key.Line, key.Column, message})
+			}
+		}
+	case reflect.Map:
+		if node.Kind != yamlv3.MappingNode {
+			mismatch("a mapping")
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			checkNode(node.Content[i+1], t.Elem(), joinPath(path, node.Content[i].Value), errs)
+		}
+	case reflect.Slice:
+		if node.Kind != yamlv3.SequenceNode {
+			mismatch("a list")
+			return
+		}
+		for i, item := range node.Content {
+			checkNode(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case reflect.String:
+		if node.Kind != yamlv3.ScalarNode {
+			mismatch("a string")
+		}
+	case reflect.Bool:
+		if _, err := strconv.ParseBool(node.Value); node.Kind != yamlv3.ScalarNode || err != nil {
+			mismatch("true or false")
+		}
+	}
+}
+
+// ConfigFields returns the fields of a configuration struct, keyed by their name in the YAML file. Fields which
+// are inlined are not included.
+func ConfigFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name, inline := yamlFieldName(field)
+		if !inline && name != "-" {
+			fields[name] = field
+		}
+	}
+	return fields
+}
+
+// Returns the name of the field in the YAML file, and whether it is inlined
+func yamlFieldName(field reflect.StructField) (string, bool) {
+	tag := strings.Split(field.Tag.Get("yaml"), ",")
+	for _, flag := range tag[1:] {
+		if flag == "inline" {
+			return "", true
+		}
+	}
+	if tag[0] != "" {
+		return tag[0], false
+	}
+	// The YAML library uses the lowercase field name by default
+	return strings.ToLower(field.Name), false
+}
+
+// Returns the type of the map inlined into the struct, or nil if there isn't one
+func inlineMapType(t reflect.Type) reflect.Type {
+	for i := 0; i < t.NumField(); i++ {
+		if _, inline := yamlFieldName(t.Field(i)); inline && t.Field(i).Type.Kind() == reflect.Map {
+			return t.Field(i).Type
+		}
+	}
+	return nil
+}
+
+// Returns the value of the map inlined into the struct
+func inlineMapValue(v reflect.Value) reflect.Value {
+	for i := 0; i < v.NumField(); i++ {
+		if _, inline := yamlFieldName(v.Type().Field(i)); inline && v.Field(i).Kind() == reflect.Map {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// Returns the known key which is most likely meant by a misspelled key, or an empty string if none is close
+func closestKey(key string, fields map[string]reflect.StructField) string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	best, bestDistance := "", 3
+	for _, name := range names {
+		if d := editDistance(key, name); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// Returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func minInt(values ...int) int {
+	m := values[0]
+	for _, v := range values[1:] {
+		if v < m {
+			m = v
+		}
+	}
+	return m
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// Container names follow the rules for a path component of a Docker image reference
+var nameRegex = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*$`)
+
+// Versions are used as Docker image tags
+var versionRegex = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// Remotes are a registry host with optional port and namespace (e.g. registry.example.org:5000/lab), or a
+// Docker Hub namespace (e.g. janeliascicomp)
+var remoteRegex = regexp.MustCompile(`^(?:[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?(?:\.[a-zA-Z0-9](?:[a-zA-Z0-9-]*[a-zA-Z0-9])?)*(?::[0-9]+)?/)?[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+
+// ValidateName checks that the given container name can be used as a Docker image name
+func ValidateName(name string) error {
+	if !nameRegex.MatchString(name) {
+		return fmt.Errorf("%s should only contain lowercase letters, numbers, dashes, dots and underscores, "+
+			"and start and end with a letter or number", strconv.Quote(name))
+	}
+	return nil
+}
+
+// ValidateVersion checks that the given container version can be used as a Docker image tag
+func ValidateVersion(version string) error {
+	if !versionRegex.MatchString(version) {
+		return fmt.Errorf("%s should only contain letters, numbers, dashes, dots and underscores, "+
+			"and not start with a dot or dash", strconv.Quote(version))
+	}
+	return nil
+}
+
+// ValidateRemote checks that the given remote is a registry and namespace which images can be pushed to
+func ValidateRemote(remote string) error {
+	if !remoteRegex.MatchString(remote) {
+		return fmt.Errorf("%s should be a namespace (e.g. janeliascicomp) or a registry followed by a namespace "+
+			"(e.g. registry.example.org/janeliascicomp)", strconv.Quote(remote))
+	}
+	return nil
+}
+
+// Platforms are an OS and architecture, with an optional variant, e.g. linux/arm64 or linux/arm/v7
+var platformRegex = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`)
+
+// ValidatePlatform checks that the given platform can be built for, e.g. linux/arm64
+func ValidatePlatform(platform string) error {
+	if !platformRegex.MatchString(platform) {
+		return fmt.Errorf("%s should be an OS and architecture, with an optional variant, e.g. linux/arm64 or "+
+			"linux/arm/v7", strconv.Quote(platform))
+	}
+	return nil
+}
+
+// ValidateImageRef checks that the given image reference can be pulled or pushed, e.g. registry.example.org/lab/myapp:tag
+func ValidateImageRef(ref string) error {
+	if _, err := reference.ParseNormalizedNamed(ref); err != nil {
+		return fmt.Errorf("%s is not a valid image reference: %s", strconv.Quote(ref), err)
+	}
+	return nil
+}
+
+// configLocation is where a value is stored in the project configuration: either a settable value, or a key in a map
+type configLocation struct {
+	value reflect.Value
+	m     reflect.Value
+	key   reflect.Value
+	typ   reflect.Type
+}
+
+// Finds where the value at the given dotted path is stored. If create is true, missing maps along the path are
+// created so that the value can be set.
+func findConfigLocation(c *MaruConfig, path string, create bool) (*configLocation, error) {
+
+	keys := strings.Split(path, ".")
+	v := reflect.ValueOf(c).Elem()
+
+	for i, key := range keys {
+		last := i == len(keys)-1
+		current := strings.Join(keys[:i+1], ".")
+
+		if v.Kind() == reflect.Struct {
+			if field, ok := ConfigFields(v.Type())[key]; ok {
+				v = v.FieldByIndex(field.Index)
+				if last {
+					return &configLocation{value: v, typ: v.Type()}, nil
+				}
+				if v.Kind() == reflect.Ptr {
+					v = derefConfigValue(v, create)
+				}
+				continue
+			}
+			if inlineMapType(v.Type()) == nil {
+				message := "unknown key " + current
+				if suggestion := closestKey(key, ConfigFields(v.Type())); suggestion != "" {
+					message += fmt.Sprintf(" (did you mean %s?)", joinPath(strings.Join(keys[:i], "."), suggestion))
+				}
+				return nil, fmt.Errorf("%s", message)
+			}
+			v = inlineMapValue(v)
+		}
+
+		if v.Kind() != reflect.Map {
+			return nil, fmt.Errorf("%s has no key %s", strings.Join(keys[:i], "."), key)
+		}
+		if v.IsNil() && create {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		if last {
+			return &configLocation{m: v, key: reflect.ValueOf(key), typ: v.Type().Elem()}, nil
+		}
+		if elemType := v.Type().Elem(); elemType.Kind() == reflect.Ptr && elemType.Elem().Kind() == reflect.Struct {
+			// Sections in a map, such as profiles, are stored as pointers, so that their fields can be set
+			elem := reflect.Zero(elemType)
+			if !v.IsNil() && v.MapIndex(reflect.ValueOf(key)).IsValid() {
+				elem = v.MapIndex(reflect.ValueOf(key))
+			}
+			if elem.IsNil() && create {
+				elem = reflect.New(elemType.Elem())
+				v.SetMapIndex(reflect.ValueOf(key), elem)
+			}
+			v = derefConfigValue(elem, false)
+			continue
+		}
+		if v.Type().Elem().Kind() != reflect.Map {
+			return nil, fmt.Errorf("%s has no key %s", current, keys[i+1])
+		}
+
+		// Maps are references, so nested maps can be modified without being settable. A missing map is
+		// represented by a nil map, so that the rest of the path is still checked.
+		elem := reflect.Zero(v.Type().Elem())
+		if !v.IsNil() && v.MapIndex(reflect.ValueOf(key)).IsValid() {
+			elem = v.MapIndex(reflect.ValueOf(key))
+		}
+		if elem.IsNil() && create {
+			elem = reflect.MakeMap(v.Type().Elem())
+			v.SetMapIndex(reflect.ValueOf(key), elem)
+		}
+		v = elem
+	}
+
+	return nil, fmt.Errorf("unknown key %s", path)
+}
+
+// Returns the section which the pointer refers to. A missing section is created if create is true, or else
+// represented by an empty section which isn't stored, so that the rest of the path is still checked.
+func derefConfigValue(v reflect.Value, create bool) reflect.Value {
+	if v.IsNil() {
+		if !create || !v.CanSet() {
+			return reflect.New(v.Type().Elem()).Elem()
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+	}
+	return v.Elem()
+}
+
+// GetConfigValue returns the value at the given dotted path in the project configuration, e.g.
+// template_args.python_conda.python_version, and false if the path doesn't exist or has no value. Empty lists and
+// sections have no value, since they aren't written to the maru.yaml.
+func GetConfigValue(c *MaruConfig, path string) (reflect.Value, bool) {
+	location, err := findConfigLocation(c, path, false)
+	if err != nil {
+		return reflect.Value{}, false
+	}
+	v := location.value
+	if location.m.IsValid() {
+		if location.m.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = location.m.MapIndex(location.key)
+		if !v.IsValid() {
+			return v, false
+		}
+	}
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice:
+		return v, v.Len() > 0
+	case reflect.Ptr, reflect.Struct:
+		return v, !v.IsZero()
+	}
+	return v, true
+}
+
+// CheckConfigKey returns an error if the given dotted path is not a valid setting in the project configuration
+func CheckConfigKey(path string) error {
+	_, err := findConfigLocation(&MaruConfig{}, path, false)
+	return err
+}
+
+// IsConfigList returns true if the setting at the given dotted path is a list, e.g. remotes
+func IsConfigList(path string) bool {
+	location, err := findConfigLocation(&MaruConfig{}, path, false)
+	return err == nil && location.typ.Kind() == reflect.Slice
+}
+
+// SetConfigValue sets the value at the given dotted path in the project configuration, converting the given
+// strings to the type of the setting. Lists take any number of values, while other settings take exactly one.
+func SetConfigValue(c *MaruConfig, path string, values []string) error {
+
+	location, err := findConfigLocation(c, path, true)
+	if err != nil {
+		return err
+	}
+
+	var v reflect.Value
+	switch location.typ.Kind() {
+	case reflect.String:
+		if len(values) != 1 {
+			return fmt.Errorf("it takes a single value")
+		}
+		v = reflect.ValueOf(values[0]).Convert(location.typ)
+	case reflect.Bool:
+		if len(values) != 1 {
+			return fmt.Errorf("it takes a single value")
+		}
+		b, err := strconv.ParseBool(values[0])
+		if err != nil {
+			return fmt.Errorf("it must be true or false")
+		}
+		v = reflect.ValueOf(b)
+	case reflect.Slice:
+		if location.typ.Elem().Kind() != reflect.String {
+			return fmt.Errorf("it can't be set from the command line")
+		}
+		v = reflect.MakeSlice(location.typ, 0, len(values))
+		for _, value := range values {
+			v = reflect.Append(v, reflect.ValueOf(value).Convert(location.typ.Elem()))
+		}
+	default:
+		return fmt.Errorf("it is a section, set one of its keys instead (e.g. %s.<key>)", path)
+	}
+
+	location.set(v)
+	return nil
+}
+
+// UnsetConfigValue removes the value at the given dotted path from the project configuration. Keys in a map are
+// deleted, while any other setting is reset to its empty value.
+func UnsetConfigValue(c *MaruConfig, path string) error {
+	location, err := findConfigLocation(c, path, false)
+	if err != nil {
+		return err
+	}
+	location.set(reflect.Value{})
+	return nil
+}
+
+// Sets the value, or resets it to its empty value (or deletes it from its map) if v is the zero Value
+func (l *configLocation) set(v reflect.Value) {
+	if l.m.IsValid() {
+		if l.m.IsNil() {
+			return
+		}
+		l.m.SetMapIndex(l.key, v)
+		return
+	}
+	if !v.IsValid() {
+		v = reflect.Zero(l.typ)
+	}
+	l.value.Set(v)
+}
+
+// ConfigKeys returns the dotted paths of all the settings in the project configuration. Maps are listed with a
+// trailing dot, since their keys are chosen by the user.
+func ConfigKeys() []string {
+	var keys []string
+	var walk func(t reflect.Type, path string)
+	walk = func(t reflect.Type, path string) {
+		fields := ConfigFields(t)
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			field := fields[name]
+			switch field.Type.Kind() {
+			case reflect.Struct:
+				walk(field.Type, joinPath(path, name))
+			case reflect.Ptr:
+				walk(field.Type.Elem(), joinPath(path, name))
+			case reflect.Map:
+				keys = append(keys, joinPath(path, name)+".")
+			default:
+				keys = append(keys, joinPath(path, name))
+			}
+		}
+	}
+	walk(reflect.TypeOf(MaruConfig{}), "")
+	return keys
+}
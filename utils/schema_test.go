@@ -0,0 +1,332 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestCheckKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want []string
+	}{
+		{
+			name: "valid",
+			yaml: "name: myapp\nversion: 1.0.0\nremotes:\n- janeliascicomp\nbuild_args:\n  GIT_TAG: main\n" +
+				"template_args:\n  flavor: python_conda\n  python_conda:\n    python_version: \"3.8\"\n",
+		},
+		{
+			name: "unknown key with a suggestion",
+			yaml: "name: myapp\nremote:\n- janeliascicomp\n",
+			want: []string{"maru.yaml:2:1: Unknown key remote (did you mean remotes?)"},
+		},
+		{
+			name: "unknown nested key",
+			yaml: "name: myapp\ntemplate_args:\n  build:\n    repo_url: https://github.com/example/repo.git\n    comand: make\n",
+			want: []string{"maru.yaml:5:5: Unknown key template_args.build.comand (did you mean template_args.build.command?)"},
+		},
+		{
+			name: "keys of custom flavors",
+			yaml: "template_args:\n  flavor: napari_plugin\n  napari_plugin:\n    plugin_name: hello\n",
+		},
+		{
+			name: "wrong types",
+			yaml: "name: [myapp]\nremotes: janeliascicomp\ncache:\n  export: maybe\n",
+			want: []string{
+				"maru.yaml:1:7: name must be a string",
+				"maru.yaml:2:10: remotes must be a list",
+				"maru.yaml:4:11: cache.export must be true or false",
+			},
+		},
+		{
+			name: "wrong type of a list item",
+			yaml: "platforms:\n- linux/amd64\n- {os: linux}\n",
+			want: []string{"maru.yaml:3:3: platforms[1] must be a string"},
+		},
+		{
+			name: "unknown key in a profile",
+			yaml: "profiles:\n  dev:\n    git_tag: main\n    remote: [lab-dev]\n",
+			want: []string{"maru.yaml:4:5: Unknown key profiles.dev.remote (did you mean profiles.dev.remotes?)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := ParseConfigDocument([]byte(tt.yaml))
+			if err != nil {
+				t.Fatalf("ParseConfigDocument() error = %v", err)
+			}
+			var got []string
+			for _, e := range doc.CheckKeys() {
+				got = append(got, e.Error())
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("CheckKeys() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewConfigError(t *testing.T) {
+	doc, err := ParseConfigDocument([]byte("name: myapp\nremotes:\n- janeliascicomp\n- bad remote\n" +
+		"build_args:\n  GIT_TAG: main\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "name", want: "maru.yaml:1:1: problem"},
+		{path: "remotes.1", want: "maru.yaml:4:3: problem"},
+		{path: "build_args.GIT_TAG", want: "maru.yaml:6:3: problem"},
+		// Missing keys are reported at the closest enclosing key
+		{path: "build_args.MISSING", want: "maru.yaml:5:1: problem"},
+		{path: "version", want: "maru.yaml: problem"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := doc.NewConfigError(tt.path, "problem").Error(); got != tt.want {
+				t.Errorf("NewConfigError() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "myapp"},
+		{name: "my-app_2.0"},
+		{name: "my__app"},
+		{name: "MyApp", wantErr: true},
+		{name: "-myapp", wantErr: true},
+		{name: "myapp.", wantErr: true},
+		{name: "my app", wantErr: true},
+		{name: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateName(tt.name); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		wantErr bool
+	}{
+		{version: "1.0.0"},
+		{version: "1.0.0-rc.1"},
+		{version: "20201104-1356"},
+		{version: "latest"},
+		{version: "_build"},
+		{version: ".1", wantErr: true},
+		{version: "-rc", wantErr: true},
+		{version: "1.0.0+build", wantErr: true},
+		{version: strings.Repeat("1", 129), wantErr: true},
+		{version: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			if err := ValidateVersion(tt.version); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateRemote(t *testing.T) {
+	tests := []struct {
+		remote  string
+		wantErr bool
+	}{
+		{remote: "janeliascicomp"},
+		{remote: "registry.example.org/lab"},
+		{remote: "registry.example.org:5000/lab/team"},
+		{remote: "localhost:5000/lab"},
+		{remote: "Lab", wantErr: true},
+		{remote: "registry.example.org/", wantErr: true},
+		{remote: "https://registry.example.org/lab", wantErr: true},
+		{remote: "lab/myapp:1.0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.remote, func(t *testing.T) {
+			if err := ValidateRemote(tt.remote); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRemote() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// Returns the value at the path as it's printed by maru get, or "<unset>" if it has no value
+func formatConfigValue(c *MaruConfig, path string) string {
+	v, ok := GetConfigValue(c, path)
+	if !ok {
+		return "<unset>"
+	}
+	switch v.Kind() {
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(items, ",")
+	case reflect.Map, reflect.Struct, reflect.Ptr:
+		raw, _ := yaml.Marshal(v.Interface())
+		return strings.TrimSpace(string(raw))
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func TestConfigValueRoundTrip(t *testing.T) {
+	tests := []struct {
+		path   string
+		values []string
+		want   string
+	}{
+		{path: "name", values: []string{"myapp"}, want: "myapp"},
+		{path: "template_args.build.repo_url", values: []string{"https://github.com/example/repo.git"},
+			want: "https://github.com/example/repo.git"},
+		{path: "remotes", values: []string{"janeliascicomp", "registry.example.org/lab"},
+			want: "janeliascicomp,registry.example.org/lab"},
+		{path: "cache.export", values: []string{"true"}, want: "true"},
+		{path: "cache.export", values: []string{"false"}, want: "false"},
+		{path: "build_args.GIT_TAG", values: []string{"main"}, want: "main"},
+		{path: "labels.team", values: []string{"imaging"}, want: "imaging"},
+		{path: "profiles.dev.git_tag", values: []string{"main"}, want: "main"},
+		{path: "profiles.dev.remotes", values: []string{"lab-dev"}, want: "lab-dev"},
+		{path: "profiles.dev.cache.export", values: []string{"true"}, want: "true"},
+		{path: "template_args.napari_plugin.plugin_name", values: []string{"hello"}, want: "hello"},
+		{path: "template_args.python_conda.python_version", values: []string{"3.8"}, want: "3.8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			c := NewMaruConfig("myapp", "1.0.0")
+			if err := SetConfigValue(c, tt.path, tt.values); err != nil {
+				t.Fatalf("SetConfigValue() error = %v", err)
+			}
+			if got := formatConfigValue(c, tt.path); got != tt.want {
+				t.Errorf("GetConfigValue() = %q, want %q", got, tt.want)
+			}
+
+			// The value is written to the maru.yaml, and read back
+			raw, err := yaml.Marshal(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			read := &MaruConfig{}
+			if err = yaml.Unmarshal(raw, read); err != nil {
+				t.Fatal(err)
+			}
+			if got := formatConfigValue(read, tt.path); got != tt.want {
+				t.Errorf("GetConfigValue() after reading = %q, want %q", got, tt.want)
+			}
+
+			if err = UnsetConfigValue(read, tt.path); err != nil {
+				t.Fatalf("UnsetConfigValue() error = %v", err)
+			}
+			// Settings which aren't in a map are reset to their empty value
+			if got := formatConfigValue(read, tt.path); got != "<unset>" && got != "" && got != "false" {
+				t.Errorf("GetConfigValue() after unset = %q, want no value", got)
+			}
+		})
+	}
+}
+
+func TestConfigSectionsAreUnsetWhenEmpty(t *testing.T) {
+	c := NewMaruConfig("myapp", "1.0.0")
+	for _, path := range []string{"build_args", "profiles", "profiles.dev", "remotes", "cache", "labels"} {
+		if got := formatConfigValue(c, path); got != "<unset>" {
+			t.Errorf("GetConfigValue(%s) = %q before it's set, want no value", path, got)
+		}
+	}
+
+	SetConfigValue(c, "build_args.GIT_TAG", []string{"main"})
+	SetConfigValue(c, "profiles.dev.git_tag", []string{"main"})
+	if got := formatConfigValue(c, "build_args"); got != "GIT_TAG: main" {
+		t.Errorf("GetConfigValue(build_args) = %q", got)
+	}
+	if got := formatConfigValue(c, "profiles"); got != "dev:\n  git_tag: main" {
+		t.Errorf("GetConfigValue(profiles) = %q", got)
+	}
+
+	// Removing the last key leaves an empty map, which isn't set either
+	UnsetConfigValue(c, "build_args.GIT_TAG")
+	UnsetConfigValue(c, "profiles.dev")
+	for _, path := range []string{"build_args", "profiles", "profiles.dev"} {
+		if got := formatConfigValue(c, path); got != "<unset>" {
+			t.Errorf("GetConfigValue(%s) = %q after unset, want no value", path, got)
+		}
+	}
+	if err := UnsetConfigValue(c, "profiles"); err != nil || formatConfigValue(c, "profiles") != "<unset>" {
+		t.Errorf("UnsetConfigValue(profiles) error = %v, want no value", err)
+	}
+}
+
+func TestSetConfigValueRejected(t *testing.T) {
+	tests := []struct {
+		path    string
+		values  []string
+		wantErr string
+		// Whether the path itself is invalid, rather than the values
+		badPath bool
+	}{
+		{path: "nmae", values: []string{"myapp"}, wantErr: "unknown key nmae (did you mean name?)", badPath: true},
+		{path: "template_args.build.comand", values: []string{"make"},
+			wantErr: "did you mean template_args.build.command?", badPath: true},
+		{path: "name.first", values: []string{"myapp"}, wantErr: "name has no key first", badPath: true},
+		{path: "profiles.dev.gittag", values: []string{"main"}, wantErr: "did you mean profiles.dev.git_tag?",
+			badPath: true},
+		{path: "build_args.GIT_TAG.x", values: []string{"main"}, wantErr: "build_args.GIT_TAG has no key x",
+			badPath: true},
+		// Dots in map keys can't be told apart from the path
+		{path: "labels.org.example.team", values: []string{"imaging"}, wantErr: "labels.org has no key example",
+			badPath: true},
+		{path: "name", values: []string{"a", "b"}, wantErr: "it takes a single value"},
+		{path: "cache.export", values: []string{"maybe"}, wantErr: "it must be true or false"},
+		{path: "build_args", values: []string{"GIT_TAG=main"}, wantErr: "it is a section"},
+		{path: "cache", values: []string{"true"}, wantErr: "it is a section"},
+		{path: "profiles.dev", values: []string{"main"}, wantErr: "it is a section"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			c := NewMaruConfig("myapp", "1.0.0")
+			err := SetConfigValue(c, tt.path, tt.values)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("SetConfigValue() error = %v, want %q", err, tt.wantErr)
+			}
+			if err := CheckConfigKey(tt.path); (err != nil) != tt.badPath {
+				t.Errorf("CheckConfigKey() error = %v, want an error: %v", err, tt.badPath)
+			}
+		})
+	}
+}
+
+func TestConfigKeys(t *testing.T) {
+	keys := ConfigKeys()
+	for _, want := range []string{"name", "remotes", "build_args.", "cache.export", "profiles.",
+		"template_args.build.command", "template_args.python_conda.python_version"} {
+		found := false
+		for _, key := range keys {
+			found = found || key == want
+		}
+		if !found {
+			t.Errorf("ConfigKeys() doesn't contain %s", want)
+		}
+	}
+	for _, key := range keys {
+		if err := CheckConfigKey(strings.TrimSuffix(key, ".")); err != nil {
+			t.Errorf("ConfigKeys() contains %s, which is rejected: %s", key, err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// StateFile records how the Dockerfile was last generated, so that later changes can be detected
+var StateFile = filepath.Join(".maru", "state.yaml")
+
+// GeneratedState describes the inputs and output of the last Dockerfile generation
+type GeneratedState struct {
+	Template       string `yaml:"template"`
+	TemplateSource string `yaml:"template_source"`
+	TemplateHash   string `yaml:"template_hash"`
+	MaruVersion    string `yaml:"maru_version"`
+	InputChecksum  string `yaml:"input_checksum"`
+	OutputHash     string `yaml:"output_hash"`
+}
+
+// HashString returns the hex encoded SHA-256 hash of the given string
+func HashString(s string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+}
+
+// ReadGeneratedState reads the state of the last Dockerfile generation. Returns nil if no state was recorded.
+func ReadGeneratedState() *GeneratedState {
+
+	if !FileExists(StateFile) {
+		return nil
+	}
+
+	raw, err := ioutil.ReadFile(StateFile)
+	if err != nil {
+		PrintFatal("Error reading state file: %s", err)
+	}
+
+	var s = &GeneratedState{}
+	err = yaml.Unmarshal(raw, s)
+	if err != nil {
+		PrintFatal("Error reading state file: %s", err)
+	}
+
+	return s
+}
+
+// WriteGeneratedState records the state of the Dockerfile generation which just took place
+func WriteGeneratedState(s *GeneratedState) {
+
+	raw, err := yaml.Marshal(s)
+	if err != nil {
+		PrintFatal("Error creating state file: %s", err)
+	}
+
+	PrintDebug("Writing to %s...", StateFile)
+	if err = os.MkdirAll(filepath.Dir(StateFile), 0755); err != nil {
+		PrintFatal("Error creating state directory: %s", err)
+	}
+	err = ioutil.WriteFile(StateFile, raw, 0644)
+	if err != nil {
+		PrintFatal("Error writing state file: %s", err)
+	}
+}
+
+// BuildStateFile records the last build of the project
+var BuildStateFile = filepath.Join(".maru", "build.yaml")
+
+// BuildState describes the last build, so that later commands resolve the version in the same way
+type BuildState struct {
+	// Time of the build, which is used by ${date}
+	Time time.Time `yaml:"time"`
+}
+
+// ReadBuildState reads the state of the last build. Returns nil if no build was recorded.
+func ReadBuildState() *BuildState {
+
+	if !FileExists(BuildStateFile) {
+		return nil
+	}
+
+	raw, err := ioutil.ReadFile(BuildStateFile)
+	if err != nil {
+		PrintFatal("Error reading build state: %s", err)
+	}
+
+	var s = &BuildState{}
+	err = yaml.Unmarshal(raw, s)
+	if err != nil {
+		PrintFatal("Error reading build state: %s", err)
+	}
+
+	return s
+}
+
+// WriteBuildState records the state of the build which just took place
+func WriteBuildState(s *BuildState) {
+
+	raw, err := yaml.Marshal(s)
+	if err != nil {
+		PrintFatal("Error creating build state: %s", err)
+	}
+
+	PrintDebug("Writing to %s...", BuildStateFile)
+	if err = os.MkdirAll(filepath.Dir(BuildStateFile), 0755); err != nil {
+		PrintFatal("Error creating state directory: %s", err)
+	}
+	err = ioutil.WriteFile(BuildStateFile, raw, 0644)
+	if err != nil {
+		PrintFatal("Error writing build state: %s", err)
+	}
+}
+
+// MergeBaseFile contains the Dockerfile exactly as it was last generated, which is the base for merging hand edits
+var MergeBaseFile = filepath.Join(".maru", "Dockerfile.base")
+
+// ReadMergeBase returns the Dockerfile as it was last generated, and false if it was not recorded
+func ReadMergeBase() (string, bool) {
+
+	if !FileExists(MergeBaseFile) {
+		return "", false
+	}
+
+	raw, err := ioutil.ReadFile(MergeBaseFile)
+	if err != nil {
+		PrintFatal("Error reading merge base: %s", err)
+	}
+
+	return string(raw), true
+}
+
+// WriteMergeBase records the Dockerfile which was just generated, before any hand edits
+func WriteMergeBase(dockerfile string) {
+
+	PrintDebug("Writing to %s...", MergeBaseFile)
+	if err := os.MkdirAll(filepath.Dir(MergeBaseFile), 0755); err != nil {
+		PrintFatal("Error creating state directory: %s", err)
+	}
+	if err := ioutil.WriteFile(MergeBaseFile, []byte(dockerfile), 0644); err != nil {
+		PrintFatal("Error writing merge base: %s", err)
+	}
+}
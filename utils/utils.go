@@ -9,15 +9,23 @@ import (
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/AlecAivazis/survey/v2/terminal"
+	xterminal "golang.org/x/crypto/ssh/terminal"
 
 	Aurora "github.com/logrusorgru/aurora"
 )
 
-const MaruVersion = "0.3.0"
+const MaruVersion = "0.4.0"
+
+// SchemaVersion is the last version of Maru which changed the project configuration or the templates in a way that
+// requires existing projects to run `maru upgrade`. It must match the last migration registered in cmd/upgrade.go.
+const SchemaVersion = "0.4.0"
 const DockerFilePath = "Dockerfile"
 
 var Debug = false
 
+// AssumeYes causes every prompt to take its default answer without asking, set by the --yes flag.
+var AssumeYes = false
+
 type ColorFunc func(arg interface{}) Aurora.Value
 
 // PrintDebug - prints an debug message if debug is turned on
@@ -50,12 +58,57 @@ func PrintError(format string, a ...interface{}) {
 	print(Aurora.BrightRed, "\u2718 "+format, a...)
 }
 
-// PrintFatal - prints an error message and exits with code 2
+// PrintFatal - prints an error message and exits with code 2, or returns to CatchFatal if it's running
 func PrintFatal(format string, a ...interface{}) {
 	print(Aurora.BrightRed, "\u2718 "+format, a...)
+	if catchingFatal {
+		panic(fatalError{})
+	}
 	os.Exit(2)
 }
 
+// Set while CatchFatal is running
+var catchingFatal = false
+
+// Raised by PrintFatal while CatchFatal is running, after the error was printed
+type fatalError struct{}
+
+// CatchFatal runs fn and returns its result, or false if it failed with PrintFatal instead of exiting. This lets
+// commands continue with other work after a failure, e.g. to report which projects of a workspace were skipped.
+func CatchFatal(fn func() bool) (ok bool) {
+	previous := catchingFatal
+	catchingFatal = true
+	defer func() {
+		catchingFatal = previous
+		if r := recover(); r != nil {
+			if _, fatal := r.(fatalError); !fatal {
+				panic(r)
+			}
+			ok = false
+		}
+	}()
+	return fn()
+}
+
+// PrintDiff - prints a unified diff, coloring the added and removed lines. No code highlighting is applied,
+// since the diffed files may contain carets and backticks.
+func PrintDiff(diff string) {
+	for _, line := range SplitLines(diff) {
+		switch {
+		case strings.HasPrefix(line, "+++") || strings.HasPrefix(line, "---"):
+			fmt.Println(Aurora.Bold(line))
+		case strings.HasPrefix(line, "@@"):
+			fmt.Println(Aurora.Cyan(line))
+		case strings.HasPrefix(line, "+"):
+			fmt.Println(Aurora.Green(line))
+		case strings.HasPrefix(line, "-"):
+			fmt.Println(Aurora.Red(line))
+		default:
+			fmt.Println(line)
+		}
+	}
+}
+
 // Print a message with a default color, and optional code highlighting.
 // Highlighting is applied to any string between carots ^like this^.
 func print(colorFunc ColorFunc, format string, a ...interface{}) {
@@ -92,6 +145,15 @@ func FileExists(filename string) bool {
 	return !info.IsDir()
 }
 
+// DirExists - returns true if the given directory exists
+func DirExists(dirname string) bool {
+	info, err := os.Stat(dirname)
+	if os.IsNotExist(err) {
+		return false
+	}
+	return info.IsDir()
+}
+
 // RunCommand - runs the given command synchronously and prints any output to STDOUT/STDERR
 func RunCommand(name string, arg ...string) error {
 	cmd := exec.Command(name, arg...)
@@ -103,8 +165,18 @@ func RunCommand(name string, arg ...string) error {
 	return cmd.Run()
 }
 
+// IsInteractive returns true if STDIN is a terminal which can be used to prompt the user.
+func IsInteractive() bool {
+	return xterminal.IsTerminal(int(os.Stdin.Fd()))
+}
+
 // Ask the user one question and get input. Deals with Ctrl-C interruptions and other errors.
+// Fails immediately instead of hanging if STDIN is not a terminal.
 func Ask(prompt survey.Prompt, response interface{}, opts ...survey.AskOpt) {
+	if !IsInteractive() {
+		PrintFatal("Cannot ask \"%s\" because STDIN is not a terminal. Use --yes to accept the default answers.",
+			getPromptMessage(prompt))
+	}
 	err := survey.AskOne(prompt, response)
 	if err == terminal.InterruptErr {
 		fmt.Println("interrupted")
@@ -117,6 +189,9 @@ func Ask(prompt survey.Prompt, response interface{}, opts ...survey.AskOpt) {
 // Ask the user one question requiring a string input.
 func AskForString(message string, defaultValue string) string {
 	value := defaultValue
+	if AssumeYes {
+		return value
+	}
 	prompt := &survey.Input{
 		Message: message,
 		Default: value,
@@ -128,6 +203,9 @@ func AskForString(message string, defaultValue string) string {
 // Ask the user one question requiring a yes/no input.
 func AskForBool(msg string, defaultValue bool) bool {
 	value := defaultValue
+	if AssumeYes {
+		return value
+	}
 	prompt := &survey.Confirm{
 		Message: msg,
 		Default: value,
@@ -136,12 +214,59 @@ func AskForBool(msg string, defaultValue bool) bool {
 	return value
 }
 
-// Read the checksum encoded in the Dockerfile
-// Assumes that the first line of the Dockerfile contains a comment with the checksum
+// Ask the user to choose one of the given options.
+func AskForSelect(message string, options []string, defaultValue string) string {
+	value := defaultValue
+	if AssumeYes {
+		return value
+	}
+	prompt := &survey.Select{
+		Message: message,
+		Options: options,
+		Default: value,
+	}
+	Ask(prompt, &value)
+	return value
+}
+
+// Ask the user one question requiring multiple lines of input.
+func AskForMultiline(message string, defaultValue string) string {
+	value := defaultValue
+	if AssumeYes {
+		return value
+	}
+	prompt := &survey.Multiline{
+		Message: message,
+		Default: value,
+	}
+	Ask(prompt, &value)
+	return value
+}
+
+// Returns the message of the given prompt, for use in error messages
+func getPromptMessage(prompt survey.Prompt) string {
+	switch p := prompt.(type) {
+	case *survey.Input:
+		return p.Message
+	case *survey.Confirm:
+		return p.Message
+	case *survey.Select:
+		return p.Message
+	case *survey.Multiline:
+		return p.Message
+	}
+	return "question"
+}
+
+// Read the checksum encoded in the Dockerfile by older versions of Maru, which don't keep a state file.
+// Assumes that the first line of the Dockerfile contains a comment with the checksum. Returns an empty string if
+// there is no Dockerfile.
 func GetChecksumFromDockerfile() string {
 
 	f, err := os.Open(DockerFilePath)
-	if err != nil {
+	if os.IsNotExist(err) {
+		return ""
+	} else if err != nil {
 		PrintFatal("%s", err)
 	}
 	defer f.Close()
@@ -155,9 +280,3 @@ func GetChecksumFromDockerfile() string {
 	}
 	return strings.TrimSpace(strings.Replace(first, "# ", "", 1))
 }
-
-// Tests the given checksum against the current checksum saved in the Dockerfile (if any)
-func TestChecksum(newChecksum string) bool {
-	existingChecksum := GetChecksumFromDockerfile()
-	return newChecksum == existingChecksum
-}
@@ -0,0 +1,207 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// CompareVersions compares two dotted version numbers such as 0.3.0, and returns -1, 0 or 1 if a is older than,
+// the same as, or newer than b. Missing components count as zero, so an empty version is older than any other.
+// Returns an error if either version isn't numeric.
+func CompareVersions(a, b string) (int, error) {
+	pa, err := versionParts(a)
+	if err != nil {
+		return 0, err
+	}
+	pb, err := versionParts(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		va, vb := 0, 0
+		if i < len(pa) {
+			va = pa[i]
+		}
+		if i < len(pb) {
+			vb = pb[i]
+		}
+		if va < vb {
+			return -1, nil
+		}
+		if va > vb {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// Splits a version into its numeric components, ignoring any pre-release or build suffix
+func versionParts(version string) ([]int, error) {
+	number := strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(number, "-+"); i >= 0 {
+		number = number[:i]
+	}
+	if number == "" {
+		return nil, nil
+	}
+	var parts []int
+	for _, s := range strings.Split(number, ".") {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("%s is not a version number (e.g. 0.4.0)", version)
+		}
+		parts = append(parts, n)
+	}
+	return parts, nil
+}
+
+// Matches a semantic version, with an optional v prefix, e.g. v1.2.3-rc.1+build.5
+var semverRegex = regexp.MustCompile(`^(v?)(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)\.(0|[1-9][0-9]*)` +
+	`(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?$`)
+
+// Semver is a parsed semantic version (see https://semver.org)
+type Semver struct {
+	Prefix     string
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+	Build      string
+}
+
+// ParseSemver parses a semantic version such as 1.2.3 or v1.2.3-rc.1
+func ParseSemver(version string) (*Semver, error) {
+	m := semverRegex.FindStringSubmatch(version)
+	if m == nil {
+		return nil, fmt.Errorf("%s is not a semantic version (e.g. 1.2.3 or 1.2.3-rc.1)", version)
+	}
+	v := &Semver{Prefix: m[1], Prerelease: m[5], Build: m[6]}
+	v.Major, _ = strconv.Atoi(m[2])
+	v.Minor, _ = strconv.Atoi(m[3])
+	v.Patch, _ = strconv.Atoi(m[4])
+	return v, nil
+}
+
+func (v *Semver) String() string {
+	s := fmt.Sprintf("%s%d.%d.%d", v.Prefix, v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Bump returns the next version after incrementing the given part: major, minor, patch or prerelease. A pre-release
+// of the version being bumped to is released first, e.g. bumping the minor version of 1.3.0-rc.2 gives 1.3.0.
+// If pre is not empty, the result is the first pre-release with that identifier, e.g. 1.3.0-rc.1. Bumping the
+// prerelease increments its number, e.g. 1.3.0-rc.1 gives 1.3.0-rc.2, or starts a pre-release of the next patch.
+// Returns an error if the result wouldn't be newer, e.g. for a patch --pre rc of 1.0.1-rc.1, or a beta of 1.3.0-rc.1.
+func (v *Semver) Bump(part, pre string) (*Semver, error) {
+
+	next := &Semver{Prefix: v.Prefix, Major: v.Major, Minor: v.Minor, Patch: v.Patch}
+	isPrerelease := v.Prerelease != ""
+
+	switch part {
+	case "major":
+		if !isPrerelease || v.Minor != 0 || v.Patch != 0 {
+			next.Major, next.Minor, next.Patch = v.Major+1, 0, 0
+		}
+	case "minor":
+		if !isPrerelease || v.Patch != 0 {
+			next.Minor, next.Patch = v.Minor+1, 0
+		}
+	case "patch":
+		if !isPrerelease {
+			next.Patch = v.Patch + 1
+		}
+	case "prerelease":
+		if !isPrerelease {
+			next.Patch = v.Patch + 1
+			break
+		}
+		identifier := strings.SplitN(v.Prerelease, ".", 2)[0]
+		if pre != "" && pre != identifier {
+			break
+		}
+		next.Prerelease = incrementPrerelease(v.Prerelease)
+	default:
+		return nil, fmt.Errorf("unknown version part %s, expected major, minor, patch or prerelease", part)
+	}
+
+	if next.Prerelease == "" {
+		if pre != "" {
+			next.Prerelease = pre + ".1"
+		} else if part == "prerelease" {
+			next.Prerelease = "rc.1"
+		}
+	}
+	if next.Compare(v) <= 0 {
+		return nil, fmt.Errorf("bumping the %s of %s would give %s, which isn't newer. Use `maru bump prerelease` to "+
+			"increment the pre-release, or bump a higher part of the version.", part, v, next)
+	}
+	return next, nil
+}
+
+// Compare returns -1, 0 or 1 if v precedes, has the same precedence as, or follows o. Pre-releases precede the
+// release, and their identifiers are compared one by one, numerically if they are numbers. Build metadata and the
+// prefix are ignored.
+func (v *Semver) Compare(o *Semver) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	switch {
+	case v.Prerelease == o.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case o.Prerelease == "":
+		return -1
+	}
+	a, b := strings.Split(v.Prerelease, "."), strings.Split(o.Prerelease, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		na, errA := strconv.Atoi(a[i])
+		nb, errB := strconv.Atoi(b[i])
+		switch {
+		case errA == nil && errB == nil:
+			if na != nb {
+				return sign(na - nb)
+			}
+		case errA == nil:
+			return -1
+		case errB == nil:
+			return 1
+		case a[i] != b[i]:
+			return sign(strings.Compare(a[i], b[i]))
+		}
+	}
+	return sign(len(a) - len(b))
+}
+
+// Returns -1, 0 or 1 for a negative, zero or positive number
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// Increments the last numeric identifier of the pre-release, or appends one, e.g. rc.1 becomes rc.2 and beta
+// becomes beta.1
+func incrementPrerelease(prerelease string) string {
+	identifiers := strings.Split(prerelease, ".")
+	last := len(identifiers) - 1
+	if n, err := strconv.Atoi(identifiers[last]); err == nil {
+		identifiers[last] = strconv.Itoa(n + 1)
+		return strings.Join(identifiers, ".")
+	}
+	return prerelease + ".1"
+}
@@ -0,0 +1,147 @@
+package utils
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b    string
+		want    int
+		wantErr bool
+	}{
+		{a: "0.4.0", b: "0.4.0", want: 0},
+		{a: "0.1.0", b: "0.4.0", want: -1},
+		{a: "0.10.0", b: "0.4.0", want: 1},
+		{a: "1.0", b: "1.0.0", want: 0},
+		{a: "", b: "0.1.0", want: -1},
+		{a: "v1.2.3", b: "1.2.3", want: 0},
+		{a: "0.4.0-rc.1", b: "0.4.0", want: 0},
+		{a: "0.x", b: "0.4.0", wantErr: true},
+		{a: "0.4.0", b: "latest", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			got, err := CompareVersions(tt.a, tt.b)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("CompareVersions() = %d, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("CompareVersions() = %d, %v, want %d", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSemver(t *testing.T) {
+	tests := []struct {
+		version string
+		want    Semver
+		wantErr bool
+	}{
+		{version: "1.2.3", want: Semver{Major: 1, Minor: 2, Patch: 3}},
+		{version: "v0.10.0", want: Semver{Prefix: "v", Minor: 10}},
+		{version: "1.3.0-rc.1", want: Semver{Major: 1, Minor: 3, Prerelease: "rc.1"}},
+		{version: "2.0.0-beta+build.5", want: Semver{Major: 2, Prerelease: "beta", Build: "build.5"}},
+		{version: "1.2", wantErr: true},
+		{version: "01.2.3", wantErr: true},
+		{version: "1.2.3-", wantErr: true},
+		{version: "1.2.3-rc..1", wantErr: true},
+		{version: "V1.2.3", wantErr: true},
+		{version: "20201104-1356", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got, err := ParseSemver(tt.version)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseSemver() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil || *got != tt.want {
+				t.Errorf("ParseSemver() = %+v, %v, want %+v", got, err, tt.want)
+			}
+			if got.String() != tt.version {
+				t.Errorf("String() = %s, want %s", got, tt.version)
+			}
+		})
+	}
+}
+
+func TestBump(t *testing.T) {
+	tests := []struct {
+		version string
+		part    string
+		pre     string
+		want    string
+		wantErr bool
+	}{
+		{version: "1.2.3", part: "patch", want: "1.2.4"},
+		{version: "1.2.3", part: "minor", want: "1.3.0"},
+		{version: "1.2.3", part: "major", want: "2.0.0"},
+		{version: "v1.2.3+build.5", part: "patch", want: "v1.2.4"},
+		{version: "1.2.3", part: "patch", pre: "rc", want: "1.2.4-rc.1"},
+		{version: "1.2.3", part: "major", pre: "rc", want: "2.0.0-rc.1"},
+		{version: "1.2.3", part: "prerelease", want: "1.2.4-rc.1"},
+		{version: "1.2.3", part: "prerelease", pre: "beta", want: "1.2.4-beta.1"},
+
+		// A pre-release of the version being bumped to is released
+		{version: "1.0.1-rc.1", part: "patch", want: "1.0.1"},
+		{version: "1.3.0-rc.2", part: "minor", want: "1.3.0"},
+		{version: "2.0.0-rc.2", part: "major", want: "2.0.0"},
+		{version: "1.3.1-rc.1", part: "minor", want: "1.4.0"},
+		{version: "2.1.0-rc.1", part: "major", want: "3.0.0"},
+
+		// The pre-release is incremented, or replaced by a later one
+		{version: "1.3.0-rc.1", part: "prerelease", want: "1.3.0-rc.2"},
+		{version: "1.3.0-rc", part: "prerelease", want: "1.3.0-rc.1"},
+		{version: "1.3.0-rc.1", part: "prerelease", pre: "rc", want: "1.3.0-rc.2"},
+		{version: "1.3.0-beta.2", part: "prerelease", pre: "rc", want: "1.3.0-rc.1"},
+		{version: "2.0.0-beta.1", part: "major", pre: "rc", want: "2.0.0-rc.1"},
+
+		// The same or an older version is rejected
+		{version: "1.0.1-rc.1", part: "patch", pre: "rc", wantErr: true},
+		{version: "1.1.0-rc.1", part: "minor", pre: "rc", wantErr: true},
+		{version: "2.0.0-rc.1", part: "major", pre: "rc", wantErr: true},
+		{version: "1.3.0-rc.1", part: "prerelease", pre: "beta", wantErr: true},
+		{version: "1.3.0-rc.1", part: "minor", pre: "alpha", wantErr: true},
+
+		{version: "1.2.3", part: "build", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.version+" "+tt.part+" "+tt.pre, func(t *testing.T) {
+			v, err := ParseSemver(tt.version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := v.Bump(tt.part, tt.pre)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Bump() = %s, want an error", got)
+				}
+				return
+			}
+			if err != nil || got.String() != tt.want {
+				t.Errorf("Bump() = %v, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	// Ordered by precedence, as in the example of the semver specification
+	versions := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2",
+		"1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.1.0", "2.0.0"}
+	for i, a := range versions {
+		for j, b := range versions {
+			va, _ := ParseSemver(a)
+			vb, _ := ParseSemver(b)
+			want := sign(i - j)
+			if got := va.Compare(vb); got != want {
+				t.Errorf("%s.Compare(%s) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// WorkspaceFile lists the Maru projects which are built together
+const WorkspaceFile = "maru-workspace.yaml"
+
+// MaruWorkspace is the content of the workspace file
+type MaruWorkspace struct {
+	// Directories of the member projects, relative to the workspace file. Glob patterns such as examples/* are allowed.
+	Projects []string `yaml:"projects"`
+}
+
+// WorkspaceProject is a Maru project which is a member of a workspace
+type WorkspaceProject struct {
+	Dir          string
+	Config       *MaruConfig
+	FromImages   []string
+	Dependencies []*WorkspaceProject
+}
+
+// FindWorkspaceRoot returns the directory containing the workspace file, searching from the working directory
+// upwards. If there is no workspace file, the working directory is returned together with false.
+func FindWorkspaceRoot() (string, bool) {
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		PrintFatal("%s", err)
+	}
+
+	for dir := cwd; ; dir = filepath.Dir(dir) {
+		if FileExists(filepath.Join(dir, WorkspaceFile)) {
+			return dir, true
+		}
+		if filepath.Dir(dir) == dir {
+			return cwd, false
+		}
+	}
+}
+
+// GetWorkspaceDirs returns the directories of the projects in the workspace at the given root, relative to the root.
+// Without a workspace file, every directory below the root which contains a maru.yaml is a member.
+func GetWorkspaceDirs(root string, hasFile bool) []string {
+
+	if !hasFile {
+		return discoverProjectDirs(root)
+	}
+
+	raw, err := ioutil.ReadFile(filepath.Join(root, WorkspaceFile))
+	if err != nil {
+		PrintFatal("Error reading %s: %s", WorkspaceFile, err)
+	}
+	var w MaruWorkspace
+	if err = yaml.UnmarshalStrict(raw, &w); err != nil {
+		PrintFatal("Error reading %s: %s", WorkspaceFile, err)
+	}
+
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, pattern := range w.Projects {
+		matches, err := filepath.Glob(filepath.Join(root, pattern))
+		if err != nil {
+			PrintFatal("Invalid project pattern %s in %s: %s", pattern, WorkspaceFile, err)
+		}
+		found := false
+		for _, match := range matches {
+			if !FileExists(filepath.Join(match, ConfFile)) {
+				continue
+			}
+			found = true
+			dir, _ := filepath.Rel(root, match)
+			if !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+		if !found {
+			PrintFatal("No %s found for %s in %s", ConfFile, pattern, WorkspaceFile)
+		}
+	}
+	return dirs
+}
+
+// Returns the directories below the root which contain a maru.yaml, skipping hidden directories
+func discoverProjectDirs(root string) []string {
+	var dirs []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != root && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if FileExists(filepath.Join(path, ConfFile)) {
+			dir, _ := filepath.Rel(root, path)
+			dirs = append(dirs, dir)
+		}
+		return nil
+	})
+	if err != nil {
+		PrintFatal("Error searching for projects: %s", err)
+	}
+	return dirs
+}
+
+// ImageRepository returns the repository of an image reference, without the tag, digest and default registry,
+// e.g. janeliascicomp/fiji for docker.io/janeliascicomp/fiji:latest
+func ImageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	image = strings.TrimPrefix(image, "docker.io/")
+	return strings.TrimPrefix(image, "library/")
+}
+
+// Images returns the repositories of the images which the project is tagged with, locally and in its remotes
+func (p *WorkspaceProject) Images() []string {
+	images := []string{ImageRepository(p.Config.GetNameVersion())}
+	for _, remote := range p.Config.Remotes {
+		images = append(images, ImageRepository(p.Config.GetDockerTag(remote)))
+	}
+	return images
+}
+
+// Tags returns every tag which the project's images can have, locally and in its remotes
+func (p *WorkspaceProject) Tags() []string {
+	tags := []string{p.Config.GetNameLatest(), p.Config.GetNameVersion()}
+	for _, remote := range p.Config.Remotes {
+		tags = append(tags, p.Config.GetRemote(remote)+"/"+p.Config.GetNameLatest(), p.Config.GetDockerTag(remote))
+	}
+	return tags
+}
+
+// ResolveDependencies links each project to the other projects whose images it builds on
+func ResolveDependencies(projects []*WorkspaceProject) {
+
+	producers := make(map[string]*WorkspaceProject)
+	for _, p := range projects {
+		for _, image := range p.Images() {
+			producers[image] = p
+		}
+	}
+
+	for _, p := range projects {
+		p.Dependencies = nil
+		for _, image := range p.FromImages {
+			producer := producers[ImageRepository(image)]
+			if producer != nil && producer != p && !containsProject(p.Dependencies, producer) {
+				p.Dependencies = append(p.Dependencies, producer)
+			}
+		}
+	}
+}
+
+// SortProjects orders the projects so that every project comes after the projects it depends on. Projects which
+// don't depend on each other are kept in the order of their directories. Returns an error if there is a cycle.
+func SortProjects(projects []*WorkspaceProject) ([]*WorkspaceProject, error) {
+
+	remaining := append([]*WorkspaceProject(nil), projects...)
+	sort.SliceStable(remaining, func(i, j int) bool { return remaining[i].Dir < remaining[j].Dir })
+
+	var sorted []*WorkspaceProject
+	for len(remaining) > 0 {
+		next := -1
+		for i, p := range remaining {
+			ready := true
+			for _, d := range p.Dependencies {
+				if !containsProject(sorted, d) {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			var names []string
+			for _, p := range remaining {
+				names = append(names, p.Dir)
+			}
+			return nil, fmt.Errorf("projects depend on each other in a cycle: %s", strings.Join(names, ", "))
+		}
+		sorted = append(sorted, remaining[next])
+		remaining = append(remaining[:next], remaining[next+1:]...)
+	}
+	return sorted, nil
+}
+
+// Dependants returns the given projects together with every project which depends on them, directly or indirectly,
+// in the order of the given sorted projects
+func Dependants(sorted []*WorkspaceProject, selected []*WorkspaceProject) []*WorkspaceProject {
+	var result []*WorkspaceProject
+	for _, p := range sorted {
+		if containsProject(selected, p) {
+			result = append(result, p)
+			continue
+		}
+		for _, d := range p.Dependencies {
+			if containsProject(result, d) {
+				result = append(result, p)
+				break
+			}
+		}
+	}
+	return result
+}
+
+// NeedsRebuild returns whether the project must be built again: if it's one of the selected projects, or if the image
+// of a project it depends on changed
+func NeedsRebuild(p *WorkspaceProject, selected []*WorkspaceProject, changed map[*WorkspaceProject]bool) bool {
+	if containsProject(selected, p) {
+		return true
+	}
+	for _, d := range p.Dependencies {
+		if changed[d] {
+			return true
+		}
+	}
+	return false
+}
+
+func containsProject(projects []*WorkspaceProject, p *WorkspaceProject) bool {
+	for _, q := range projects {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Returns workspace projects with the given directories, and links them to the projects they depend on as given by
+// dir: dependency dirs
+func newWorkspace(dirs []string, dependencies map[string][]string) map[string]*WorkspaceProject {
+	projects := make(map[string]*WorkspaceProject)
+	for _, dir := range dirs {
+		projects[dir] = &WorkspaceProject{Dir: dir}
+	}
+	for dir, deps := range dependencies {
+		for _, d := range deps {
+			projects[dir].Dependencies = append(projects[dir].Dependencies, projects[d])
+		}
+	}
+	return projects
+}
+
+func projectDirs(projects []*WorkspaceProject) []string {
+	var dirs []string
+	for _, p := range projects {
+		dirs = append(dirs, p.Dir)
+	}
+	return dirs
+}
+
+func TestSortProjects(t *testing.T) {
+	tests := []struct {
+		name         string
+		dirs         []string
+		dependencies map[string][]string
+		want         []string
+		wantErr      string
+	}{
+		{
+			name: "independent projects are sorted by directory",
+			dirs: []string{"c", "a", "b"},
+			want: []string{"a", "b", "c"},
+		},
+		{
+			name:         "dependency comes first",
+			dirs:         []string{"a", "b"},
+			dependencies: map[string][]string{"a": {"b"}},
+			want:         []string{"b", "a"},
+		},
+		{
+			name:         "chain",
+			dirs:         []string{"app", "base", "jre"},
+			dependencies: map[string][]string{"app": {"jre"}, "jre": {"base"}},
+			want:         []string{"base", "jre", "app"},
+		},
+		{
+			name:         "diamond",
+			dirs:         []string{"d", "c", "b", "a"},
+			dependencies: map[string][]string{"a": {"b", "c"}, "b": {"d"}, "c": {"d"}},
+			want:         []string{"d", "b", "c", "a"},
+		},
+		{
+			name:         "independent projects keep their order around dependencies",
+			dirs:         []string{"a", "b", "c", "d"},
+			dependencies: map[string][]string{"b": {"d"}},
+			want:         []string{"a", "c", "d", "b"},
+		},
+		{
+			name:         "cycle",
+			dirs:         []string{"a", "b", "c"},
+			dependencies: map[string][]string{"a": {"b"}, "b": {"a"}},
+			wantErr:      "cycle: a, b",
+		},
+		{
+			name: "no projects",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projects := newWorkspace(tt.dirs, tt.dependencies)
+			var input []*WorkspaceProject
+			for _, dir := range tt.dirs {
+				input = append(input, projects[dir])
+			}
+			sorted, err := SortProjects(input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("SortProjects() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SortProjects() error = %v", err)
+			}
+			if got := projectDirs(sorted); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SortProjects() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDependants(t *testing.T) {
+	dirs := []string{"base", "jre", "app", "tool", "other"}
+	dependencies := map[string][]string{"jre": {"base"}, "app": {"jre"}, "tool": {"base"}}
+
+	tests := []struct {
+		name     string
+		selected []string
+		want     []string
+	}{
+		{name: "base and everything built on it", selected: []string{"base"}, want: []string{"base", "jre", "app", "tool"}},
+		{name: "indirect dependants", selected: []string{"jre"}, want: []string{"jre", "app"}},
+		{name: "no dependants", selected: []string{"app"}, want: []string{"app"}},
+		{name: "several selected", selected: []string{"tool", "other"}, want: []string{"tool", "other"}},
+		{name: "result follows the sorted order", selected: []string{"app", "base"}, want: []string{"base", "jre", "app", "tool"}},
+		{name: "none selected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			projects := newWorkspace(dirs, dependencies)
+			var sorted, selected []*WorkspaceProject
+			for _, dir := range dirs {
+				sorted = append(sorted, projects[dir])
+			}
+			for _, dir := range tt.selected {
+				selected = append(selected, projects[dir])
+			}
+			if got := projectDirs(Dependants(sorted, selected)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Dependants() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNeedsRebuild(t *testing.T) {
+	projects := newWorkspace([]string{"base", "jre", "app"}, map[string][]string{"jre": {"base"}, "app": {"jre"}})
+	selected := []*WorkspaceProject{projects["base"]}
+
+	if !NeedsRebuild(projects["base"], selected, nil) {
+		t.Errorf("NeedsRebuild(base) = false, want true for a selected project")
+	}
+	if NeedsRebuild(projects["jre"], selected, map[*WorkspaceProject]bool{projects["base"]: false}) {
+		t.Errorf("NeedsRebuild(jre) = true, want false when its base didn't change")
+	}
+	if !NeedsRebuild(projects["jre"], selected, map[*WorkspaceProject]bool{projects["base"]: true}) {
+		t.Errorf("NeedsRebuild(jre) = false, want true when its base changed")
+	}
+	if NeedsRebuild(projects["app"], selected, map[*WorkspaceProject]bool{projects["base"]: true}) {
+		t.Errorf("NeedsRebuild(app) = true, want false when only an indirect dependency changed")
+	}
+}